@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleAuth serves GET /auth: the counters of report verification
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	stats, enabled := s.station.AuthStats()
+	if !enabled {
+		writeError(w, http.StatusNotFound, "report verification is disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleQuarantine serves GET /quarantine?limit=n: the most recently
+// quarantined reports, newest first
+func (s *Server) handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	quarantine := s.station.Quarantine()
+	if quarantine == nil {
+		writeError(w, http.StatusNotFound, "the quarantine is disabled")
+		return
+	}
+	limit := defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, "invalid limit: must be between 1 and %d", maxPageSize)
+			return
+		}
+		limit = n
+	}
+	reports, err := quarantine.List(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read the quarantine: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles is the web dashboard, built into the binary so that it needs
+// neither files next to it nor anything from the internet
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the dashboard below /dashboard/
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // The embedded directory always exists
+	}
+	return http.StripPrefix("/dashboard/", http.FileServer(http.FS(files)))
+}
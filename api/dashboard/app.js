@@ -0,0 +1,519 @@
+// MaritimeNavigator dashboard. Fed by the REST API and the /stream endpoint of
+// the server it is loaded from; it uses no external resources.
+(function () {
+    "use strict";
+
+    const COLORS = { fresh: "#3ddc84", stale: "#f5b041", lost: "#e74c3c", Active: "#3ddc84", Failed: "#e74c3c" };
+    const TRACK_LIMIT = 1000;       // Positions loaded per track
+    const FLEET_REFRESH = 15000;    // Staleness is recomputed by the server
+    const SATELLITE_REFRESH = 5000;
+
+    const state = {
+        vessels: new Map(),         // vesselID -> VesselState
+        tracks: new Map(),          // vesselID -> [{lat, lon, time}], oldest first
+        satellites: [],
+        links: new Map(),           // satelliteID -> [LinkInfo]
+        selected: null,
+        view: { lon: 0, lat: 20, scale: 3 }, // Map center and pixels per degree
+    };
+
+    // ---- API ----
+
+    async function getJSON(path) {
+        const response = await fetch(path, { headers: { Accept: "application/json" } });
+        const body = await response.json();
+        if (!response.ok) {
+            throw new Error(body.error || response.statusText);
+        }
+        return body;
+    }
+
+    async function loadFleet() {
+        try {
+            const fleet = await getJSON("/vessels");
+            state.vessels = new Map(fleet.map(v => [v.vesselID, v]));
+            renderVessels();
+            drawMap();
+        } catch (err) {
+            console.error("Failed to load vessels:", err);
+        }
+    }
+
+    async function loadTrack(vesselID) {
+        const page = await getJSON(`/vessels/${encodeURIComponent(vesselID)}/track?sort=desc&limit=${TRACK_LIMIT}`);
+        const track = page.positions.reverse().map(p => ({ lat: p.latitude, lon: p.longitude, time: p.timestamp }));
+        state.tracks.set(vesselID, track);
+        drawMap();
+    }
+
+    async function loadSatellites() {
+        try {
+            const satellites = await getJSON("/satellites");
+            const links = await Promise.all(satellites.map(s => getJSON(`/satellites/${encodeURIComponent(s.id)}/links`)));
+            state.satellites = satellites;
+            state.links = new Map(satellites.map((s, i) => [s.id, links[i]]));
+            renderSatellites();
+            drawTopology();
+        } catch (err) {
+            console.error("Failed to load satellites:", err);
+        }
+    }
+
+    // ---- Live stream ----
+
+    function connectStream() {
+        const status = document.getElementById("stream-status");
+        const source = new EventSource("/stream");
+        let connected = false;
+        source.onopen = () => {
+            status.textContent = "live";
+            status.className = "status live";
+            if (connected) {
+                loadFleet(); // Catch up on what was missed while disconnected
+            }
+            connected = true;
+        };
+        source.onerror = () => {
+            // EventSource reconnects by itself
+            status.textContent = "reconnecting";
+            status.className = "status offline";
+        };
+        source.addEventListener("position", event => applyPosition(JSON.parse(event.data)));
+        source.addEventListener("error", event => {
+            if (event.data) {
+                console.warn("Stream closed by server:", JSON.parse(event.data).error);
+            }
+        });
+    }
+
+    // describeNavigation returns a line with the speed, course and heading reported, if any
+    function describeNavigation(nav) {
+        if (!nav) {
+            return "";
+        }
+        const parts = [];
+        if (nav.sog !== undefined) {
+            parts.push(`${nav.sog.toFixed(1)} kn`);
+        }
+        if (nav.cog !== undefined) {
+            parts.push(`cog ${nav.cog.toFixed(1)}°`);
+        }
+        if (nav.heading !== undefined) {
+            parts.push(`hdg ${nav.heading}°`);
+        }
+        return parts.length ? parts.join(", ") + "\n" : "";
+    }
+
+    function applyPosition(p) {
+        const current = state.vessels.get(p.vesselID);
+        if (!current || new Date(p.timestamp) >= new Date(current.position.timestamp)) {
+            state.vessels.set(p.vesselID, {
+                vesselID: p.vesselID,
+                static: p.static || (current && current.static),
+                position: { vesselID: p.vesselID, latitude: p.latitude, longitude: p.longitude, timestamp: p.timestamp, navigation: p.navigation },
+                lastSeen: p.receivedAt,
+                satellite: p.satellite,
+                feed: p.feed,
+                hops: p.hops,
+                state: "fresh",
+            });
+        }
+        const track = state.tracks.get(p.vesselID);
+        if (track) {
+            track.push({ lat: p.latitude, lon: p.longitude, time: p.timestamp });
+            track.sort((a, b) => new Date(a.time) - new Date(b.time));
+            if (track.length > TRACK_LIMIT) {
+                track.shift();
+            }
+        }
+        scheduleRender();
+    }
+
+    let renderPending = false;
+    function scheduleRender() {
+        if (!renderPending) {
+            renderPending = true;
+            requestAnimationFrame(() => {
+                renderPending = false;
+                renderVessels();
+                drawMap();
+            });
+        }
+    }
+
+    // ---- Vessel table ----
+
+    function renderVessels() {
+        const body = document.querySelector("#vessels tbody");
+        const rows = [];
+        const counts = { fresh: 0, stale: 0, lost: 0 };
+        const ids = Array.from(state.vessels.keys()).sort();
+        for (const id of ids) {
+            const v = state.vessels.get(id);
+            counts[v.state]++;
+            const tr = document.createElement("tr");
+            if (id === state.selected) {
+                tr.className = "selected";
+            }
+            tr.innerHTML = `<td></td><td><span class="state ${v.state}"></span>${v.state}</td><td>${age(v.lastSeen)}</td><td></td><td>${v.hops}</td>`;
+            tr.cells[0].textContent = id;
+            tr.cells[3].textContent = v.satellite || v.feed || "-";
+            tr.onclick = () => select(id, true);
+            rows.push(tr);
+        }
+        body.replaceChildren(...rows);
+        document.getElementById("summary").textContent =
+            `${ids.length} vessels: ${counts.fresh} fresh, ${counts.stale} stale, ${counts.lost} lost`;
+    }
+
+    function age(timestamp) {
+        const seconds = Math.max(0, Math.round((Date.now() - new Date(timestamp)) / 1000));
+        if (seconds < 60) return `${seconds}s ago`;
+        if (seconds < 3600) return `${Math.floor(seconds / 60)}m ago`;
+        if (seconds < 86400) return `${Math.floor(seconds / 3600)}h ago`;
+        return `${Math.floor(seconds / 86400)}d ago`;
+    }
+
+    async function select(vesselID, center) {
+        state.selected = vesselID;
+        const v = state.vessels.get(vesselID);
+        if (center && v) {
+            state.view.lon = v.position.longitude;
+            state.view.lat = v.position.latitude;
+        }
+        renderVessels();
+        drawMap();
+        if (!state.tracks.has(vesselID)) {
+            try {
+                await loadTrack(vesselID);
+            } catch (err) {
+                console.error(`Failed to load track of ${vesselID}:`, err);
+            }
+        }
+    }
+
+    // ---- Map ----
+
+    const map = document.getElementById("map");
+    const mapContext = map.getContext("2d");
+
+    function resizeCanvas(canvas) {
+        const ratio = window.devicePixelRatio || 1;
+        canvas.width = canvas.clientWidth * ratio;
+        canvas.height = canvas.clientHeight * ratio;
+        canvas.getContext("2d").setTransform(ratio, 0, 0, ratio, 0, 0);
+    }
+
+    // project maps a position to canvas pixels, picking the copy of the world
+    // nearest to the view center so that the map wraps around the antimeridian
+    function project(lat, lon) {
+        const v = state.view;
+        lon = v.lon + wrap(lon - v.lon);
+        return [(lon - v.lon) * v.scale + map.clientWidth / 2, (v.lat - lat) * v.scale + map.clientHeight / 2];
+    }
+
+    function unproject(x, y) {
+        const v = state.view;
+        return [v.lat - (y - map.clientHeight / 2) / v.scale, v.lon + (x - map.clientWidth / 2) / v.scale];
+    }
+
+    // wrap maps a longitude difference into [-180, 180)
+    function wrap(delta) {
+        return ((delta + 180) % 360 + 360) % 360 - 180;
+    }
+
+    function drawMap() {
+        const ctx = mapContext;
+        const width = map.clientWidth, height = map.clientHeight;
+        ctx.fillStyle = "#0d1b2a";
+        ctx.fillRect(0, 0, width, height);
+        drawGraticule(ctx, width, height);
+
+        const showAll = document.getElementById("all-tracks").checked;
+        for (const [id, track] of state.tracks) {
+            if (showAll || id === state.selected) {
+                drawTrack(ctx, track, id === state.selected);
+            }
+        }
+        for (const v of state.vessels.values()) {
+            const [x, y] = project(v.position.latitude, v.position.longitude);
+            const selected = v.vesselID === state.selected;
+            ctx.beginPath();
+            ctx.arc(x, y, selected ? 7 : 5, 0, 2 * Math.PI);
+            ctx.fillStyle = COLORS[v.state] || "#fff";
+            ctx.fill();
+            if (selected) {
+                ctx.strokeStyle = "#fff";
+                ctx.lineWidth = 2;
+                ctx.stroke();
+            }
+            ctx.fillStyle = "#d8e3ee";
+            ctx.font = "11px system-ui, sans-serif";
+            ctx.fillText(v.vesselID, x + 9, y + 4);
+        }
+    }
+
+    function drawGraticule(ctx, width, height) {
+        const v = state.view;
+        const step = [1, 2, 5, 10, 15, 30, 45].find(s => s * v.scale >= 60) || 90;
+        const [top, left] = unproject(0, 0);
+        const [bottom, right] = unproject(width, height);
+        ctx.strokeStyle = "#1b3148";
+        ctx.fillStyle = "#4d6680";
+        ctx.lineWidth = 1;
+        ctx.font = "10px system-ui, sans-serif";
+
+        for (let lon = Math.ceil(left / step) * step; lon <= right; lon += step) {
+            const x = (lon - v.lon) * v.scale + width / 2;
+            ctx.beginPath();
+            ctx.moveTo(x, 0);
+            ctx.lineTo(x, height);
+            ctx.stroke();
+            const label = wrap(lon);
+            ctx.fillText(`${Math.abs(label)}°${label < 0 ? "W" : label > 0 && label < 180 ? "E" : ""}`, x + 3, height - 6);
+        }
+        for (let lat = Math.ceil(Math.max(bottom, -90) / step) * step; lat <= Math.min(top, 90); lat += step) {
+            const y = (v.lat - lat) * v.scale + height / 2;
+            ctx.beginPath();
+            ctx.moveTo(0, y);
+            ctx.lineTo(width, y);
+            ctx.stroke();
+            ctx.fillText(`${Math.abs(lat)}°${lat < 0 ? "S" : lat > 0 ? "N" : ""}`, 4, y - 3);
+        }
+
+        // Poles
+        ctx.fillStyle = "#0a1622";
+        const north = (v.lat - 90) * v.scale + height / 2;
+        const south = (v.lat + 90) * v.scale + height / 2;
+        if (north > 0) ctx.fillRect(0, 0, width, north);
+        if (south < height) ctx.fillRect(0, south, width, height - south);
+    }
+
+    // drawTrack draws a track as one continuous line: longitudes are unwrapped so
+    // that crossing the antimeridian does not jump across the map
+    function drawTrack(ctx, track, selected) {
+        if (track.length < 2) {
+            return;
+        }
+        const last = track[track.length - 1];
+        const [lastX] = project(last.lat, last.lon);
+        const unwrapped = [];
+        let lon = last.lon;
+        for (let i = track.length - 1; i >= 0; i--) {
+            if (i < track.length - 1) {
+                lon += wrap(track[i].lon - track[i + 1].lon);
+            }
+            unwrapped.push([track[i].lat, lon]);
+        }
+        const v = state.view;
+        ctx.beginPath();
+        unwrapped.forEach(([lat, lon], i) => {
+            const x = lastX + (lon - last.lon) * v.scale;
+            const y = (v.lat - lat) * v.scale + map.clientHeight / 2;
+            if (i === 0) ctx.moveTo(x, y); else ctx.lineTo(x, y);
+        });
+        ctx.strokeStyle = selected ? "#4fc3f7" : "rgba(79, 195, 247, 0.35)";
+        ctx.lineWidth = selected ? 2 : 1;
+        ctx.stroke();
+    }
+
+    function fitVessels() {
+        const vessels = Array.from(state.vessels.values());
+        if (vessels.length === 0) {
+            return;
+        }
+        const lats = vessels.map(v => v.position.latitude);
+        const ref = vessels[0].position.longitude;
+        const lons = vessels.map(v => ref + wrap(v.position.longitude - ref));
+        const minLat = Math.min(...lats), maxLat = Math.max(...lats);
+        const minLon = Math.min(...lons), maxLon = Math.max(...lons);
+        state.view.lat = (minLat + maxLat) / 2;
+        state.view.lon = (minLon + maxLon) / 2;
+        const scale = Math.min(map.clientWidth / Math.max(maxLon - minLon, 1), map.clientHeight / Math.max(maxLat - minLat, 1));
+        state.view.scale = Math.max(0.5, Math.min(scale * 0.8, 2000));
+        drawMap();
+    }
+
+    function vesselAt(x, y) {
+        let nearest = null, best = 10;
+        for (const v of state.vessels.values()) {
+            const [vx, vy] = project(v.position.latitude, v.position.longitude);
+            const distance = Math.hypot(vx - x, vy - y);
+            if (distance < best) {
+                nearest = v;
+                best = distance;
+            }
+        }
+        return nearest;
+    }
+
+    function setupMapInteraction() {
+        const tooltip = document.getElementById("tooltip");
+        let drag = null;
+
+        map.addEventListener("mousedown", event => {
+            drag = { x: event.offsetX, y: event.offsetY, lon: state.view.lon, lat: state.view.lat, moved: false };
+            map.classList.add("dragging");
+        });
+        window.addEventListener("mouseup", event => {
+            if (drag && !drag.moved && event.target === map) {
+                const v = vesselAt(event.offsetX, event.offsetY);
+                if (v) select(v.vesselID, false);
+            }
+            drag = null;
+            map.classList.remove("dragging");
+        });
+        map.addEventListener("mousemove", event => {
+            if (drag) {
+                const dx = event.offsetX - drag.x, dy = event.offsetY - drag.y;
+                drag.moved = drag.moved || Math.abs(dx) + Math.abs(dy) > 3;
+                state.view.lon = drag.lon - dx / state.view.scale;
+                state.view.lat = Math.max(-90, Math.min(90, drag.lat + dy / state.view.scale));
+                drawMap();
+                return;
+            }
+            const v = vesselAt(event.offsetX, event.offsetY);
+            if (!v) {
+                tooltip.hidden = true;
+                return;
+            }
+            const p = v.position;
+            const name = v.static && v.static.name ? ` ${v.static.name}` : "";
+            tooltip.textContent = `${v.vesselID}${name} (${v.state})\n${p.latitude.toFixed(4)}, ${p.longitude.toFixed(4)}\n` +
+                describeNavigation(p.navigation) +
+                `fix ${new Date(p.timestamp).toLocaleString()}\nvia ${v.satellite || v.feed || "-"}, ${v.hops} hops`;
+            tooltip.style.left = `${event.offsetX + 14}px`;
+            tooltip.style.top = `${event.offsetY + 14}px`;
+            tooltip.hidden = false;
+        });
+        map.addEventListener("mouseleave", () => { tooltip.hidden = true; });
+        map.addEventListener("wheel", event => {
+            event.preventDefault();
+            // Zoom around the cursor
+            const [lat, lon] = unproject(event.offsetX, event.offsetY);
+            const factor = event.deltaY < 0 ? 1.25 : 0.8;
+            state.view.scale = Math.max(0.5, Math.min(state.view.scale * factor, 2000));
+            state.view.lon = lon - (event.offsetX - map.clientWidth / 2) / state.view.scale;
+            state.view.lat = lat + (event.offsetY - map.clientHeight / 2) / state.view.scale;
+            drawMap();
+        }, { passive: false });
+
+        document.getElementById("fit").onclick = fitVessels;
+        document.getElementById("all-tracks").onchange = async event => {
+            if (event.target.checked) {
+                const missing = Array.from(state.vessels.keys()).filter(id => !state.tracks.has(id));
+                await Promise.all(missing.map(id => loadTrack(id).catch(err => console.error(err))));
+            }
+            drawMap();
+        };
+    }
+
+    // ---- Satellites ----
+
+    const topology = document.getElementById("topology");
+    const topologyContext = topology.getContext("2d");
+
+    function renderSatellites() {
+        const body = document.querySelector("#satellites tbody");
+        const rows = state.satellites.map(s => {
+            const tr = document.createElement("tr");
+            const links = (state.links.get(s.id) || [])
+                .map(l => `${l.neighbor} ${l.latencyMs} ms, ${(l.packetLoss * 100).toFixed(0)}% loss`);
+            if (s.groundLink) {
+                links.push(`ground station ${s.groundLink.latencyMs} ms, ${(s.groundLink.packetLoss * 100).toFixed(0)}% loss`);
+            }
+            tr.innerHTML = `<td></td><td><span class="state ${s.status}"></span>${s.status}</td><td>${s.port}</td><td></td>`;
+            tr.cells[0].textContent = s.id;
+            tr.cells[3].textContent = `${(state.links.get(s.id) || []).length}`;
+            tr.title = links.join("\n");
+            return tr;
+        });
+        body.replaceChildren(...rows);
+    }
+
+    // drawTopology draws the satellites on a circle, linked by their ISLs labelled
+    // with latency and packet loss
+    function drawTopology() {
+        const ctx = topologyContext;
+        const width = topology.clientWidth, height = topology.clientHeight;
+        ctx.clearRect(0, 0, width, height);
+        const count = state.satellites.length;
+        if (count === 0) {
+            return;
+        }
+        const radius = Math.min(width, height) / 2 - 40;
+        const positions = new Map(state.satellites.map((s, i) => {
+            const angle = -Math.PI / 2 + 2 * Math.PI * i / count;
+            return [s.id, [width / 2 + radius * Math.cos(angle), height / 2 + radius * Math.sin(angle)]];
+        }));
+
+        // One edge per satellite pair; both directions are labelled when they differ
+        const drawn = new Set();
+        ctx.font = "10px system-ui, sans-serif";
+        for (const [id, links] of state.links) {
+            for (const link of links) {
+                const key = [id, link.neighbor].sort().join("|");
+                if (drawn.has(key) || !positions.has(link.neighbor)) continue;
+                drawn.add(key);
+                const reverse = (state.links.get(link.neighbor) || []).find(l => l.neighbor === id);
+                const [x1, y1] = positions.get(id), [x2, y2] = positions.get(link.neighbor);
+                const loss = Math.max(link.packetLoss, reverse ? reverse.packetLoss : 0);
+                ctx.strokeStyle = loss < 0.05 ? COLORS.fresh : loss < 0.2 ? COLORS.stale : COLORS.lost;
+                ctx.setLineDash(link.neighborStatus === "Active" ? [] : [4, 4]);
+                ctx.lineWidth = 1.5;
+                ctx.beginPath();
+                ctx.moveTo(x1, y1);
+                ctx.lineTo(x2, y2);
+                ctx.stroke();
+                ctx.setLineDash([]);
+
+                let label = `${link.latencyMs} ms ${(link.packetLoss * 100).toFixed(0)}%`;
+                if (reverse && (reverse.latencyMs !== link.latencyMs || reverse.packetLoss !== link.packetLoss)) {
+                    label += ` / ${reverse.latencyMs} ms ${(reverse.packetLoss * 100).toFixed(0)}%`;
+                }
+                ctx.fillStyle = "#7d93a8";
+                ctx.fillText(label, (x1 + x2) / 2 - ctx.measureText(label).width / 2, (y1 + y2) / 2 - 4);
+            }
+        }
+
+        ctx.font = "11px system-ui, sans-serif";
+        for (const s of state.satellites) {
+            const [x, y] = positions.get(s.id);
+            ctx.beginPath();
+            ctx.arc(x, y, 9, 0, 2 * Math.PI);
+            ctx.fillStyle = COLORS[s.status] || "#888";
+            ctx.fill();
+            if (s.groundLink) {
+                // Gateways get a ring and the quality of their ground link
+                ctx.strokeStyle = "#d8e3ee";
+                ctx.lineWidth = 1.5;
+                ctx.beginPath();
+                ctx.arc(x, y, 13, 0, 2 * Math.PI);
+                ctx.stroke();
+                const label = `ground ${s.groundLink.latencyMs} ms ${(s.groundLink.packetLoss * 100).toFixed(0)}%`;
+                ctx.fillStyle = "#7d93a8";
+                ctx.fillText(label, x - ctx.measureText(label).width / 2, y + 35);
+            }
+            ctx.fillStyle = "#d8e3ee";
+            ctx.fillText(s.id, x - ctx.measureText(s.id).width / 2, y + 22);
+        }
+    }
+
+    // ---- Startup ----
+
+    function resize() {
+        resizeCanvas(map);
+        resizeCanvas(topology);
+        drawMap();
+        drawTopology();
+    }
+
+    window.addEventListener("resize", resize);
+    setupMapInteraction();
+    resize();
+    loadFleet().then(fitVessels);
+    loadSatellites();
+    connectStream();
+    setInterval(loadFleet, FLEET_REFRESH);
+    setInterval(loadSatellites, SATELLITE_REFRESH);
+})();
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"project3/pkg/export"
+)
+
+// maxExportRecords bounds the number of positions a single export may contain
+const maxExportRecords = 100000
+
+// handleExport serves GET /export?format=geojson|kml|gpx: the positions matching
+// the filters of /positions as a downloadable GIS file, one track per vessel
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	params := r.URL.Query()
+	formatName := params.Get("format")
+	if formatName == "" {
+		formatName = string(export.GeoJSON)
+	}
+	format, err := export.ParseFormat(formatName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	q, err := parseFilter(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	q.Limit = maxExportRecords + 1
+
+	records, err := s.station.Store().Query(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to query positions: %v", err)
+		return
+	}
+	if len(records) > maxExportRecords {
+		writeError(w, http.StatusRequestEntityTooLarge, "export exceeds %d positions, narrow it with vessel, from, to or bbox", maxExportRecords)
+		return
+	}
+
+	// Render first so that a failure can still be reported as an error response
+	var body bytes.Buffer
+	if err := export.Write(&body, format, records); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to export positions: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tracks.%s\"", format.Extension()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -1,27 +1,105 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"project3/pkg/common"
 	"project3/pkg/groundstation"
+	"project3/pkg/satellite"
+	"strings"
 )
 
-// StartAPIServer Starting the HTTP API server, this is a scalable function
-func StartAPIServer() {
-	http.HandleFunc("/vessels", handleVessels)
-	common.Logger.Println("API server started at :12345")
-	err := http.ListenAndServe(":12345", nil)
-	if err != nil {
-		return
+// DefaultAddress is where the API listens when no address is configured
+const DefaultAddress = ":12345"
+
+// Server exposes the ground station and the satellite constellation over REST
+type Server struct {
+	station  *groundstation.Server
+	topology *satellite.TopologyManager
+	mux      *http.ServeMux
+}
+
+// NewServer creates the API server and registers its routes
+func NewServer(station *groundstation.Server, topology *satellite.TopologyManager) *Server {
+	s := &Server{station: station, topology: topology, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/vessels", s.handleVessels)
+	s.mux.HandleFunc("/vessels/", s.handleVessel)
+	s.mux.HandleFunc("/positions", s.handlePositions)
+	s.mux.HandleFunc("/export", s.handleExport)
+	s.mux.HandleFunc("/stream", s.handleStream)
+	s.mux.HandleFunc("/ws", s.handleWebSocket)
+	s.mux.HandleFunc("/satellites", s.handleSatellites)
+	s.mux.HandleFunc("/satellites/", s.handleSatellite)
+	s.mux.HandleFunc("/links", s.handleLinks)
+	s.mux.HandleFunc("/routing", s.handleRouting)
+	s.mux.HandleFunc("/auth", s.handleAuth)
+	s.mux.HandleFunc("/quarantine", s.handleQuarantine)
+	s.mux.Handle("/dashboard/", dashboardHandler())
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/dashboard/", http.StatusFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	})
+	return s
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// StartAPIServer Starting the HTTP API server, this is a scalable function. With
+// a TLS configuration it serves HTTPS.
+func StartAPIServer(address string, station *groundstation.Server, topology *satellite.TopologyManager, config *tls.Config) {
+	if address == "" {
+		address = DefaultAddress
+	}
+	server := &http.Server{Addr: address, Handler: NewServer(station, topology).Handler(), TLSConfig: config}
+	var err error
+	if config != nil {
+		common.Logger.Printf("API server started at %s over HTTPS\n", address)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		common.Logger.Printf("API server started at %s\n", address)
+		err = server.ListenAndServe()
+	}
+	common.Logger.Printf("API server stopped: %v\n", err)
+}
+
+// errorResponse is the body of every failed API call
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, errorResponse{Error: fmt.Sprintf(format, args...)})
+}
+
+// allowGet rejects anything but GET and HEAD requests
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return false
 	}
+	return true
 }
 
-func handleVessels(w http.ResponseWriter, r *http.Request) {
-	messages, err := groundstation.LoadFromDatabase()
-	if err != nil {
-		http.Error(w, "Failed to load data", http.StatusInternalServerError)
-		return
+// pathParts splits the path below prefix into its segments
+func pathParts(path, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil
 	}
-	json.NewEncoder(w).Encode(messages)
+	return strings.Split(rest, "/")
 }
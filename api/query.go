@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"project3/pkg/groundstation"
+	"strconv"
+	"strings"
+)
+
+// Page size limits of position queries
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// positionPage is one page of a position query
+type positionPage struct {
+	Positions  []position `json:"positions"`
+	NextCursor string     `json:"nextCursor,omitempty"` // Absent on the last page
+}
+
+// handlePositions serves GET /positions: a paginated, filtered query over all stored positions
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.writePage(w, q)
+}
+
+// writePage runs a query and writes one page of results with the cursor of the next one
+func (s *Server) writePage(w http.ResponseWriter, q groundstation.Query) {
+	limit := q.Limit
+	q.Limit = limit + 1 // One extra record tells whether another page follows
+
+	records, err := s.station.Store().Query(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to query positions: %v", err)
+		return
+	}
+
+	page := positionPage{Positions: make([]position, 0, limit)}
+	if len(records) > limit {
+		records = records[:limit]
+		page.NextCursor = groundstation.CursorOf(records[limit-1]).Encode()
+	}
+	for _, rec := range records {
+		page.Positions = append(page.Positions, newPosition(rec))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseQuery builds a store query from the request parameters:
+//
+//	vessel=ID[,ID...]                   repeatable
+//	from, to                            RFC 3339 times, inclusive
+//	bbox=minLon,minLat,maxLon,maxLat    minLon > maxLon crosses the antimeridian
+//	min_priority, max_priority          message priority bounds, inclusive
+//	sort=asc|desc                       by timestamp, oldest first by default
+//	limit                               page size, at most maxPageSize
+//	cursor                              nextCursor of the previous page
+func parseQuery(params url.Values) (groundstation.Query, error) {
+	q, err := parseFilter(params)
+	if err != nil {
+		return q, err
+	}
+
+	switch params.Get("sort") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("invalid sort %q: use asc or desc", params.Get("sort"))
+	}
+
+	q.Limit = defaultPageSize
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, fmt.Errorf("invalid limit: must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := groundstation.DecodeCursor(value)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor: %v", err)
+		}
+		q.After = &cursor
+	}
+	return q, nil
+}
+
+// parseFilter parses the filter parameters of parseQuery: vessel, from, to, bbox,
+// min_priority and max_priority
+func parseFilter(params url.Values) (groundstation.Query, error) {
+	var q groundstation.Query
+	for _, value := range params["vessel"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				q.VesselIDs = append(q.VesselIDs, id)
+			}
+		}
+	}
+
+	var err error
+	if q.From, err = parseTime(params.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from: %v", err)
+	}
+	if q.To, err = parseTime(params.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to: %v", err)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return q, fmt.Errorf("to must not be before from")
+	}
+
+	if value := params.Get("bbox"); value != "" {
+		if q.BBox, err = parseBBox(value); err != nil {
+			return q, err
+		}
+	}
+	if q.MinPriority, err = parseOptionalInt(params, "min_priority"); err != nil {
+		return q, err
+	}
+	if q.MaxPriority, err = parseOptionalInt(params, "max_priority"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// parseBBox parses "minLon,minLat,maxLon,maxLat"
+func parseBBox(value string) (*groundstation.BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid bbox: expected minLon,minLat,maxLon,maxLat")
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bbox: %v", err)
+		}
+		coords[i] = v
+	}
+	box := &groundstation.BoundingBox{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}
+	if box.MinLat > box.MaxLat || box.MinLat < -90 || box.MaxLat > 90 ||
+		box.MinLon < -180 || box.MinLon > 180 || box.MaxLon < -180 || box.MaxLon > 180 {
+		return nil, fmt.Errorf("invalid bbox: coordinates out of range")
+	}
+	return box, nil
+}
+
+func parseOptionalInt(params url.Values, name string) (*int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return &n, nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"project3/pkg/satellite"
+)
+
+// handleSatellites serves GET /satellites
+func (s *Server) handleSatellites(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.topology.List())
+}
+
+// handleSatellite serves GET /satellites/{id}, GET /satellites/{id}/links,
+// GET /satellites/{id}/routes, GET /satellites/{id}/queues and PUT /satellites/{id}/status
+func (s *Server) handleSatellite(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/satellites/")
+	if len(parts) == 2 && parts[1] == "status" {
+		s.handleSatelliteStatus(w, r, parts[0])
+		return
+	}
+	if !allowGet(w, r) {
+		return
+	}
+	if len(parts) == 0 || len(parts) > 2 || (len(parts) == 2 && parts[1] != "links" && parts[1] != "routes" && parts[1] != "queues") {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+	sat, exists := s.topology.Get(parts[0])
+	if !exists {
+		writeError(w, http.StatusNotFound, "satellite %s not found", parts[0])
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, sat.Info())
+		return
+	}
+	switch parts[1] {
+	case "routes":
+		writeJSON(w, http.StatusOK, sat.Routes())
+		return
+	case "queues":
+		writeJSON(w, http.StatusOK, sat.Queues())
+		return
+	}
+	writeJSON(w, http.StatusOK, sat.Links())
+}
+
+// statusRequest is the body of PUT /satellites/{id}/status
+type statusRequest struct {
+	Status string `json:"status"` // "Active" or "Failed"
+}
+
+// handleSatelliteStatus serves PUT /satellites/{id}/status, which fails or
+// recovers a satellite to watch the routes converge
+func (s *Server) handleSatelliteStatus(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", "PUT")
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	if _, exists := s.topology.Get(id); !exists {
+		writeError(w, http.StatusNotFound, "satellite %s not found", id)
+		return
+	}
+	var req statusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: %v", err)
+		return
+	}
+	if err := s.topology.SetStatus(id, req.Status); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	sat, _ := s.topology.Get(id)
+	writeJSON(w, http.StatusOK, sat.Info())
+}
+
+// handleRouting serves GET /routing: the state of every satellite's router
+// and the convergence of their routes since the last topology change
+func (s *Server) handleRouting(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.topology.Convergence())
+}
+
+// handleLinks serves GET /links, the traffic and savings of every batched link
+func (s *Server) handleLinks(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, satellite.Links())
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"project3/pkg/common"
+	"project3/pkg/groundstation"
+	"time"
+)
+
+// Timing of live streams
+const (
+	streamHeartbeat    = 15 * time.Second // Keeps idle connections and proxies alive
+	streamWriteTimeout = 10 * time.Second // A WebSocket client not reading for this long is dropped
+)
+
+// streamEvent is a message of the WebSocket stream
+type streamEvent struct {
+	Type     string    `json:"type"` // "position" or "error"
+	Position *position `json:"position,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// subscribe parses the stream filters (vessel and bbox, as for /positions) and
+// subscribes to the ground station bus. On failure an error has been written.
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) (*groundstation.Subscription, bool) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return nil, false
+	}
+	return s.station.Bus().Subscribe(filter), true
+}
+
+// handleStream serves GET /stream: newly ingested positions as Server-Sent Events
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	sub, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case rec := <-sub.Records():
+			data, err := json.Marshal(newPosition(rec))
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: position\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-sub.Done():
+			if err := sub.Err(); err != nil {
+				data, _ := json.Marshal(errorResponse{Error: err.Error()})
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+			}
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// handleWebSocket serves GET /ws: newly ingested positions over a WebSocket,
+// one JSON streamEvent per text message
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	sub, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	conn, err := upgradeWebSocket(w, r, streamWriteTimeout)
+	if err != nil {
+		common.Logger.Printf("WebSocket upgrade from %s failed: %v\n", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+
+	// Clients only talk to answer pings and close; anything else is ignored
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case rec := <-sub.Records():
+			pos := newPosition(rec)
+			data, err := json.Marshal(streamEvent{Type: "position", Position: &pos})
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteText(data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		case <-sub.Done():
+			code := wsCloseGoingAway
+			if err := sub.Err(); err == groundstation.ErrSlowConsumer {
+				code = wsClosePolicyViolation
+				data, _ := json.Marshal(streamEvent{Type: "error", Error: err.Error()})
+				conn.WriteText(data)
+			}
+			conn.WriteClose(code, "")
+			return
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"strings"
+	"testing"
+	"time"
+)
+
+func streamRecord(vesselID string, id int, lat, lon float64) groundstation.Record {
+	return groundstation.Record{
+		Version:  1,
+		Envelope: groundstation.Envelope{ID: id, Source: vesselID, Destination: groundstation.NodeID, Priority: 5},
+		Position: protocol.PositionMessage{
+			Type:      protocol.PositionUpdate,
+			VesselID:  vesselID,
+			Latitude:  lat,
+			Longitude: lon,
+			Timestamp: time.Date(2026, 10, 18, 6, 0, id, 0, time.UTC),
+		},
+		Receipt: groundstation.Receipt{Satellite: "Satellite-1", ReceivedAt: time.Date(2026, 10, 18, 6, 0, id, 0, time.UTC)},
+	}
+}
+
+// sseEvents reads the events of a Server-Sent Events stream, skipping comments
+func sseEvents(body *bufio.Reader, events chan<- [2]string) {
+	var name string
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			close(events)
+			return
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			events <- [2]string{name, strings.TrimPrefix(line, "data: ")}
+		}
+	}
+}
+
+func TestStreamDeliversMatchingRecordsOnly(t *testing.T) {
+	station := groundstation.NewServer(groundstation.NewMemoryStore())
+	server := httptest.NewServer(NewServer(station, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?vessel=Vessel-1&bbox=-5,49,-3,51")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body := bufio.NewReader(resp.Body)
+	if line, err := body.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("first line %q, %v", line, err) // Subscribed from here on
+	}
+	events := make(chan [2]string, 10)
+	go sseEvents(body, events)
+
+	bus := station.Bus()
+	bus.Publish(streamRecord("Vessel-2", 1, 50, -4))  // Other vessel
+	bus.Publish(streamRecord("Vessel-1", 2, 52, -4))  // Outside the box
+	bus.Publish(streamRecord("Vessel-1", 3, 50, 10))  // Outside the box
+	bus.Publish(streamRecord("Vessel-1", 4, 50, -4))  // Matching
+	bus.Publish(streamRecord("Vessel-12", 5, 50, -4)) // Other vessel sharing a prefix
+	bus.Publish(streamRecord("Vessel-1", 6, 49, -5))  // On the edge of the box
+
+	var ids []int
+	for len(ids) < 2 {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("stream ended after %v", ids)
+			}
+			var pos position
+			if event[0] != "position" || json.Unmarshal([]byte(event[1]), &pos) != nil {
+				t.Fatalf("unexpected event %q", event)
+			}
+			ids = append(ids, pos.MessageID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, then nothing", ids)
+		}
+	}
+	if ids[0] != 4 || ids[1] != 6 {
+		t.Errorf("streamed records %v, want [4 6]", ids)
+	}
+}
+
+func TestStreamRejectsInvalidFilter(t *testing.T) {
+	station := groundstation.NewServer(groundstation.NewMemoryStore())
+	server := httptest.NewServer(NewServer(station, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?bbox=1,2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if stats := station.Bus().Stats(); stats.Subscribers != 0 {
+		t.Errorf("%d subscribers after a rejected stream", stats.Subscribers)
+	}
+}
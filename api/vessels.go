@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"time"
+)
+
+// position is a stored position as returned by the API
+type position struct {
+	protocol.PositionMessage
+	MessageID  int       `json:"messageID"`
+	Priority   int       `json:"priority"`
+	Satellite  string    `json:"satellite,omitempty"`
+	Feed       string    `json:"feed,omitempty"`
+	Hops       int       `json:"hops"`
+	Verified   bool      `json:"verified,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+func newPosition(rec groundstation.Record) position {
+	return position{
+		PositionMessage: rec.Position,
+		MessageID:       rec.Envelope.ID,
+		Priority:        rec.Envelope.Priority,
+		Satellite:       rec.Receipt.Satellite,
+		Feed:            rec.Receipt.Feed,
+		Hops:            rec.Receipt.Hops,
+		Verified:        rec.Receipt.Verified,
+		ReceivedAt:      rec.Receipt.ReceivedAt,
+	}
+}
+
+// handleVessels serves GET /vessels: the current fleet picture
+func (s *Server) handleVessels(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.station.Fleet().Snapshot(time.Now()))
+}
+
+// handleVessel serves GET /vessels/{id} and GET /vessels/{id}/track
+func (s *Server) handleVessel(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	parts := pathParts(r.URL.Path, "/vessels/")
+	switch {
+	case len(parts) == 1:
+		state, exists := s.station.Fleet().Vessel(parts[0], time.Now())
+		if !exists {
+			writeError(w, http.StatusNotFound, "vessel %s not found", parts[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+	case len(parts) == 2 && parts[1] == "track":
+		s.handleTrack(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+}
+
+// handleTrack serves GET /vessels/{id}/track. It accepts the parameters of
+// /positions except vessel, and pages the same way.
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request, vesselID string) {
+	if _, exists := s.station.Fleet().Vessel(vesselID, time.Now()); !exists {
+		writeError(w, http.StatusNotFound, "vessel %s not found", vesselID)
+		return
+	}
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	q.VesselIDs = []string{vesselID}
+	s.writePage(w, q)
+}
+
+// parseTime parses an optional RFC 3339 query parameter
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes and close codes of RFC 6455
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsClosePolicyViolation = 1008
+	wsCloseTooBig          = 1009
+)
+
+// wsGUID is appended to the client key to compute the handshake accept key
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxFrameSize bounds the frames accepted from clients, which only send
+// control frames and short messages
+const wsMaxFrameSize = 64 << 10
+
+var errWSClosed = errors.New("websocket closed")
+
+// wsConn is the server side of a WebSocket connection. Writes are safe for
+// concurrent use; reads must happen from a single goroutine.
+type wsConn struct {
+	conn         net.Conn
+	reader       *bufio.Reader
+	writeMu      sync.Mutex
+	writeTimeout time.Duration
+	closeSent    bool
+}
+
+// upgradeWebSocket performs the opening handshake and takes over the connection.
+// On failure an error response has already been written.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, writeTimeout time.Duration) (*wsConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		writeError(w, http.StatusBadRequest, "expected a WebSocket upgrade request")
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, "unsupported WebSocket version")
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		writeError(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+		return nil, errors.New("invalid websocket key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "connection cannot be upgraded")
+		return nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader, writeTimeout: writeTimeout}, nil
+}
+
+// headerContains reports whether a comma-separated header lists token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends a text message
+func (c *wsConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsText, payload)
+}
+
+// Ping sends a ping; the client answers with a pong
+func (c *wsConn) Ping() error {
+	return c.writeFrame(wsPing, nil)
+}
+
+// WriteClose starts or completes the closing handshake
+func (c *wsConn) WriteClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123] // Control frames carry at most 125 bytes
+	}
+	return c.writeFrame(wsClose, append(payload, reason...))
+}
+
+// writeFrame sends one unfragmented, unmasked frame. A client that does not
+// accept it within the write timeout fails the write.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return errWSClosed
+	}
+	if opcode == wsClose {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch size := len(payload); {
+	case size < 126:
+		header[1] = byte(size)
+	case size <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(size))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(size))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// ReadMessage returns the next data message, answering pings and the closing
+// handshake on the way. It returns errWSClosed once the client closed.
+func (c *wsConn) ReadMessage() (opcode byte, payload []byte, err error) {
+	var message []byte
+	messageOpcode := byte(0)
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, data); err != nil {
+				return 0, nil, err
+			}
+		case wsPong:
+		case wsClose:
+			code := wsCloseNormal
+			if len(data) >= 2 {
+				code = int(binary.BigEndian.Uint16(data))
+			}
+			c.WriteClose(code, "")
+			return 0, nil, errWSClosed
+		case wsText, wsBinary, wsContinuation:
+			if op == wsContinuation && messageOpcode == 0 || op != wsContinuation && messageOpcode != 0 {
+				c.WriteClose(wsCloseProtocolError, "unexpected continuation")
+				return 0, nil, fmt.Errorf("websocket protocol error: unexpected opcode %d", op)
+			}
+			if op != wsContinuation {
+				messageOpcode = op
+			}
+			if len(message)+len(data) > wsMaxFrameSize {
+				c.WriteClose(wsCloseTooBig, "message too big")
+				return 0, nil, errors.New("websocket message too big")
+			}
+			message = append(message, data...)
+			if fin {
+				return messageOpcode, message, nil
+			}
+		default:
+			c.WriteClose(wsCloseProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("websocket protocol error: unknown opcode %d", op)
+		}
+	}
+}
+
+// readFrame reads and unmasks one client frame
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		c.WriteClose(wsCloseProtocolError, "client frames must be masked")
+		return false, 0, nil, errors.New("websocket protocol error: unmasked client frame")
+	}
+
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > wsMaxFrameSize {
+		c.WriteClose(wsCloseTooBig, "frame too big")
+		return false, 0, nil, errors.New("websocket frame too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Close closes the underlying connection
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -1,29 +1,180 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"project3/api"
+	"project3/pkg/auth"
+	"project3/pkg/bench"
+	"project3/pkg/certs"
 	"project3/pkg/common"
+	"project3/pkg/export"
+	"project3/pkg/feed"
 	"project3/pkg/groundstation"
 	"project3/pkg/satellite"
+	"project3/pkg/transport"
+	"project3/pkg/tui"
 	"project3/pkg/vessel"
+	"syscall"
+	"time"
 )
 
 func main() {
 
+	// Run a subcommand instead of the simulation when one is given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	err := common.LoadConfig("config.json") // Specify the configuration file path
 	if err != nil {
 		common.Logger.Fatal("Failed to load config:", err) // If loading fails, log the error and exit
 	}
 
+	// Open the ground station storage backend
+	store, err := groundstation.OpenStore(common.AppConfig.Storage)
+	if err != nil {
+		common.Logger.Fatal("Failed to open storage:", err)
+	}
+
+	// Enforce the retention policy in the background
+	var compactor *groundstation.Compactor
+	policy := groundstation.RetentionPolicyFromConfig(common.AppConfig.Storage.Retention)
+	if retainer, ok := store.(groundstation.Retainer); ok && policy.Enabled() {
+		interval := time.Duration(common.AppConfig.Storage.Retention.CompactIntervalMinutes) * time.Minute
+		compactor = groundstation.NewCompactor(retainer, policy, interval)
+		compactor.Start()
+	}
+
 	// Activate the ground station server
-	go groundstation.StartServer()
+	station := groundstation.NewServer(store)
+	if fleetConfig := common.AppConfig.Fleet; fleetConfig.LostAfterSeconds > 0 {
+		station.Fleet().SetThresholds(time.Duration(fleetConfig.StaleAfterSeconds)*time.Second, time.Duration(fleetConfig.LostAfterSeconds)*time.Second)
+	}
+	if streamConfig := common.AppConfig.Stream; streamConfig.SubscriberBuffer > 0 {
+		station.Bus().SetLimits(streamConfig.SubscriberBuffer, time.Duration(streamConfig.EvictAfterSeconds)*time.Second)
+	}
+	if err := station.Fleet().Rebuild(store); err != nil {
+		common.Logger.Println("Failed to rebuild the fleet picture from storage:", err)
+	}
+	if dedupConfig := common.AppConfig.Dedup; dedupConfig.WindowMinutes > 0 {
+		dedup := groundstation.NewDeduplicator(dedupConfig.Capacity, time.Duration(dedupConfig.WindowMinutes)*time.Minute)
+		if err := dedup.Seed(store, time.Now()); err != nil {
+			common.Logger.Println("Failed to seed duplicate suppression from storage:", err)
+		}
+		station.SetDeduplicator(dedup)
+	}
+	var quarantine *groundstation.Quarantine
+	if authConfig := common.AppConfig.Auth; len(authConfig.Keys) > 0 || authConfig.Keystore != "" || authConfig.Require {
+		keys, err := auth.LoadVerificationKeys(authConfig)
+		if err != nil {
+			common.Logger.Fatal("Failed to load verification keys:", err)
+		}
+		if authConfig.Quarantine {
+			quarantine, err = groundstation.OpenQuarantine(authConfig.QuarantinePath)
+			if err != nil {
+				common.Logger.Fatal("Failed to open the quarantine:", err)
+			}
+		}
+		station.SetVerifier(auth.NewVerifier(keys, authConfig.Require), quarantine)
+		station.TrustFeeds(authConfig.TrustFeeds)
+		if feedConfig := common.AppConfig.Feed; authConfig.Require && !authConfig.TrustFeeds && (feedConfig.TCPAddress != "" || feedConfig.UDPAddress != "") {
+			common.Logger.Println("AIS feeds carry no signatures: their reports are rejected unless auth.trust_feeds is set")
+		}
+	}
+	if err := satellite.ConfigureWire(common.AppConfig); err != nil {
+		common.Logger.Fatal("Invalid configuration:", err)
+	}
+	go station.StartServer(common.AppConfig.GroundStationAddress)
+
+	// The API and the TCP feeds serve the ground station's certificate when set to
+	var apiTLS, feedTLS *tls.Config
+	if tlsConfig := common.AppConfig.TLS; tlsConfig.API || tlsConfig.Feeds {
+		security, err := transport.LoadSecurity(tlsConfig.CA, tlsConfig.CertDir)
+		if err == nil && tlsConfig.API {
+			apiTLS, err = security.ServerConfig(groundstation.NodeID, false)
+		}
+		if err == nil && tlsConfig.Feeds {
+			feedTLS, err = security.ServerConfig(groundstation.NodeID, true)
+		}
+		if err != nil {
+			common.Logger.Fatal("Failed to load TLS settings:", err)
+		}
+	}
+
+	// Accept AIS feeds besides the satellites
+	feeds := feed.NewListener(station)
+	if address := common.AppConfig.Feed.TCPAddress; address != "" {
+		if err := feeds.ListenTCP(address, feedTLS); err != nil {
+			common.Logger.Println("Failed to start the NMEA feed TCP listener:", err)
+		}
+	}
+	if address := common.AppConfig.Feed.UDPAddress; address != "" {
+		if feedTLS != nil {
+			common.Logger.Printf("tls.feeds covers TCP feeds only: the UDP feed listener at %s accepts plaintext from anyone\n", address)
+		}
+		if err := feeds.ListenUDP(address); err != nil {
+			common.Logger.Println("Failed to start the NMEA feed UDP listener:", err)
+		}
+	}
 
 	// Activate the satellite services
-	go satellite.RunSimulation("config.json")
+	topology := satellite.RunSimulation("config.json")
+
+	// Activate the REST API
+	go api.StartAPIServer(common.AppConfig.APIAddress, station, topology, apiTLS)
 
 	// Activate the vessel simulator
 	go vessel.RunSimulation("config.json")
 
-	// Blocking the main thread
-	select {}
+	// Run until interrupted, then flush the satellite queues before the storage
+	// they deliver to is closed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+	common.Logger.Println("Shutting down")
+
+	topology.Close()
+	if compactor != nil {
+		compactor.Stop()
+	}
+	if quarantine != nil {
+		if err := quarantine.Close(); err != nil {
+			common.Logger.Println("Failed to close the quarantine:", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		common.Logger.Println("Failed to close storage:", err)
+	}
+}
+
+// runCommand runs a command line tool and exits on failure
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "bench":
+		err = bench.RunCommand(args)
+	case "certs":
+		err = certs.RunCommand(args)
+	case "export":
+		err = export.RunCommand(args)
+	case "keys":
+		err = auth.RunCommand(args)
+	case "replay":
+		err = feed.RunCommand(args)
+	case "tui":
+		err = tui.RunCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q, available: bench, certs, export, keys, replay, tui", name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
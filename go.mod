@@ -1 +1,3 @@
 module project3
+
+go 1.27.1
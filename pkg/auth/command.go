@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"project3/pkg/common"
+)
+
+// RunCommand implements the keys command line:
+//
+//	keys [-config config.json] [-algorithm ed25519] [-signing keys/signing.json] [-verify keys/verify.json] [vessel-id...]
+//
+// It adds a new key for every vessel given, by default for every vessel of
+// the configuration, to the signing keystore, keeping the keys already there.
+// It then writes the verification keystore of the ground station from it,
+// without the private keys.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "configuration listing the vessels and keystores")
+	algorithm := flags.String("algorithm", Ed25519, "signing algorithm of new keys, ed25519 or hmac-sha256")
+	signingPath := flags.String("signing", "", "keystore of the vessels (default: auth.signing_keystore of the configuration)")
+	verifyPath := flags.String("verify", "", "keystore of the ground station (default: auth.keystore of the configuration)")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	vessels := flags.Args()
+	if len(vessels) == 0 || *signingPath == "" || *verifyPath == "" {
+		if err := common.LoadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *signingPath == "" {
+		*signingPath = common.AppConfig.Auth.SigningKeystore
+	}
+	if *verifyPath == "" {
+		*verifyPath = common.AppConfig.Auth.Keystore
+	}
+	if *signingPath == "" || *verifyPath == "" {
+		return fmt.Errorf("no keystore to write: set auth.keystore and auth.signing_keystore, or -signing and -verify")
+	}
+	if *signingPath == *verifyPath {
+		return fmt.Errorf("the signing and verification keystores must be different files")
+	}
+	if len(vessels) == 0 {
+		for _, vessel := range common.AppConfig.Vessels {
+			vessels = append(vessels, vessel.ID)
+		}
+	}
+
+	signing := make(map[string]common.KeyConfig)
+	if data, err := ioutil.ReadFile(*signingPath); err == nil {
+		if err := json.Unmarshal(data, &signing); err != nil {
+			return fmt.Errorf("invalid keystore %s: %w", *signingPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	created := 0
+	for _, vesselID := range vessels {
+		if _, exists := signing[vesselID]; exists {
+			continue
+		}
+		key, err := GenerateKey(*algorithm)
+		if err != nil {
+			return err
+		}
+		signing[vesselID] = key
+		created++
+	}
+	verify := make(map[string]common.KeyConfig, len(signing))
+	for vesselID, key := range signing {
+		verify[vesselID] = VerificationKey(key)
+	}
+
+	if err := writeKeystore(*signingPath, signing); err != nil {
+		return err
+	}
+	if err := writeKeystore(*verifyPath, verify); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Created %d keys; %d vessels sign with %s, the ground station verifies with %s\n",
+		created, len(signing), *signingPath, *verifyPath)
+	return nil
+}
+
+// writeKeystore replaces the keystore at path, readable by its owner only
+func writeKeystore(path string, keys map[string]common.KeyConfig) error {
+	data, err := json.MarshalIndent(keys, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,179 @@
+// Package auth signs position reports at the vessel and verifies them at the
+// ground station, with an HMAC-SHA256 secret or an Ed25519 key pair per vessel.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"project3/pkg/common"
+)
+
+// Signing algorithms
+const (
+	HMACSHA256 = "hmac-sha256"
+	Ed25519    = "ed25519"
+)
+
+// minSecretLength is the shortest HMAC secret accepted, in bytes
+const minSecretLength = 16
+
+// Key signs or verifies the reports of one vessel
+type Key struct {
+	Algorithm string
+	secret    []byte             // HMAC
+	private   ed25519.PrivateKey // Ed25519, nil where reports are only verified
+	public    ed25519.PublicKey  // Ed25519
+}
+
+// ParseKey decodes a configured key
+func ParseKey(config common.KeyConfig) (*Key, error) {
+	key := &Key{Algorithm: config.Algorithm}
+	switch config.Algorithm {
+	case HMACSHA256:
+		secret, err := base64.StdEncoding.DecodeString(config.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret: %w", err)
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("secret of %d bytes too short, want at least %d", len(secret), minSecretLength)
+		}
+		key.secret = secret
+	case Ed25519:
+		if config.PrivateKey != "" {
+			seed, err := base64.StdEncoding.DecodeString(config.PrivateKey)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, fmt.Errorf("invalid private key: want %d base64 bytes", ed25519.SeedSize)
+			}
+			key.private = ed25519.NewKeyFromSeed(seed)
+			key.public = key.private.Public().(ed25519.PublicKey)
+		}
+		if config.PublicKey != "" {
+			public, err := base64.StdEncoding.DecodeString(config.PublicKey)
+			if err != nil || len(public) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid public key: want %d base64 bytes", ed25519.PublicKeySize)
+			}
+			if key.public != nil && !key.public.Equal(ed25519.PublicKey(public)) {
+				return nil, fmt.Errorf("public key does not match the private key")
+			}
+			key.public = public
+		}
+		if key.public == nil {
+			return nil, fmt.Errorf("missing private or public key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", config.Algorithm)
+	}
+	return key, nil
+}
+
+// GenerateKey creates a random key configuration for the algorithm
+func GenerateKey(algorithm string) (common.KeyConfig, error) {
+	config := common.KeyConfig{Algorithm: algorithm}
+	switch algorithm {
+	case HMACSHA256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return config, err
+		}
+		config.Secret = base64.StdEncoding.EncodeToString(secret)
+	case Ed25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return config, err
+		}
+		config.PrivateKey = base64.StdEncoding.EncodeToString(private.Seed())
+		config.PublicKey = base64.StdEncoding.EncodeToString(public)
+	default:
+		return config, fmt.Errorf("unknown signing algorithm %q", algorithm)
+	}
+	return config, nil
+}
+
+// Keyring holds the keys of the vessels
+type Keyring struct {
+	keys map[string]*Key
+}
+
+// LoadSigningKeys collects the keys the vessels sign with, configured inline
+// and in the signing keystore
+func LoadSigningKeys(config common.AuthConfig) (*Keyring, error) {
+	configs, err := readKeys(config.SigningKeystore, config.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyring(configs)
+}
+
+// LoadVerificationKeys collects the keys the ground station verifies with,
+// configured inline and in the keystore. It refuses Ed25519 private keys,
+// which belong to the vessels alone.
+func LoadVerificationKeys(config common.AuthConfig) (*Keyring, error) {
+	configs, err := readKeys(config.Keystore, config.Keys)
+	if err != nil {
+		return nil, err
+	}
+	for vesselID, key := range configs {
+		if key.PrivateKey != "" {
+			return nil, fmt.Errorf("key of vessel %s: a private key where only the public key belongs", vesselID)
+		}
+	}
+	return newKeyring(configs)
+}
+
+// VerificationKey returns the part of a key configuration needed to verify:
+// the public key of an Ed25519 pair, or the HMAC secret
+func VerificationKey(config common.KeyConfig) common.KeyConfig {
+	config.PrivateKey = ""
+	return config
+}
+
+// readKeys reads the keystore at path, if any, and adds the inline keys
+func readKeys(path string, inline map[string]common.KeyConfig) (map[string]common.KeyConfig, error) {
+	configs := make(map[string]common.KeyConfig)
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w; generate keys with: go run cmd/main.go keys", err)
+		} else if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("invalid keystore %s: %w", path, err)
+		}
+	}
+	for vesselID, key := range inline {
+		if _, exists := configs[vesselID]; exists {
+			return nil, fmt.Errorf("key of vessel %s configured twice", vesselID)
+		}
+		configs[vesselID] = key
+	}
+	return configs, nil
+}
+
+func newKeyring(configs map[string]common.KeyConfig) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]*Key, len(configs))}
+	for vesselID, keyConfig := range configs {
+		key, err := ParseKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("key of vessel %s: %w", vesselID, err)
+		}
+		keyring.keys[vesselID] = key
+	}
+	return keyring, nil
+}
+
+// Key returns the key of a vessel
+func (k *Keyring) Key(vesselID string) (*Key, bool) {
+	key, exists := k.keys[vesselID]
+	return key, exists
+}
+
+// Len returns the number of keys
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
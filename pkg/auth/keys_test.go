@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"project3/pkg/common"
+	"project3/pkg/protocol"
+	"project3/pkg/satellite"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readKeystore(t *testing.T, path string) map[string]common.KeyConfig {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]common.KeyConfig)
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestKeysCommandSplitsKeystores(t *testing.T) {
+	dir := t.TempDir()
+	signing, verify := filepath.Join(dir, "keys", "signing.json"), filepath.Join(dir, "keys", "verify.json")
+	run := func(args ...string) {
+		t.Helper()
+		if err := RunCommand(append([]string{"-signing", signing, "-verify", verify}, args...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("Vessel-1", "Vessel-2")
+	run("-algorithm", HMACSHA256, "Vessel-2", "Vessel-3")
+
+	signingKeys, verifyKeys := readKeystore(t, signing), readKeystore(t, verify)
+	if len(signingKeys) != 3 || len(verifyKeys) != 3 {
+		t.Fatalf("%d signing and %d verification keys, want 3 of each", len(signingKeys), len(verifyKeys))
+	}
+	if signingKeys["Vessel-2"].Algorithm != Ed25519 {
+		t.Errorf("existing key of Vessel-2 replaced by %s", signingKeys["Vessel-2"].Algorithm)
+	}
+	for vesselID, key := range verifyKeys {
+		if key.PrivateKey != "" {
+			t.Errorf("verification keystore holds the private key of %s", vesselID)
+		}
+	}
+	for _, path := range []string{signing, verify} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: %v, %v, want mode 0600", path, info.Mode().Perm(), err)
+		}
+	}
+
+	// What one side signs, the other verifies
+	signer, err := LoadSigningKeys(common.AuthConfig{SigningKeystore: signing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := LoadVerificationKeys(common.AuthConfig{Keystore: verify})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vesselID := range []string{"Vessel-1", "Vessel-3"} {
+		msg := satellite.Message{ID: 7, Source: vesselID, Destination: "GroundStation", Content: protocol.PositionMessage{
+			VesselID: vesselID, Latitude: 59.9, Longitude: 10.7, Timestamp: time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC),
+		}}
+		key, _ := signer.Key(vesselID)
+		if err := key.Sign(&msg); err != nil {
+			t.Fatal(err)
+		}
+		msg.TTL, msg.Path = 3, []string{"Satellite-1"}
+		if verified, err := NewVerifier(verifier, true).Verify(msg); !verified || err != nil {
+			t.Errorf("%s: verified=%v, %v", vesselID, verified, err)
+		}
+		msg.ID++
+		if _, err := NewVerifier(verifier, true).Verify(msg); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: altered report: %v, want %v", vesselID, err, ErrBadSignature)
+		}
+	}
+}
+
+func TestVerificationKeysRefusePrivateKeys(t *testing.T) {
+	private, err := GenerateKey(Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "verify.json")
+	data, _ := json.Marshal(map[string]common.KeyConfig{"Vessel-1": private})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadVerificationKeys(common.AuthConfig{Keystore: path}); err == nil {
+		t.Error("keystore with a private key accepted")
+	}
+	inline := common.AuthConfig{Keys: map[string]common.KeyConfig{"Vessel-1": private}}
+	if _, err := LoadVerificationKeys(inline); err == nil {
+		t.Error("inline private key accepted")
+	}
+	inline.Keys["Vessel-1"] = VerificationKey(private)
+	if keys, err := LoadVerificationKeys(inline); err != nil || keys.Len() != 1 {
+		t.Errorf("public key: %v", err)
+	}
+	if _, err := LoadVerificationKeys(common.AuthConfig{Keystore: filepath.Join(dir, "missing.json")}); err == nil || !strings.Contains(err.Error(), "cmd/main.go keys") {
+		t.Errorf("missing keystore: %v, want a hint to generate keys", err)
+	}
+}
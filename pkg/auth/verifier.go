@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"fmt"
+	"project3/pkg/satellite"
+	"sync/atomic"
+)
+
+// Stats reports the outcome of the reports a verifier checked
+type Stats struct {
+	Verified uint64 `json:"verified"` // Signed reports that verified
+	Unsigned uint64 `json:"unsigned"` // Reports without a signature, accepted or not
+	Rejected uint64 `json:"rejected"` // Unsigned reports where a signature is required, and signatures that do not verify
+}
+
+// Verifier checks the signatures of reports against the vessels' keys.
+// Reports of vessels with a key must be signed with it; unsigned reports of
+// vessels without one are accepted unless signatures are required.
+type Verifier struct {
+	verified uint64 // First, for 64-bit alignment of the atomics
+	unsigned uint64
+	rejected uint64
+	keys     *Keyring
+	require  bool
+}
+
+// NewVerifier creates a verifier of reports signed with keys
+func NewVerifier(keys *Keyring, require bool) *Verifier {
+	return &Verifier{keys: keys, require: require}
+}
+
+// Verify checks a report. It reports whether the report carried a valid
+// signature, and returns an error wrapping ErrUnsigned, ErrNoKey or
+// ErrBadSignature for a report that must be rejected.
+func (v *Verifier) Verify(msg satellite.Message) (bool, error) {
+	key, hasKey := v.keys.Key(msg.Source)
+	if len(msg.Signature) == 0 {
+		atomic.AddUint64(&v.unsigned, 1)
+		if hasKey || v.require {
+			atomic.AddUint64(&v.rejected, 1)
+			return false, fmt.Errorf("%w: message %d from %s", ErrUnsigned, msg.ID, msg.Source)
+		}
+		return false, nil
+	}
+	if !hasKey {
+		atomic.AddUint64(&v.rejected, 1)
+		return false, fmt.Errorf("%w: message %d from %s", ErrNoKey, msg.ID, msg.Source)
+	}
+	if err := key.Verify(msg); err != nil {
+		atomic.AddUint64(&v.rejected, 1)
+		return false, fmt.Errorf("%w: message %d from %s", err, msg.ID, msg.Source)
+	}
+	atomic.AddUint64(&v.verified, 1)
+	return true, nil
+}
+
+// Stats returns a snapshot of the verifier's counters
+func (v *Verifier) Stats() Stats {
+	return Stats{
+		Verified: atomic.LoadUint64(&v.verified),
+		Unsigned: atomic.LoadUint64(&v.unsigned),
+		Rejected: atomic.LoadUint64(&v.rejected),
+	}
+}
@@ -0,0 +1,154 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"project3/pkg/protocol"
+	"project3/pkg/satellite"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// workload is a set of messages encoded as one frame
+type workload struct {
+	name string
+	msgs []satellite.Message
+}
+
+// RunCommand implements the benchmark command line:
+//
+//	bench [-batch 100]
+//
+// It compares the wire codecs on representative messages: encoded size,
+// and encode and decode throughput.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	batch := flags.Int("batch", 100, "messages in the batch workload")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("-batch must be at least 1")
+	}
+
+	workloads := []workload{
+		{"position", []satellite.Message{sampleMessage(0, false)}},
+		{"position+static", []satellite.Message{sampleMessage(0, true)}},
+		{fmt.Sprintf("batch of %d", *batch), sampleBatch(*batch)},
+	}
+	codecs := []satellite.Codec{satellite.JSONCodec, satellite.BinaryCodec}
+	return run(os.Stdout, workloads, codecs)
+}
+
+func run(out io.Writer, workloads []workload, codecs []satellite.Codec) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "WORKLOAD\tCODEC\tBYTES\tBYTES/MSG\tRATIO\tENCODE\tDECODE\tENCODE MSG/S\tDECODE MSG/S\t")
+	for _, load := range workloads {
+		var baseline int
+		for _, codec := range codecs {
+			data, err := codec.Marshal(load.msgs)
+			if err != nil {
+				return fmt.Errorf("%s: %v", codecName(codec), err)
+			}
+			if _, err := codec.Unmarshal(data); err != nil {
+				return fmt.Errorf("%s: %v", codecName(codec), err)
+			}
+			if baseline == 0 {
+				baseline = len(data)
+			}
+
+			encode := testing.Benchmark(func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					codec.Marshal(load.msgs)
+				}
+			})
+			decode := testing.Benchmark(func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					codec.Unmarshal(data)
+				}
+			})
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.2f\t%s\t%s\t%s\t%s\t\n",
+				load.name, codecName(codec), len(data), len(data)/len(load.msgs), float64(len(data))/float64(baseline),
+				perOp(encode), perOp(decode), rate(encode, len(load.msgs)), rate(decode, len(load.msgs)))
+		}
+	}
+	return w.Flush()
+}
+
+func codecName(codec satellite.Codec) string {
+	if codec == satellite.JSONCodec {
+		return "json"
+	}
+	return "binary"
+}
+
+func perOp(r testing.BenchmarkResult) string {
+	return time.Duration(r.NsPerOp()).String()
+}
+
+// rate returns how many messages per second the benchmark processed
+func rate(r testing.BenchmarkResult, msgs int) string {
+	if r.NsPerOp() == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", float64(msgs)*1e9/float64(r.NsPerOp()))
+}
+
+// sampleMessage is a simulated vessel report that crossed two satellites
+func sampleMessage(i int, withStatic bool) satellite.Message {
+	speed, course, rateOfTurn := 14.4, 39.3+float64(i%10), -3.7
+	heading := 36 + i%10
+	status := protocol.UnderWayUsingEngine
+	msg := satellite.Message{
+		ID:          1792304715 + i,
+		Source:      "Vessel-1",
+		Destination: "GroundStation",
+		Priority:    6,
+		TTL:         3,
+		Path:        []string{"Satellite-1", "Satellite-2"},
+		Content: protocol.PositionMessage{
+			Type:      protocol.PositionUpdate,
+			VesselID:  "Vessel-1",
+			Latitude:  -21.634834282888487 + float64(i)*0.0003,
+			Longitude: -135.80476429622922 + float64(i)*0.0002,
+			Timestamp: time.Date(2026, 10, 18, 6, 25, 15, 563000000, time.UTC).Add(time.Duration(i) * 5 * time.Second),
+			MMSI:      235009801,
+			Navigation: &protocol.Navigation{
+				SpeedOverGround:  &speed,
+				CourseOverGround: &course,
+				Heading:          &heading,
+				RateOfTurn:       &rateOfTurn,
+				Status:           &status,
+			},
+		},
+	}
+	if withStatic {
+		msg.Content.Static = &protocol.VesselInfo{
+			MMSI:        235009801,
+			IMO:         9321471,
+			Name:        "NORTHERN STAR",
+			CallSign:    "2AFB1",
+			ShipType:    70,
+			Dimensions:  &protocol.Dimensions{ToBow: 143, ToStern: 47, ToPort: 15, ToStarboard: 15},
+			Draught:     10.2,
+			Destination: "ROTTERDAM",
+		}
+	}
+	return msg
+}
+
+// sampleBatch is consecutive reports of one vessel, every twelfth with static data
+func sampleBatch(n int) []satellite.Message {
+	msgs := make([]satellite.Message, n)
+	for i := range msgs {
+		msgs[i] = sampleMessage(i, i%12 == 0)
+	}
+	return msgs
+}
@@ -0,0 +1,75 @@
+package certs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"project3/pkg/common"
+	"project3/pkg/groundstation"
+	"strings"
+	"time"
+)
+
+// RunCommand implements the certs command line:
+//
+//	certs [-config config.json] [-dir certs] [-days 365] [-hosts localhost,127.0.0.1,::1] [node-id...]
+//
+// It creates the CA of the directory unless it exists and issues a
+// certificate to every node given, by default to every node of the
+// configuration: the ground station, the satellites and the vessels.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("certs", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "configuration listing the nodes")
+	dir := flags.String("dir", "", "output directory (default: tls.cert_dir of the configuration, or certs)")
+	days := flags.Int("days", 365, "validity of the certificates in days")
+	hosts := flags.String("hosts", "localhost,127.0.0.1,::1", "comma-separated names and addresses the nodes are reached at")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *days < 1 {
+		return fmt.Errorf("-days must be positive")
+	}
+
+	nodes := flags.Args()
+	if len(nodes) == 0 || *dir == "" {
+		if err := common.LoadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *dir == "" {
+		*dir = common.AppConfig.TLS.CertDir
+		if *dir == "" {
+			*dir = "certs"
+		}
+	}
+	if len(nodes) == 0 {
+		nodes = append(nodes, groundstation.NodeID)
+		for _, satellite := range common.AppConfig.Satellites {
+			nodes = append(nodes, satellite.ID)
+		}
+		for _, vessel := range common.AppConfig.Vessels {
+			nodes = append(nodes, vessel.ID)
+		}
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	validity := time.Duration(*days) * 24 * time.Hour
+	authority, created, err := LoadOrCreateAuthority(*dir, 10*validity)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Fprintf(os.Stderr, "Created a CA in %s\n", *dir)
+	}
+	for _, node := range nodes {
+		if err := authority.Issue(*dir, node, strings.Split(*hosts, ","), validity); err != nil {
+			return fmt.Errorf("certificate of %s: %w", node, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Issued %d certificates in %s\n", len(nodes), *dir)
+	return nil
+}
@@ -5,13 +5,22 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
 )
 
 // SatelliteConfig holds individual satellite configuration
 type SatelliteConfig struct {
-	ID        string           `json:"id"`
-	Port      int              `json:"port"`
-	Neighbors []NeighborConfig `json:"neighbors"`
+	ID         string            `json:"id"`
+	Port       int               `json:"port"`
+	Transport  string            `json:"transport"`   // "http" (default) or "tcp"
+	GroundLink *GroundLinkConfig `json:"ground_link"` // Only gateway satellites, which see the ground station, have one
+	Neighbors  []NeighborConfig  `json:"neighbors"`
+}
+
+// GroundLinkConfig defines a gateway satellite's link to the ground station
+type GroundLinkConfig struct {
+	Latency    int     `json:"latency"`
+	PacketLoss float64 `json:"packet_loss"`
 }
 
 // NeighborConfig defines a satellite's connection to its neighbors
@@ -25,11 +34,147 @@ type NeighborConfig struct {
 type VesselConfig struct {
 	ID        string `json:"id"`
 	Satellite string `json:"satellite"` // Associated satellite ID
+
+	// Identity and static data reported by the simulated vessel; all optional
+	MMSI        uint32  `json:"mmsi"`
+	IMO         uint32  `json:"imo"`
+	Name        string  `json:"name"`
+	CallSign    string  `json:"call_sign"`
+	ShipType    uint8   `json:"ship_type"` // AIS type of ship and cargo, e.g. 70 for cargo
+	Length      int     `json:"length"`    // Meters
+	Beam        int     `json:"beam"`      // Meters
+	Draught     float64 `json:"draught"`   // Meters
+	Destination string  `json:"destination"`
+	Speed       float64 `json:"speed"` // Cruising speed in knots
+}
+
+// StorageConfig selects and configures the ground station storage backend
+type StorageConfig struct {
+	Backend string `json:"backend"` // "file", "memory" or "kv"
+	Path    string `json:"path"`    // Log directory for the file backend, database file for kv
+
+	// Options of the file and kv backends
+	Fsync           string `json:"fsync"`             // "always", "batch" or "none"
+	FsyncIntervalMs int    `json:"fsync_interval_ms"` // Flush interval of the batch policy
+
+	// Options of the file backend
+	Import               string `json:"import"`                  // Legacy JSON-lines database imported into an empty log
+	SegmentSizeMB        int    `json:"segment_size_mb"`         // Rotate segments at this size
+	SegmentMaxAgeMinutes int    `json:"segment_max_age_minutes"` // Rotate segments at this age
+
+	Retention RetentionConfig `json:"retention"`
+}
+
+// RetentionConfig controls how long stored positions are kept. Zero values disable a rule.
+type RetentionConfig struct {
+	MaxAgeDays                int `json:"max_age_days"`                // Drop records older than this
+	LatestOnlyAfterDays       int `json:"latest_only_after_days"`      // Beyond this, keep only each vessel's latest position
+	DownsampleAfterDays       int `json:"downsample_after_days"`       // Beyond this, thin tracks...
+	DownsampleIntervalMinutes int `json:"downsample_interval_minutes"` // ...to one position per interval
+	CompactIntervalMinutes    int `json:"compact_interval_minutes"`    // How often the compactor runs
+}
+
+// DedupConfig controls duplicate suppression at the ground station
+type DedupConfig struct {
+	WindowMinutes int `json:"window_minutes"` // How long a message ID is remembered; 0 disables deduplication
+	Capacity      int `json:"capacity"`       // Maximum number of message IDs remembered
+}
+
+// FleetConfig controls the staleness states of the fleet picture
+type FleetConfig struct {
+	StaleAfterSeconds int `json:"stale_after_seconds"` // A vessel without a fix for this long is stale
+	LostAfterSeconds  int `json:"lost_after_seconds"`  // A vessel without a fix for this long is lost
+}
+
+// StreamConfig controls the live position streams of the API
+type StreamConfig struct {
+	SubscriberBuffer  int `json:"subscriber_buffer"`   // Positions queued per subscriber before it misses some
+	EvictAfterSeconds int `json:"evict_after_seconds"` // A subscriber whose queue stays full for this long is disconnected
+}
+
+// FeedConfig configures the listeners for external NMEA/AIS feeds
+type FeedConfig struct {
+	TCPAddress string `json:"tcp_address"` // Empty disables the TCP listener
+	UDPAddress string `json:"udp_address"` // Empty disables the UDP listener
+}
+
+// WireConfig selects how messages are encoded between vessels, satellites and the ground station
+type WireConfig struct {
+	Codec    string      `json:"codec"`    // "binary" (default) or "json"
+	Uplink   BatchConfig `json:"uplink"`   // From vessels to satellites
+	Downlink BatchConfig `json:"downlink"` // From satellites to the ground station
+
+	TCPKeepAliveSeconds int `json:"tcp_keepalive_seconds"` // Idle time before a keepalive on TCP transport connections
+}
+
+// BatchConfig controls how the messages of a link are grouped into frames
+type BatchConfig struct {
+	MaxCount    int    `json:"max_count"`    // Messages per frame; 0 or 1 sends every message on its own
+	MaxDelayMs  int    `json:"max_delay_ms"` // Longest a message waits for its frame to fill
+	Compression string `json:"compression"`  // "none" (default), "gzip" or "deflate"
+}
+
+// RoutingConfig controls how satellites pick the route of a message
+type RoutingConfig struct {
+	WeightByLoss      bool `json:"weight_by_loss"`      // Weigh link latencies by their expected packet loss
+	HelloIntervalMs   int  `json:"hello_interval_ms"`   // Between hellos to every neighbor, 1000 by default
+	DeadIntervalMs    int  `json:"dead_interval_ms"`    // Without a hello before a neighbor is down, four hello intervals by default
+	LSARefreshSeconds int  `json:"lsa_refresh_seconds"` // Between LSAs of a satellite whose links did not change, 30 by default
+}
+
+// QueueConfig controls the store-and-forward queues satellites keep per next hop
+type QueueConfig struct {
+	Path        string `json:"path"`         // Directory of the queue logs; queues live in memory only when empty
+	MaxMessages int    `json:"max_messages"` // Per queue, 1000 by default
+	DropPolicy  string `json:"drop_policy"`  // Of a full queue: "oldest" (default) or "lowest_priority"
+	RetryMinMs  int    `json:"retry_min_ms"` // After the first failed send, 500 by default
+	RetryMaxMs  int    `json:"retry_max_ms"` // Bound of the doubling retry delay, 30000 by default
+}
+
+// AuthConfig controls the signing of position reports by vessels and their
+// verification at the ground station
+type AuthConfig struct {
+	Keys            map[string]KeyConfig `json:"keys"`             // By vessel ID, shared by the vessels and the ground station
+	Keystore        string               `json:"keystore"`         // JSON file of the keys the ground station verifies with, shaped like keys
+	SigningKeystore string               `json:"signing_keystore"` // JSON file of the keys the vessels sign with, shaped like keys
+	Require         bool                 `json:"require"`          // Also reject unsigned reports of vessels without a key
+	TrustFeeds      bool                 `json:"trust_feeds"`      // Store AIS feed reports, which carry no signatures, without verifying them
+	Quarantine      bool                 `json:"quarantine"`       // Keep rejected reports instead of dropping them
+	QuarantinePath  string               `json:"quarantine_path"`  // Log directory of the quarantine
+}
+
+// KeyConfig is the signing key of a vessel; binary values are base64
+type KeyConfig struct {
+	Algorithm  string `json:"algorithm"`             // "hmac-sha256" or "ed25519"
+	Secret     string `json:"secret,omitempty"`      // HMAC secret
+	PrivateKey string `json:"private_key,omitempty"` // Ed25519 seed, only needed to sign
+	PublicKey  string `json:"public_key,omitempty"`  // Ed25519 public key, enough to verify
+}
+
+// TLSConfig enables mutual TLS between vessels, satellites and the ground station,
+// and optionally TLS on the listeners of the API and the AIS feeds
+type TLSConfig struct {
+	Enabled bool   `json:"enabled"`
+	CA      string `json:"ca"`       // Certificate of the CA that issued the node certificates
+	CertDir string `json:"cert_dir"` // Holds <node-id>.crt and <node-id>.key of every node
+	API     bool   `json:"api"`      // Serve the API over HTTPS with the ground station's certificate
+	Feeds   bool   `json:"feeds"`    // Accept TCP feeds only over TLS from receivers with a certificate from the CA
 }
 
 // Config holds the overall configuration
 type Config struct {
 	GroundStationAddress string            `json:"ground_station_address"`
+	APIAddress           string            `json:"api_address"`
+	Storage              StorageConfig     `json:"storage"`
+	Dedup                DedupConfig       `json:"dedup"`
+	Fleet                FleetConfig       `json:"fleet"`
+	Stream               StreamConfig      `json:"stream"`
+	Feed                 FeedConfig        `json:"feed"`
+	Wire                 WireConfig        `json:"wire"`
+	Routing              RoutingConfig     `json:"routing"`
+	Queue                QueueConfig       `json:"queue"`
+	Auth                 AuthConfig        `json:"auth"`
+	TLS                  TLSConfig         `json:"tls"`
 	Satellites           []SatelliteConfig `json:"satellites"`
 	Vessels              []VesselConfig    `json:"vessels"`
 }
@@ -62,9 +207,89 @@ func ValidateConfig() error {
 	if AppConfig.GroundStationAddress == "" {
 		return fmt.Errorf("ground station address is missing")
 	}
+	if i := strings.Index(AppConfig.GroundStationAddress, "://"); i >= 0 {
+		if scheme := AppConfig.GroundStationAddress[:i]; scheme != "http" && scheme != "tcp" {
+			return fmt.Errorf("unknown ground station transport %q", scheme)
+		}
+	}
+	switch AppConfig.Storage.Backend {
+	case "", "file", "memory", "kv":
+	default:
+		return fmt.Errorf("unknown storage backend %q", AppConfig.Storage.Backend)
+	}
+	switch AppConfig.Storage.Fsync {
+	case "", "always", "batch", "none":
+	default:
+		return fmt.Errorf("unknown fsync policy %q", AppConfig.Storage.Fsync)
+	}
+	retention := AppConfig.Storage.Retention
+	if retention.MaxAgeDays < 0 || retention.LatestOnlyAfterDays < 0 || retention.DownsampleAfterDays < 0 ||
+		retention.DownsampleIntervalMinutes < 0 || retention.CompactIntervalMinutes < 0 {
+		return fmt.Errorf("retention settings must not be negative")
+	}
+	if AppConfig.Dedup.WindowMinutes < 0 || AppConfig.Dedup.Capacity < 0 {
+		return fmt.Errorf("dedup settings must not be negative")
+	}
+	if fleet := AppConfig.Fleet; fleet.StaleAfterSeconds < 0 || fleet.LostAfterSeconds < fleet.StaleAfterSeconds {
+		return fmt.Errorf("fleet lost_after_seconds must not be below stale_after_seconds")
+	}
+	if AppConfig.Stream.SubscriberBuffer < 0 || AppConfig.Stream.EvictAfterSeconds < 0 {
+		return fmt.Errorf("stream settings must not be negative")
+	}
+	switch AppConfig.Wire.Codec {
+	case "", "binary", "json":
+	default:
+		return fmt.Errorf("unknown wire codec %q", AppConfig.Wire.Codec)
+	}
+	for name, link := range map[string]BatchConfig{"uplink": AppConfig.Wire.Uplink, "downlink": AppConfig.Wire.Downlink} {
+		if link.MaxCount < 0 || link.MaxDelayMs < 0 {
+			return fmt.Errorf("wire %s settings must not be negative", name)
+		}
+		switch link.Compression {
+		case "", "none", "gzip", "deflate":
+		default:
+			return fmt.Errorf("unknown wire %s compression %q", name, link.Compression)
+		}
+	}
+	if AppConfig.Wire.TCPKeepAliveSeconds < 0 {
+		return fmt.Errorf("wire tcp_keepalive_seconds must not be negative")
+	}
+	if routing := AppConfig.Routing; routing.HelloIntervalMs < 0 || routing.DeadIntervalMs < 0 || routing.LSARefreshSeconds < 0 {
+		return fmt.Errorf("routing settings must not be negative")
+	} else if routing.DeadIntervalMs > 0 && routing.DeadIntervalMs <= routing.HelloIntervalMs {
+		return fmt.Errorf("routing dead_interval_ms must exceed hello_interval_ms")
+	}
+	if queue := AppConfig.Queue; queue.MaxMessages < 0 || queue.RetryMinMs < 0 || queue.RetryMaxMs < 0 {
+		return fmt.Errorf("queue settings must not be negative")
+	}
+	switch AppConfig.Queue.DropPolicy {
+	case "", "oldest", "lowest_priority":
+	default:
+		return fmt.Errorf("unknown queue drop_policy %q", AppConfig.Queue.DropPolicy)
+	}
+	if AppConfig.TLS.Enabled && (AppConfig.TLS.CA == "" || AppConfig.TLS.CertDir == "") {
+		return fmt.Errorf("tls ca and cert_dir are required when TLS is enabled")
+	}
+	if (AppConfig.TLS.API || AppConfig.TLS.Feeds) && !AppConfig.TLS.Enabled {
+		return fmt.Errorf("tls api and feeds need tls enabled")
+	}
+	if AppConfig.Auth.Quarantine && AppConfig.Auth.QuarantinePath == "" {
+		return fmt.Errorf("auth quarantine_path is missing")
+	}
+	if AppConfig.Auth.Keystore != "" && AppConfig.Auth.Keystore == AppConfig.Auth.SigningKeystore {
+		return fmt.Errorf("auth keystore and signing_keystore must be different files")
+	}
+	for vesselID, key := range AppConfig.Auth.Keys {
+		switch key.Algorithm {
+		case "hmac-sha256", "ed25519":
+		default:
+			return fmt.Errorf("unknown signing algorithm %q of vessel %s", key.Algorithm, vesselID)
+		}
+	}
 	if len(AppConfig.Satellites) == 0 {
 		return fmt.Errorf("no satellites configured")
 	}
+	gateways := 0
 	for _, satellite := range AppConfig.Satellites {
 		if satellite.ID == "" {
 			return fmt.Errorf("a satellite is missing an ID")
@@ -72,6 +297,20 @@ func ValidateConfig() error {
 		if satellite.Port == 0 {
 			return fmt.Errorf("satellite %s is missing a port", satellite.ID)
 		}
+		switch satellite.Transport {
+		case "", "http", "tcp":
+		default:
+			return fmt.Errorf("unknown transport %q of satellite %s", satellite.Transport, satellite.ID)
+		}
+		if link := satellite.GroundLink; link != nil {
+			if link.Latency <= 0 {
+				return fmt.Errorf("invalid latency of the ground link of satellite %s", satellite.ID)
+			}
+			if link.PacketLoss < 0 || link.PacketLoss > 1 {
+				return fmt.Errorf("invalid packet loss rate of the ground link of satellite %s", satellite.ID)
+			}
+			gateways++
+		}
 		for _, neighbor := range satellite.Neighbors {
 			if neighbor.ID == "" {
 				return fmt.Errorf("satellite %s has a neighbor with a missing ID", satellite.ID)
@@ -84,6 +323,9 @@ func ValidateConfig() error {
 			}
 		}
 	}
+	if gateways == 0 {
+		return fmt.Errorf("no satellite has a ground link")
+	}
 	if len(AppConfig.Vessels) == 0 {
 		return fmt.Errorf("no vessels configured")
 	}
@@ -94,6 +336,12 @@ func ValidateConfig() error {
 		if vessel.Satellite == "" {
 			return fmt.Errorf("vessel %s is missing an associated satellite", vessel.ID)
 		}
+		if vessel.MMSI > 999999999 {
+			return fmt.Errorf("vessel %s has an invalid MMSI %d", vessel.ID, vessel.MMSI)
+		}
+		if vessel.Length < 0 || vessel.Beam < 0 || vessel.Draught < 0 || vessel.Speed < 0 || vessel.Speed > 102 {
+			return fmt.Errorf("vessel %s has invalid dimensions or speed", vessel.ID)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,93 @@
+package export
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"project3/pkg/common"
+	"project3/pkg/groundstation"
+	"strings"
+	"time"
+)
+
+// RunCommand implements the export command line:
+//
+//	export [-config config.json] [-format geojson|kml|gpx] [-vessel ID,...] [-from T] [-to T] [-o file]
+//
+// It reads the store configured in config.json, so the ground station should
+// not be writing to it at the same time; use the API's /export endpoint then.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "configuration file naming the store")
+	formatName := flags.String("format", string(GeoJSON), "output format: geojson, kml or gpx")
+	vessels := flags.String("vessel", "", "comma-separated vessel IDs (default all)")
+	from := flags.String("from", "", "earliest position timestamp, RFC 3339")
+	to := flags.String("to", "", "latest position timestamp, RFC 3339")
+	output := flags.String("o", "", "output file (default stdout)")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	format, err := ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	var q groundstation.Query
+	for _, id := range strings.Split(*vessels, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			q.VesselIDs = append(q.VesselIDs, id)
+		}
+	}
+	if q.From, err = parseFlagTime("from", *from); err != nil {
+		return err
+	}
+	if q.To, err = parseFlagTime("to", *to); err != nil {
+		return err
+	}
+
+	// Keep stdout for the export itself
+	common.Logger.SetOutput(os.Stderr)
+	if err := common.LoadConfig(*configPath); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	store, err := groundstation.OpenStore(common.AppConfig.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %v", err)
+	}
+	defer store.Close()
+	records, err := store.Query(q)
+	if err != nil {
+		return fmt.Errorf("failed to query positions: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := Write(w, format, records); err != nil {
+		return fmt.Errorf("failed to write %s: %v", format, err)
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d positions of %d vessels to %s\n", len(records), len(Tracks(records)), *output)
+	}
+	return nil
+}
+
+func parseFlagTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s: %v", name, err)
+	}
+	return t, nil
+}
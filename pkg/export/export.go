@@ -0,0 +1,186 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is a GIS file format tracks can be exported to
+type Format string
+
+const (
+	GeoJSON Format = "geojson"
+	KML     Format = "kml"
+	GPX     Format = "gpx"
+)
+
+// ParseFormat returns the format with the given name, case insensitive
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case GeoJSON, KML, GPX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q: use geojson, kml or gpx", name)
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case GeoJSON:
+		return "application/geo+json"
+	case KML:
+		return "application/vnd.google-earth.kml+xml"
+	case GPX:
+		return "application/gpx+xml"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file name extension of the format, without the dot
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// Write exports records in the given format. Records are grouped into one track
+// per vessel, ordered by timestamp.
+func Write(w io.Writer, format Format, records []groundstation.Record) error {
+	tracks := Tracks(records)
+	switch format {
+	case GeoJSON:
+		return writeGeoJSON(w, tracks)
+	case KML:
+		return writeKML(w, tracks)
+	case GPX:
+		return writeGPX(w, tracks)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// Track is the stored positions of one vessel, oldest first
+type Track struct {
+	VesselID string
+	Records  []groundstation.Record
+}
+
+// Start returns the timestamp of the first position
+func (t Track) Start() time.Time {
+	return t.Records[0].Position.Timestamp
+}
+
+// End returns the timestamp of the last position
+func (t Track) End() time.Time {
+	return t.Records[len(t.Records)-1].Position.Timestamp
+}
+
+// Static returns the latest static data reported along the track, if any
+func (t Track) Static() *protocol.VesselInfo {
+	for i := len(t.Records) - 1; i >= 0; i-- {
+		if static := t.Records[i].Position.Static; static != nil {
+			return static
+		}
+	}
+	return nil
+}
+
+// Name labels the track with the vessel ID and, when known, the vessel's name
+func (t Track) Name() string {
+	if static := t.Static(); static != nil && static.Name != "" {
+		return t.VesselID + " " + static.Name
+	}
+	return t.VesselID
+}
+
+// Tracks groups records per vessel, sorted by vessel ID
+func Tracks(records []groundstation.Record) []Track {
+	byVessel := make(map[string][]groundstation.Record)
+	for _, rec := range records {
+		byVessel[rec.Position.VesselID] = append(byVessel[rec.Position.VesselID], rec)
+	}
+	tracks := make([]Track, 0, len(byVessel))
+	for id, recs := range byVessel {
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].Position.Timestamp.Before(recs[j].Position.Timestamp)
+		})
+		tracks = append(tracks, Track{VesselID: id, Records: recs})
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].VesselID < tracks[j].VesselID })
+	return tracks
+}
+
+// point is one vertex of an exported line
+type point struct {
+	lat, lon float64
+	time     time.Time
+}
+
+// segments returns the line of a track split where it crosses the antimeridian,
+// so that viewers do not draw it across the whole map. With interpolate, each
+// piece is extended to the crossing point at ±180°.
+func (t Track) segments(interpolate bool) [][]point {
+	var segments [][]point
+	var current []point
+	for i, rec := range t.Records {
+		p := point{lat: rec.Position.Latitude, lon: normalizeLon(rec.Position.Longitude), time: rec.Position.Timestamp}
+		if i > 0 {
+			prev := current[len(current)-1]
+			if crossing, edge, ok := antimeridianCrossing(prev, p); ok {
+				// A fix lying on the antimeridian is already the end or start of its piece
+				if interpolate && prev.lon != edge {
+					current = append(current, point{lat: crossing.lat, lon: edge, time: crossing.time})
+				}
+				segments = append(segments, current)
+				current = nil
+				if interpolate && (p.lon != -edge || p.lat != crossing.lat) {
+					current = append(current, point{lat: crossing.lat, lon: -edge, time: crossing.time})
+				}
+			}
+		}
+		current = append(current, p)
+	}
+	if len(current) > 0 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+// antimeridianCrossing reports whether the shortest path from a to b crosses the
+// antimeridian, and if so where and on which side (180 or -180) a lies
+func antimeridianCrossing(a, b point) (point, float64, bool) {
+	delta := b.lon - a.lon
+	if math.Abs(delta) <= 180 {
+		return point{}, 0, false
+	}
+	edge, unwrapped := 180.0, b.lon+360
+	if delta > 0 {
+		edge, unwrapped = -180.0, b.lon-360
+	}
+	// From 180 to -180, or back, the fixes lie on the same meridian
+	fraction := 0.0
+	if unwrapped != a.lon {
+		fraction = (edge - a.lon) / (unwrapped - a.lon)
+	}
+	crossing := point{
+		lat:  a.lat + fraction*(b.lat-a.lat),
+		lon:  edge,
+		time: a.time.Add(time.Duration(fraction * float64(b.time.Sub(a.time)))),
+	}
+	return crossing, edge, true
+}
+
+// normalizeLon maps a longitude into [-180, 180]
+func normalizeLon(lon float64) float64 {
+	if lon >= -180 && lon <= 180 {
+		return lon
+	}
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
@@ -0,0 +1,210 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var trackStart = time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+
+// fix is a position of a test track, minutes after trackStart
+type fix struct {
+	lat, lon float64
+	minutes  int
+}
+
+func testTrack(vesselID string, fixes ...fix) []groundstation.Record {
+	records := make([]groundstation.Record, len(fixes))
+	for i, f := range fixes {
+		at := trackStart.Add(time.Duration(f.minutes) * time.Minute)
+		records[i] = groundstation.Record{
+			Version:  1,
+			Envelope: groundstation.Envelope{ID: i + 1, Source: vesselID, Destination: "Ground", Priority: 1, TTL: 10},
+			Position: protocol.PositionMessage{VesselID: vesselID, Latitude: f.lat, Longitude: f.lon, Timestamp: at},
+			Receipt:  groundstation.Receipt{Satellite: "Satellite-1", Hops: 2, ReceivedAt: at.Add(time.Second)},
+		}
+	}
+	return records
+}
+
+func at(minutes float64) time.Time {
+	return trackStart.Add(time.Duration(minutes * float64(time.Minute)))
+}
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixes       []fix
+		interpolate bool
+		want        [][]point
+	}{
+		{
+			name:  "single point",
+			fixes: []fix{{10, 170, 0}},
+			want:  [][]point{{{10, 170, at(0)}}},
+		},
+		{
+			name:        "single point interpolated",
+			fixes:       []fix{{10, 170, 0}},
+			interpolate: true,
+			want:        [][]point{{{10, 170, at(0)}}},
+		},
+		{
+			name:  "no crossing",
+			fixes: []fix{{10, 170, 0}, {12, 175, 10}},
+			want:  [][]point{{{10, 170, at(0)}, {12, 175, at(10)}}},
+		},
+		{
+			name:  "eastward",
+			fixes: []fix{{10, 178, 0}, {20, -178, 10}},
+			want:  [][]point{{{10, 178, at(0)}}, {{20, -178, at(10)}}},
+		},
+		{
+			name:        "eastward interpolated",
+			fixes:       []fix{{10, 178, 0}, {20, -178, 10}},
+			interpolate: true,
+			want: [][]point{
+				{{10, 178, at(0)}, {15, 180, at(5)}},
+				{{15, -180, at(5)}, {20, -178, at(10)}},
+			},
+		},
+		{
+			name:  "westward",
+			fixes: []fix{{-10, -179, 0}, {-14, 177, 20}},
+			want:  [][]point{{{-10, -179, at(0)}}, {{-14, 177, at(20)}}},
+		},
+		{
+			name:        "westward interpolated",
+			fixes:       []fix{{-10, -179, 0}, {-14, 177, 20}},
+			interpolate: true,
+			want: [][]point{
+				{{-10, -179, at(0)}, {-11, -180, at(5)}},
+				{{-11, 180, at(5)}, {-14, 177, at(20)}},
+			},
+		},
+		{
+			name:        "leaving from 180",
+			fixes:       []fix{{10, 179, 0}, {10, 180, 10}, {12, -179, 20}},
+			interpolate: true,
+			want: [][]point{
+				{{10, 179, at(0)}, {10, 180, at(10)}},
+				{{10, -180, at(10)}, {12, -179, at(20)}},
+			},
+		},
+		{
+			name:        "arriving at -180",
+			fixes:       []fix{{10, 179, 0}, {12, -180, 10}, {14, -179, 20}},
+			interpolate: true,
+			want: [][]point{
+				{{10, 179, at(0)}, {12, 180, at(10)}},
+				{{12, -180, at(10)}, {14, -179, at(20)}},
+			},
+		},
+		{
+			name:        "from 180 to -180",
+			fixes:       []fix{{10, 180, 0}, {12, -180, 10}},
+			interpolate: true,
+			want: [][]point{
+				{{10, 180, at(0)}},
+				{{10, -180, at(0)}, {12, -180, at(10)}},
+			},
+		},
+		{
+			name:  "from 180 to -180 not interpolated",
+			fixes: []fix{{10, 180, 0}, {12, -180, 10}},
+			want:  [][]point{{{10, 180, at(0)}}, {{12, -180, at(10)}}},
+		},
+		{
+			name:  "unnormalized longitude",
+			fixes: []fix{{10, 179, 0}, {10, 181, 10}},
+			want:  [][]point{{{10, 179, at(0)}}, {{10, -179, at(10)}}},
+		},
+		{
+			name:        "there and back",
+			fixes:       []fix{{0, 179, 0}, {0, -179, 10}, {0, 179, 20}},
+			interpolate: true,
+			want: [][]point{
+				{{0, 179, at(0)}, {0, 180, at(5)}},
+				{{0, -180, at(5)}, {0, -179, at(10)}, {0, -180, at(15)}},
+				{{0, 180, at(15)}, {0, 179, at(20)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := Tracks(testTrack("244660000", tt.fixes...))[0]
+			got := track.segments(tt.interpolate)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments(%v) = %v, want %v", tt.interpolate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracksGroupsAndSortsRecords(t *testing.T) {
+	records := append(testTrack("B", fix{1, 1, 5}, fix{0, 0, 0}), testTrack("A", fix{2, 2, 0})...)
+	tracks := Tracks(records)
+	if len(tracks) != 2 || tracks[0].VesselID != "A" || tracks[1].VesselID != "B" {
+		t.Fatalf("tracks = %+v, want A then B", tracks)
+	}
+	if start, end := tracks[1].Start(), tracks[1].End(); !start.Equal(at(0)) || !end.Equal(at(5)) {
+		t.Errorf("track B runs from %v to %v, want %v to %v", start, end, at(0), at(5))
+	}
+}
+
+// exportRecords is a named vessel crossing the antimeridian eastward, a vessel
+// that stays on one side and a vessel with a single fix
+func exportRecords() []groundstation.Record {
+	crossing := testTrack("244660000", fix{10, 178, 0}, fix{15, -178, 10}, fix{16, -177, 20})
+	crossing[2].Position.Static = &protocol.VesselInfo{Name: "NORTHERN LIGHT"}
+	sog, cog, heading := 12.5, 90.0, 91
+	crossing[1].Position.Navigation = &protocol.Navigation{SpeedOverGround: &sog, CourseOverGround: &cog, Heading: &heading}
+	records := append(crossing, testTrack("366999000", fix{50, -4, 0}, fix{50.5, -4.5, 30})...)
+	records = append(records, testTrack("538000000", fix{-33.9, 18.4, 0})...)
+	records[len(records)-1].Receipt = groundstation.Receipt{Feed: "tcp 127.0.0.1:40112", ReceivedAt: at(0)}
+	return records
+}
+
+func TestWriteGolden(t *testing.T) {
+	for _, format := range []Format{GeoJSON, KML, GPX} {
+		t.Run(string(format), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, format, exportRecords()); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "tracks."+format.Extension())
+			if *update {
+				if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("%s output differs from %s:\n%s", format, golden, out.String())
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"geojson": GeoJSON, "KML": KML, "Gpx": GPX} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("shp"); err == nil {
+		t.Error("ParseFormat accepted an unknown format")
+	}
+}
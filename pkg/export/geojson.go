@@ -0,0 +1,97 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"project3/pkg/groundstation"
+	"time"
+)
+
+// RFC 7946 types
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Geometry   geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// writeGeoJSON writes a FeatureCollection with a line per vessel followed by its
+// positions as points. Lines crossing the antimeridian become MultiLineStrings.
+func writeGeoJSON(w io.Writer, tracks []Track) error {
+	collection := featureCollection{Type: "FeatureCollection", Features: []feature{}}
+	for _, track := range tracks {
+		if len(track.Records) > 1 {
+			collection.Features = append(collection.Features, lineFeature(track))
+		}
+		for _, rec := range track.Records {
+			collection.Features = append(collection.Features, feature{
+				Type: "Feature",
+				Geometry: geometry{
+					Type:        "Point",
+					Coordinates: []float64{normalizeLon(rec.Position.Longitude), rec.Position.Latitude},
+				},
+				Properties: pointProperties(track, rec),
+			})
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(collection)
+}
+
+func pointProperties(track Track, rec groundstation.Record) map[string]interface{} {
+	properties := map[string]interface{}{
+		"vesselID":   track.VesselID,
+		"timestamp":  rec.Position.Timestamp.Format(time.RFC3339Nano),
+		"messageID":  rec.Envelope.ID,
+		"priority":   rec.Envelope.Priority,
+		"satellite":  rec.Receipt.Satellite,
+		"hops":       rec.Receipt.Hops,
+		"receivedAt": rec.Receipt.ReceivedAt.Format(time.RFC3339Nano),
+	}
+	if feed := rec.Receipt.Feed; feed != "" {
+		properties["feed"] = feed
+	}
+	if nav := rec.Position.Navigation; nav != nil {
+		properties["navigation"] = nav
+	}
+	return properties
+}
+
+func lineFeature(track Track) feature {
+	var lines [][][]float64
+	for _, segment := range track.segments(true) {
+		line := make([][]float64, len(segment))
+		for i, p := range segment {
+			line[i] = []float64{p.lon, p.lat}
+		}
+		lines = append(lines, line)
+	}
+	geom := geometry{Type: "MultiLineString", Coordinates: lines}
+	if len(lines) == 1 {
+		geom = geometry{Type: "LineString", Coordinates: lines[0]}
+	}
+	line := feature{
+		Type:     "Feature",
+		Geometry: geom,
+		Properties: map[string]interface{}{
+			"vesselID":  track.VesselID,
+			"start":     track.Start().Format(time.RFC3339Nano),
+			"end":       track.End().Format(time.RFC3339Nano),
+			"positions": len(track.Records),
+		},
+	}
+	if static := track.Static(); static != nil {
+		line.Properties["static"] = static
+	}
+	return line
+}
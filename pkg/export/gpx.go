@@ -0,0 +1,49 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// GPX 1.1 elements
+type gpxDocument struct {
+	XMLName xml.Name   `xml:"gpx"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	Tracks  []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+}
+
+// writeGPX writes a track per vessel. A track crossing the antimeridian is split
+// into segments; GPX holds recorded fixes only, so no crossing points are added.
+func writeGPX(w io.Writer, tracks []Track) error {
+	doc := gpxDocument{XMLNS: "http://www.topografix.com/GPX/1/1", Version: "1.1", Creator: "MaritimeNavigator"}
+	for _, track := range tracks {
+		trk := gpxTrack{Name: track.Name()}
+		for _, segment := range track.segments(false) {
+			var seg gpxSegment
+			for _, p := range segment {
+				seg.Points = append(seg.Points, gpxPoint{Lat: p.lat, Lon: p.lon, Time: p.time.UTC().Format(time.RFC3339Nano)})
+			}
+			trk.Segments = append(trk.Segments, seg)
+		}
+		doc.Tracks = append(doc.Tracks, trk)
+	}
+	return writeXML(w, doc)
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"project3/pkg/groundstation"
+	"strings"
+	"time"
+)
+
+// KML 2.2 elements
+type kmlDocument struct {
+	XMLName xml.Name    `xml:"kml"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Name    string      `xml:"Document>name"`
+	Folders []kmlFolder `xml:"Document>Folder"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name          string        `xml:"name"`
+	Description   string        `xml:"description,omitempty"`
+	TimeSpan      *kmlTimeSpan  `xml:"TimeSpan,omitempty"`
+	TimeStamp     *kmlTimeStamp `xml:"TimeStamp,omitempty"`
+	Point         *kmlPoint     `xml:"Point,omitempty"`
+	MultiGeometry *kmlMultiLine `xml:"MultiGeometry,omitempty"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlMultiLine struct {
+	LineStrings []kmlLineString `xml:"LineString"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// writeKML writes a folder per vessel holding its track, with the time span it
+// covers, and its time-stamped positions so that Google Earth can animate them
+func writeKML(w io.Writer, tracks []Track) error {
+	doc := kmlDocument{XMLNS: "http://www.opengis.net/kml/2.2", Name: "MaritimeNavigator tracks"}
+	for _, track := range tracks {
+		folder := kmlFolder{Name: track.Name()}
+		if len(track.Records) > 1 {
+			line := &kmlMultiLine{}
+			for _, segment := range track.segments(true) {
+				coords := make([]string, len(segment))
+				for i, p := range segment {
+					coords[i] = kmlCoordinates(p.lat, p.lon)
+				}
+				line.LineStrings = append(line.LineStrings, kmlLineString{Tessellate: 1, Coordinates: strings.Join(coords, " ")})
+			}
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name:          track.Name() + " track",
+				TimeSpan:      &kmlTimeSpan{Begin: kmlTime(track.Start()), End: kmlTime(track.End())},
+				MultiGeometry: line,
+			})
+		}
+		for _, rec := range track.Records {
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name:        kmlTime(rec.Position.Timestamp),
+				Description: kmlDescription(rec),
+				TimeStamp:   &kmlTimeStamp{When: kmlTime(rec.Position.Timestamp)},
+				Point:       &kmlPoint{Coordinates: kmlCoordinates(rec.Position.Latitude, normalizeLon(rec.Position.Longitude))},
+			})
+		}
+		doc.Folders = append(doc.Folders, folder)
+	}
+	return writeXML(w, doc)
+}
+
+func kmlDescription(rec groundstation.Record) string {
+	description := fmt.Sprintf("Message %d, priority %d, %d hops", rec.Envelope.ID, rec.Envelope.Priority, rec.Receipt.Hops)
+	if nav := rec.Position.Navigation; nav != nil {
+		description += "; " + nav.String()
+	}
+	return description
+}
+
+func kmlCoordinates(lat, lon float64) string {
+	return fmt.Sprintf("%g,%g", lon, lat)
+}
+
+func kmlTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeXML writes an indented XML document with its declaration
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,136 @@
+package feed
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"project3/pkg/common"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"project3/pkg/transport"
+	"strings"
+	"time"
+)
+
+// RunCommand implements the replay command line:
+//
+//	replay [-to tcp://127.0.0.1:10110] [-interval 1s] [-loop] [-config config.json] [-node Feed] file.nmea
+//
+// It sends a recorded feed to a feed listener as an AIS receiver would,
+// pausing after each complete message. A tls:// listener is dialed with the
+// certificate of the node in tls.cert_dir of the configuration.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	to := flags.String("to", "tcp://127.0.0.1:10110", "feed listener, tcp://host:port, tls://host:port or udp://host:port")
+	configPath := flags.String("config", "config.json", "configuration with the TLS settings, for tls://")
+	node := flags.String("node", "Feed", "node whose certificate is presented, for tls://")
+	interval := flags.Duration("interval", time.Second, "pause between messages")
+	loop := flags.Bool("loop", false, "start over at the end of the file")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-to tcp://host:port] [-interval 1s] [-loop] [-config config.json] [-node Feed] file.nmea")
+	}
+	network, address, err := parseTarget(*to)
+	if err != nil {
+		return err
+	}
+	messages, err := readMessages(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("%s holds no sentences", flags.Arg(0))
+	}
+
+	conn, err := dial(network, address, *configPath, *node)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		for _, sentences := range messages {
+			// One write per message, so that UDP sends it as one datagram
+			if _, err := conn.Write([]byte(strings.Join(sentences, "\r\n") + "\r\n")); err != nil {
+				return err
+			}
+			time.Sleep(*interval)
+		}
+		fmt.Fprintf(os.Stderr, "Replayed %d messages to %s\n", len(messages), *to)
+		if !*loop {
+			return nil
+		}
+	}
+}
+
+func parseTarget(target string) (network, address string, err error) {
+	for _, network := range []string{"tcp", "tls", "udp"} {
+		if strings.HasPrefix(target, network+"://") {
+			return network, strings.TrimPrefix(target, network+"://"), nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid -to %q: want tcp://host:port, tls://host:port or udp://host:port", target)
+}
+
+// dial connects to a feed listener. Over TLS, the listener must present the
+// ground station's certificate.
+func dial(network, address, configPath, node string) (net.Conn, error) {
+	if network != "tls" {
+		return net.Dial(network, address)
+	}
+	if err := common.LoadConfig(configPath); err != nil {
+		return nil, err
+	}
+	if !common.AppConfig.TLS.Enabled {
+		return nil, fmt.Errorf("tls:// needs tls enabled in %s", configPath)
+	}
+	security, err := transport.LoadSecurity(common.AppConfig.TLS.CA, common.AppConfig.TLS.CertDir)
+	if err != nil {
+		return nil, err
+	}
+	security.ExpectServer(address, groundstation.NodeID)
+	config, err := security.ClientConfig(node, address)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Dial("tcp", address, config)
+}
+
+// readMessages reads the sentences of a file, grouping the sentences of
+// multi-sentence AIS messages. Other lines are passed through one by one.
+func readMessages(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages [][]string
+	var current []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, maxLineLength), maxLineLength)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		current = append(current, line)
+		if sentence, err := protocol.ParseSentence(line); err == nil {
+			if fragment, err := protocol.ParseFragment(sentence); err == nil && fragment.Number < fragment.Count {
+				continue
+			}
+		}
+		messages = append(messages, current)
+		current = nil
+	}
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+	return messages, scanner.Err()
+}
@@ -0,0 +1,316 @@
+package feed
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"project3/pkg/common"
+	"project3/pkg/groundstation"
+	"project3/pkg/protocol"
+	"project3/pkg/satellite"
+	"project3/pkg/transport"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of the feed listeners
+const (
+	maxLineLength    = 1024             // Longer lines are not NMEA and end a TCP connection
+	maxDatagramSize  = 64 * 1024        // Largest UDP datagram read
+	maxVessels       = 100000           // Vessels whose static data is remembered
+	handshakeTimeout = 10 * time.Second // For a TLS handshake to complete
+)
+
+// Stats counts what the feeds of a listener delivered
+type Stats struct {
+	Connections uint64 `json:"connections"` // TCP connections accepted
+	Sentences   uint64 `json:"sentences"`   // Lines read
+	Positions   uint64 `json:"positions"`   // Positions ingested
+	Static      uint64 `json:"static"`      // Static data messages, attached to the vessel's next position
+	Duplicates  uint64 `json:"duplicates"`  // Positions already received, e.g. from another receiver
+	Skipped     uint64 `json:"skipped"`     // Valid messages carrying no position
+	Rejected    uint64 `json:"rejected"`    // Positions failing authentication, see auth.trust_feeds
+	Errors      uint64 `json:"errors"`      // Invalid sentences and ingest failures
+}
+
+// outcome is what became of one line
+type outcome int
+
+const (
+	pending   outcome = iota // Part of a message not yet complete
+	ingested                 // A position was stored
+	static                   // Static data was remembered
+	duplicate                // A position already received
+	skipped                  // A valid message carrying no position
+	rejected                 // A position failing authentication
+	invalid                  // An invalid sentence or a failed ingest
+)
+
+// count adds the outcome of a line to s
+func (s *Stats) count(o outcome) {
+	atomic.AddUint64(&s.Sentences, 1)
+	switch o {
+	case ingested:
+		atomic.AddUint64(&s.Positions, 1)
+	case static:
+		atomic.AddUint64(&s.Static, 1)
+	case duplicate:
+		atomic.AddUint64(&s.Duplicates, 1)
+	case skipped:
+		atomic.AddUint64(&s.Skipped, 1)
+	case rejected:
+		atomic.AddUint64(&s.Rejected, 1)
+	case invalid:
+		atomic.AddUint64(&s.Errors, 1)
+	}
+}
+
+// Listener reads newline-delimited NMEA sentences from AIS feeds and injects
+// the positions they carry into the ground station, like relayed messages
+type Listener struct {
+	station *groundstation.Server
+	stats   Stats // Updated atomically
+
+	mu      sync.Mutex
+	vessels map[uint32]*vesselStatic // By MMSI
+}
+
+// vesselStatic is the static data heard from a vessel
+type vesselStatic struct {
+	info    protocol.VesselInfo
+	pending bool // Changed since a position last carried it
+}
+
+// NewListener creates a listener ingesting into station
+func NewListener(station *groundstation.Server) *Listener {
+	return &Listener{station: station, vessels: make(map[uint32]*vesselStatic)}
+}
+
+// Stats returns a snapshot of the listener's counters
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Connections: atomic.LoadUint64(&l.stats.Connections),
+		Sentences:   atomic.LoadUint64(&l.stats.Sentences),
+		Positions:   atomic.LoadUint64(&l.stats.Positions),
+		Static:      atomic.LoadUint64(&l.stats.Static),
+		Duplicates:  atomic.LoadUint64(&l.stats.Duplicates),
+		Skipped:     atomic.LoadUint64(&l.stats.Skipped),
+		Rejected:    atomic.LoadUint64(&l.stats.Rejected),
+		Errors:      atomic.LoadUint64(&l.stats.Errors),
+	}
+}
+
+// ListenTCP accepts feed connections on address, such as an AIS receiver or
+// aggregator pushing sentences. With a TLS configuration, connections must
+// complete its handshake first. It returns once the listener is open.
+func (l *Listener) ListenTCP(address string, config *tls.Config) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+		common.Logger.Printf("NMEA feed TCP listener started at %s over TLS\n", ln.Addr())
+	} else {
+		common.Logger.Printf("NMEA feed TCP listener started at %s\n", ln.Addr())
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				common.Logger.Printf("NMEA feed TCP listener stopped: %v\n", err)
+				return
+			}
+			atomic.AddUint64(&l.stats.Connections, 1)
+			go l.serveConn(conn)
+		}
+	}()
+	return nil
+}
+
+func (l *Listener) serveConn(conn net.Conn) {
+	defer conn.Close()
+	peer := transport.Peer{Addr: conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Named after the receiver's certificate, which the handshake checks
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			common.Logger.Printf("NMEA feed handshake with %s failed: %v\n", peer, err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+		state := tlsConn.ConnectionState()
+		if len(state.PeerCertificates) > 0 {
+			peer.ID = state.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	source := "tcp " + peer.String()
+	common.Logger.Printf("NMEA feed connected: %s\n", source)
+	stats, err := l.Read(conn, source)
+	if err != nil {
+		common.Logger.Printf("NMEA feed %s failed: %v\n", source, err)
+	}
+	common.Logger.Printf("NMEA feed disconnected: %s after %d sentences, %d positions, %d duplicates, %d rejected, %d errors\n",
+		source, stats.Sentences, stats.Positions, stats.Duplicates, stats.Rejected, stats.Errors)
+}
+
+// ListenUDP receives datagrams of one or more sentences on address. It returns
+// once the socket is open.
+func (l *Listener) ListenUDP(address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	common.Logger.Printf("NMEA feed UDP listener started at %s\n", conn.LocalAddr())
+	go func() {
+		defer conn.Close()
+		// Senders share one decoder: multi-sentence messages are told apart by
+		// sequence ID and channel only
+		decoder := protocol.NewAISDecoder()
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				common.Logger.Printf("NMEA feed UDP listener stopped: %v\n", err)
+				return
+			}
+			source := "udp " + addr.String()
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					l.stats.count(l.handleLine(decoder, line, source))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Read ingests the sentences read from r until it ends, tagging them with
+// source, and returns what they delivered. Besides the network listeners it
+// serves to replay a recorded feed.
+func (l *Listener) Read(r io.Reader, source string) (Stats, error) {
+	var stats Stats
+	decoder := protocol.NewAISDecoder()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, maxLineLength), maxLineLength)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		o := l.handleLine(decoder, line, source)
+		stats.count(o)
+		l.stats.count(o)
+	}
+	return stats, scanner.Err()
+}
+
+func (l *Listener) handleLine(decoder *protocol.AISDecoder, line, source string) outcome {
+	receivedAt := time.Now().UTC()
+	msg, payload, err := decoder.DecodePayload(line, receivedAt)
+	switch {
+	case errors.Is(err, protocol.ErrNotAIS) || errors.Is(err, protocol.ErrUnsupportedAISType):
+		return skipped
+	case err != nil:
+		common.Logger.Printf("Invalid sentence from %s: %v\n", source, err)
+		return invalid
+	case msg == nil:
+		return pending // Waiting for the remaining sentences of the message
+	}
+
+	carriesStatic := l.updateStatic(msg)
+	report, ok := msg.(protocol.PositionSource)
+	if !ok {
+		if carriesStatic {
+			return static
+		}
+		return skipped
+	}
+	pos, ok := report.Position(receivedAt)
+	if !ok {
+		return skipped
+	}
+	pos.Static = l.takeStatic(pos.MMSI)
+
+	err = l.station.IngestFeed(message(pos, payload), source, receivedAt)
+	if err != nil && pos.Static != nil {
+		l.restoreStatic(pos.MMSI) // Not stored, so let the next position carry it
+	}
+	switch {
+	case err == groundstation.ErrDuplicate:
+		return duplicate
+	case errors.Is(err, groundstation.ErrUnauthenticated):
+		return rejected
+	case err != nil:
+		common.Logger.Printf("Failed to store position from %s: %v\n", source, err)
+		return invalid
+	}
+	return ingested
+}
+
+// updateStatic remembers the static data of a message and reports whether it had any
+func (l *Listener) updateStatic(msg protocol.AISMessage) bool {
+	switch msg.(type) {
+	case protocol.StaticVoyageData, protocol.StaticDataReport, protocol.ExtendedClassBPositionReport:
+	default:
+		return false
+	}
+	mmsi := msg.Header().MMSI
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	vessel, exists := l.vessels[mmsi]
+	if !exists {
+		if len(l.vessels) >= maxVessels {
+			for evicted := range l.vessels {
+				delete(l.vessels, evicted)
+				break
+			}
+		}
+		vessel = &vesselStatic{}
+		l.vessels[mmsi] = vessel
+	}
+	if vessel.info.Update(msg) {
+		vessel.pending = true
+	}
+	return true
+}
+
+// takeStatic returns the static data of a vessel if it changed since last taken
+func (l *Listener) takeStatic(mmsi uint32) *protocol.VesselInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	vessel, exists := l.vessels[mmsi]
+	if !exists || !vessel.pending {
+		return nil
+	}
+	vessel.pending = false
+	info := vessel.info
+	return &info
+}
+
+func (l *Listener) restoreStatic(mmsi uint32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if vessel, exists := l.vessels[mmsi]; exists {
+		vessel.pending = true
+	}
+}
+
+// message wraps a decoded position as if a satellite had relayed it. AIS
+// messages carry no ID, so the checksum of the armored payload stands in for
+// one: the same report heard by several receivers is stored once, whatever the
+// tag blocks, channels and sequence IDs of their sentences.
+func message(pos protocol.PositionMessage, payload string) satellite.Message {
+	return satellite.Message{
+		ID:          int(crc32.ChecksumIEEE([]byte(payload))),
+		Source:      pos.VesselID,
+		Destination: "GroundStation",
+		Content:     pos,
+	}
+}
@@ -0,0 +1,150 @@
+package feed
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"project3/pkg/certs"
+	"project3/pkg/groundstation"
+	"project3/pkg/transport"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testdata/replay.nmea is a recorded feed holding, in order: static voyage data
+// over two sentences; a position of that vessel; the same position as heard by
+// a second receiver; two positions split over two sentences each, differing in
+// their first sentence only; a blank line; static data of a class B vessel; a
+// GPS fix; a sentence with a bad checksum and the position it was meant to be
+func TestReplayRecordedFeed(t *testing.T) {
+	file, err := os.Open("testdata/replay.nmea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	station := groundstation.NewServer(groundstation.NewMemoryStore())
+	station.SetDeduplicator(groundstation.NewDeduplicator(100, time.Hour))
+	listener := NewListener(station)
+	stats, err := listener.Read(file, "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{Sentences: 12, Positions: 4, Static: 2, Duplicates: 1, Skipped: 1, Errors: 1}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	if total := listener.Stats(); total != want {
+		t.Errorf("listener stats %+v, want %+v", total, want)
+	}
+
+	var records []groundstation.Record
+	station.Store().Scan(func(rec groundstation.Record) bool {
+		records = append(records, rec)
+		return true
+	})
+	if len(records) != 4 {
+		t.Fatalf("stored %d records, want 4", len(records))
+	}
+	for _, rec := range records {
+		if rec.Receipt.Feed != "replay" {
+			t.Errorf("record of %s from feed %q, want replay", rec.Position.VesselID, rec.Receipt.Feed)
+		}
+	}
+	if static := records[0].Position.Static; static == nil || static.Name == "" {
+		t.Errorf("first position carries static data %+v, want the vessel's name", static)
+	}
+	if records[3].Position.VesselID != records[0].Position.VesselID || records[3].Position.Static != nil {
+		t.Errorf("later position %+v, want the same vessel without unchanged static data", records[3].Position)
+	}
+	if records[1].Envelope.ID == records[2].Envelope.ID {
+		t.Errorf("positions ending in the same sentence share ID %d", records[1].Envelope.ID)
+	}
+}
+
+func TestMessageIDIgnoresReceiver(t *testing.T) {
+	station := groundstation.NewServer(groundstation.NewMemoryStore())
+	station.SetDeduplicator(groundstation.NewDeduplicator(100, time.Hour))
+	listener := NewListener(station)
+
+	// One report split differently by two receivers, on different channels
+	stats, err := listener.Read(strings.NewReader(strings.Join([]string{
+		"!AIVDM,1,1,,A,15RTgt0PAso;90TKcjM8h6g208CQ,0*4A",
+		"!AIVDM,2,1,7,B,15RTgt0PAso;90TK,0*10",
+		"!AIVDM,2,2,7,B,cjM8h6g208CQ,0*7F",
+	}, "\n")), "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Positions != 1 || stats.Duplicates != 1 {
+		t.Errorf("stats %+v, want one position and one duplicate", stats)
+	}
+}
+
+func TestTLSFeedNamesReceiver(t *testing.T) {
+	dir := t.TempDir()
+	authority, _, err := certs.LoadOrCreateAuthority(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []string{groundstation.NodeID, "Receiver-1"} {
+		if err := authority.Issue(dir, node, []string{"127.0.0.1"}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	security, err := transport.LoadSecurity(filepath.Join(dir, "ca.crt"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := security.ServerConfig(groundstation.NodeID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A free port for the listener
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := probe.Addr().String()
+	probe.Close()
+
+	station := groundstation.NewServer(groundstation.NewMemoryStore())
+	listener := NewListener(station)
+	if err := listener.ListenTCP(address, config); err != nil {
+		t.Fatal(err)
+	}
+	sentence := "!AIVDM,1,1,,A,15RTgt0PAso;90TKcjM8h6g208CQ,0*4A\r\n"
+
+	// Plaintext never gets past the handshake
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.Write([]byte(sentence))
+		conn.Close()
+	}
+
+	security.ExpectServer(address, groundstation.NodeID)
+	client, err := security.ClientConfig("Receiver-1", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", address, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(sentence))
+	conn.Close()
+
+	var records []groundstation.Record
+	for deadline := time.Now().Add(5 * time.Second); len(records) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		records, _ = station.Store().Range(time.Time{}, time.Now().Add(time.Hour))
+	}
+	if len(records) != 1 || !strings.HasPrefix(records[0].Receipt.Feed, "tcp Receiver-1 (127.0.0.1:") {
+		t.Fatalf("stored %+v, want one position from Receiver-1", records)
+	}
+	if stats := listener.Stats(); stats.Connections != 2 || stats.Sentences != 1 {
+		t.Errorf("stats %+v, want two connections and the sentence sent over TLS only", stats)
+	}
+}
@@ -0,0 +1,192 @@
+package groundstation
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Default limits of live subscriptions
+const (
+	DefaultSubscriberBuffer = 256
+	DefaultEvictAfter       = 10 * time.Second
+)
+
+// ErrSlowConsumer is the reason a subscription is closed when its subscriber
+// did not keep up with the published records
+var ErrSlowConsumer = errors.New("subscriber too slow, evicted")
+
+// ErrBusClosed is the reason subscriptions are closed when the bus shuts down
+var ErrBusClosed = errors.New("bus closed")
+
+// BusStats reports the activity of the bus
+type BusStats struct {
+	Subscribers int    `json:"subscribers"`
+	Published   uint64 `json:"published"`
+	Delivered   uint64 `json:"delivered"`
+	Dropped     uint64 `json:"dropped"` // Records skipped because a subscriber's buffer was full
+	Evicted     uint64 `json:"evicted"`
+}
+
+// Bus fans ingested records out to live subscribers. Publishing never blocks:
+// a subscriber whose buffer is full misses records, and one whose buffer stays
+// full for longer than the eviction grace period is dropped.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	buffer      int
+	evictAfter  time.Duration
+	closed      bool
+	published   uint64
+	delivered   uint64
+	dropped     uint64
+	evicted     uint64
+}
+
+// NewBus creates a bus with the default subscriber limits
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]struct{}),
+		buffer:      DefaultSubscriberBuffer,
+		evictAfter:  DefaultEvictAfter,
+	}
+}
+
+// SetLimits changes the buffer size of new subscriptions and how long a
+// subscriber may stay behind before it is evicted
+func (b *Bus) SetLimits(buffer int, evictAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffer = buffer
+	b.evictAfter = evictAfter
+}
+
+// Subscribe registers a subscriber to the records matching filter. Only the
+// filters of the query apply; paging fields are ignored.
+func (b *Bus) Subscribe(filter Query) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := &Subscription{
+		bus:     b,
+		filter:  filter,
+		records: make(chan Record, b.buffer),
+		done:    make(chan struct{}),
+	}
+	if b.closed {
+		sub.close(ErrBusClosed)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers rec to every subscriber whose filter matches it
+func (b *Bus) Publish(rec Record) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published++
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(rec) {
+			continue
+		}
+		select {
+		case sub.records <- rec:
+			sub.laggingSince = time.Time{}
+			b.delivered++
+			continue
+		default:
+		}
+
+		// The subscriber is not keeping up
+		b.dropped++
+		sub.dropped++
+		if sub.laggingSince.IsZero() {
+			sub.laggingSince = now
+		}
+		if now.Sub(sub.laggingSince) >= b.evictAfter {
+			delete(b.subscribers, sub)
+			b.evicted++
+			sub.close(ErrSlowConsumer)
+		}
+	}
+}
+
+// Stats returns a snapshot of the counters
+func (b *Bus) Stats() BusStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BusStats{
+		Subscribers: len(b.subscribers),
+		Published:   b.published,
+		Delivered:   b.delivered,
+		Dropped:     b.dropped,
+		Evicted:     b.evicted,
+	}
+}
+
+// Close ends every subscription and rejects new ones
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		sub.close(ErrBusClosed)
+	}
+}
+
+// Subscription is one subscriber of the bus
+type Subscription struct {
+	bus     *Bus
+	filter  Query
+	records chan Record
+	done    chan struct{}
+
+	// Guarded by the bus lock
+	laggingSince time.Time
+	dropped      uint64
+	err          error
+}
+
+// Records returns the channel delivering matching records. It is not closed;
+// wait on Done as well.
+func (s *Subscription) Records() <-chan Record {
+	return s.records
+}
+
+// Done is closed when the subscription ends
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription ended, or nil while it is active or after
+// the subscriber closed it
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// Dropped returns how many matching records the subscriber missed
+func (s *Subscription) Dropped() uint64 {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, active := s.bus.subscribers[s]; active {
+		delete(s.bus.subscribers, s)
+		s.close(nil)
+	}
+}
+
+// close ends the subscription; the bus lock must be held
+func (s *Subscription) close(err error) {
+	s.err = err
+	close(s.done)
+}
@@ -0,0 +1,134 @@
+package groundstation
+
+import (
+	"testing"
+	"time"
+)
+
+// receivedIDs takes the records waiting in a subscription
+func receivedIDs(sub *Subscription) []int {
+	var ids []int
+	for {
+		select {
+		case rec := <-sub.Records():
+			ids = append(ids, rec.Envelope.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func ended(sub *Subscription) bool {
+	select {
+	case <-sub.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBusDropsRecordsForFullBuffer(t *testing.T) {
+	bus := NewBus()
+	bus.SetLimits(2, time.Hour)
+	sub := bus.Subscribe(Query{})
+	for i := 1; i <= 5; i++ {
+		bus.Publish(testRecord("Vessel-1", i, i))
+	}
+
+	if ids := receivedIDs(sub); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("received %v, want the first 2 records", ids)
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("subscriber dropped %d records, want 3", sub.Dropped())
+	}
+	stats := bus.Stats()
+	if stats.Published != 5 || stats.Delivered != 2 || stats.Dropped != 3 || stats.Evicted != 0 || stats.Subscribers != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+	if ended(sub) {
+		t.Errorf("subscriber evicted within the grace period: %v", sub.Err())
+	}
+}
+
+func TestBusEvictsSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	bus.SetLimits(1, 20*time.Millisecond)
+	slow := bus.Subscribe(Query{})
+	other := bus.Subscribe(Query{VesselIDs: []string{"Vessel-2"}})
+
+	bus.Publish(testRecord("Vessel-1", 1, 0))
+	bus.Publish(testRecord("Vessel-1", 2, 1)) // Buffer full: lagging from now
+	if ended(slow) {
+		t.Fatal("evicted on the first dropped record")
+	}
+	time.Sleep(30 * time.Millisecond)
+	bus.Publish(testRecord("Vessel-1", 3, 2))
+
+	if !ended(slow) || slow.Err() != ErrSlowConsumer {
+		t.Fatalf("slow subscriber still active or ended with %v, want %v", slow.Err(), ErrSlowConsumer)
+	}
+	if ended(other) {
+		t.Error("subscriber to other records evicted too")
+	}
+	stats := bus.Stats()
+	if stats.Evicted != 1 || stats.Subscribers != 1 || stats.Dropped != 2 {
+		t.Errorf("stats %+v, want 1 evicted, 1 subscriber left and 2 dropped", stats)
+	}
+
+	// Later records go to the remaining subscriber only
+	bus.Publish(testRecord("Vessel-2", 4, 3))
+	if ids := receivedIDs(other); len(ids) != 1 || ids[0] != 4 {
+		t.Errorf("other subscriber received %v, want [4]", ids)
+	}
+}
+
+func TestBusKeepsSubscriberThatCatchesUp(t *testing.T) {
+	bus := NewBus()
+	bus.SetLimits(1, 20*time.Millisecond)
+	sub := bus.Subscribe(Query{})
+
+	bus.Publish(testRecord("Vessel-1", 1, 0))
+	bus.Publish(testRecord("Vessel-1", 2, 1)) // Dropped: lagging
+	time.Sleep(30 * time.Millisecond)
+	receivedIDs(sub)
+	bus.Publish(testRecord("Vessel-1", 3, 2)) // Delivered: caught up
+	bus.Publish(testRecord("Vessel-1", 4, 3)) // Dropped: lagging again, from now
+
+	if ended(sub) {
+		t.Fatalf("subscriber that caught up was evicted: %v", sub.Err())
+	}
+	if ids := receivedIDs(sub); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("received %v, want [3]", ids)
+	}
+	if sub.Dropped() != 2 {
+		t.Errorf("subscriber dropped %d records, want 2", sub.Dropped())
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus()
+	left := bus.Subscribe(Query{})
+	sub := bus.Subscribe(Query{})
+	left.Close()
+	if !ended(left) || left.Err() != nil {
+		t.Errorf("unsubscribed: ended %v with %v, want ended without error", ended(left), left.Err())
+	}
+
+	bus.Close()
+	if !ended(sub) || sub.Err() != ErrBusClosed {
+		t.Errorf("subscriber ended %v with %v, want %v", ended(sub), sub.Err(), ErrBusClosed)
+	}
+	if stats := bus.Stats(); stats.Subscribers != 0 {
+		t.Errorf("%d subscribers after closing", stats.Subscribers)
+	}
+	sub.Close() // Harmless once ended
+
+	late := bus.Subscribe(Query{})
+	if !ended(late) || late.Err() != ErrBusClosed {
+		t.Errorf("subscription to a closed bus ended %v with %v", ended(late), late.Err())
+	}
+	bus.Publish(testRecord("Vessel-1", 1, 0))
+	if ids := receivedIDs(late); len(ids) != 0 {
+		t.Errorf("closed bus delivered %v", ids)
+	}
+}
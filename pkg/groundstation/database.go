@@ -1,80 +1,441 @@
 package groundstation
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"io"
 	"os"
+	"path/filepath"
 	"project3/pkg/common"
-	"project3/pkg/protocol"
-	"project3/pkg/satellite"
+	"project3/pkg/wal"
 	"sync"
+	"time"
 )
 
-// Mutex to ensure thread-safe file writes
-var fileMutex sync.Mutex
+// FileStore stores records as checksummed JSON entries in a segmented write-ahead
+// log. A per-vessel and per-time-bucket index is maintained on write so that reads
+// only touch the records they return.
+type FileStore struct {
+	mu            sync.RWMutex
+	readMu        sync.RWMutex // Held by readers of indexed positions; compaction takes it exclusively to swap segments
+	retentionMu   sync.Mutex   // Serializes retention passes
+	log           *wal.Log
+	index         *recordIndex
+	activeSegment uint64
+	activeEntries []segmentEntry // Entries of the active segment, persisted when it is sealed
+}
+
+// Markers of the legacy import in the log directory
+const (
+	importMarker = "import.pending" // While an import runs, so that one interrupted by a crash is resumed
+	importDone   = "import.done"    // Once it completed, so that it never runs again, even once retention empties the log
+)
 
-// SaveToDatabase saves the message to a local JSON file
-func SaveToDatabase(msg satellite.Message) {
-	// Serialize the message
-	data, err := json.Marshal(msg)
+// OpenFileStore opens the record log in the configured directory, creating it if
+// needed. When cfg.Import names a legacy JSON-lines database that was never
+// imported into the log, its records are imported first.
+func OpenFileStore(cfg common.StorageConfig) (*FileStore, error) {
+	dir := cfg.Path
+	if dir == "" {
+		dir = "data"
+	}
+	log, err := wal.Open(dir, wal.Options{
+		MaxSegmentBytes: int64(cfg.SegmentSizeMB) << 20,
+		MaxSegmentAge:   time.Duration(cfg.SegmentMaxAgeMinutes) * time.Minute,
+		Sync:            wal.SyncPolicy(cfg.Fsync),
+		SyncInterval:    time.Duration(cfg.FsyncIntervalMs) * time.Millisecond,
+	})
 	if err != nil {
-		common.Logger.Println("Failed to marshal message to JSON:", err)
-		return
+		return nil, err
 	}
+	store := &FileStore{log: log, index: newRecordIndex()}
 
-	// Thread-safe file access
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
+	if err := store.buildIndex(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	if cfg.Import != "" {
+		if err := store.importOnce(dir, cfg.Import); err != nil {
+			log.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
 
-	// Open file in append mode or create if it doesn't exist
-	file, err := os.OpenFile("database.json", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Append writes the record to the log and indexes it
+func (f *FileStore) Append(rec Record) error {
+	data, err := json.Marshal(rec)
 	if err != nil {
-		common.Logger.Println("Failed to open database file:", err)
-		return
+		return err
 	}
-	defer file.Close()
 
-	// Write the serialized message to the file
-	_, err = file.Write(append(data, '\n'))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pos, err := f.log.Append(data)
 	if err != nil {
-		common.Logger.Println("Failed to write to database:", err)
-	} else {
-		common.Logger.Println("Message successfully saved to database:", msg)
+		return err
 	}
+	if pos.Segment != f.activeSegment {
+		f.sealActive()
+		f.activeSegment = pos.Segment
+	}
+	f.addToIndex(rec.Position.VesselID, rec.Position.Timestamp.UnixNano(), pos)
+	return nil
 }
 
-// LoadFromDatabase Load all data (available for API interface for scalable functionality)
-func LoadFromDatabase() ([]protocol.PositionMessage, error) {
-	data, err := ioutil.ReadFile("database.json")
-	if err != nil {
-		return nil, err
+// Vessels returns the IDs of all vessels with stored records, sorted
+func (f *FileStore) Vessels() ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.index.vessels(), nil
+}
+
+// Latest returns up to n of the most recent records for a vessel, newest first
+func (f *FileStore) Latest(vesselID string, n int) ([]Record, error) {
+	f.readMu.RLock()
+	defer f.readMu.RUnlock()
+	f.mu.RLock()
+	entries := f.index.latest(vesselID, n)
+	f.mu.RUnlock()
+
+	records := make([]Record, 0, len(entries))
+	for _, e := range entries {
+		rec, err := f.readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Range returns all records with a position timestamp in [from, to], oldest first
+func (f *FileStore) Range(from, to time.Time) ([]Record, error) {
+	return f.Query(Query{From: from, To: to})
+}
+
+// Query returns the records matching q in the order it asks for. Only the
+// records in the indexed vessel and time window are read, and reading stops as
+// soon as the page is complete.
+func (f *FileStore) Query(q Query) ([]Record, error) {
+	f.readMu.RLock()
+	defer f.readMu.RUnlock()
+	from, to := q.timeBounds()
+	f.mu.RLock()
+	entries := f.index.lookup(q.VesselIDs, from, to)
+	f.mu.RUnlock()
+
+	collector := &pageCollector{q: q}
+	for i := range entries {
+		e := entries[i]
+		if q.Descending {
+			e = entries[len(entries)-1-i]
+		}
+		rec, err := f.readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		if !collector.add(rec) {
+			break
+		}
 	}
-	var messages []protocol.PositionMessage
-	lines := splitLines(string(data))
-	for _, line := range lines {
-		var msg protocol.PositionMessage
-		if err := json.Unmarshal([]byte(line), &msg); err != nil {
-			common.Logger.Println("Failed to unmarshal line:", err)
+	return collector.result(), nil
+}
+
+// Scan streams every stored record to fn in log order until fn returns false
+func (f *FileStore) Scan(fn func(rec Record) bool) error {
+	err := f.log.Replay(func(pos wal.Position, payload []byte) error {
+		rec, err := DecodeRecord(payload)
+		if err != nil {
+			common.Logger.Printf("Failed to decode record at %d:%d: %v", pos.Segment, pos.Offset, err)
+			return nil
+		}
+		if !fn(rec) {
+			return errStopScan
+		}
+		return nil
+	})
+	if err == errStopScan {
+		return nil
+	}
+	return err
+}
+
+// ApplyRetention rewrites the sealed segments holding records the policy no longer
+// keeps. Segments are copied without holding any lock, so ingest continues during
+// a pass; only swapping in the rewritten segments briefly pauses it. Records in
+// the active segment are left alone until it is sealed.
+func (f *FileStore) ApplyRetention(policy RetentionPolicy, now time.Time) (RetentionStats, error) {
+	f.retentionMu.Lock()
+	defer f.retentionMu.Unlock()
+
+	sealed := make(map[uint64]wal.Segment)
+	for _, seg := range f.log.Segments() {
+		if seg.Sealed {
+			sealed[seg.ID] = seg
+		}
+	}
+
+	// Plan from the index which records to drop
+	var stats RetentionStats
+	drop := make(map[wal.Position]bool)
+	f.mu.RLock()
+	for _, entries := range f.index.byVessel {
+		times := make([]int64, len(entries))
+		for i, e := range entries {
+			times[i] = e.time
+		}
+		stats.Examined += len(entries)
+		for i, kept := range policy.retainTrack(times, now) {
+			if _, ok := sealed[entries[i].pos.Segment]; ok && !kept {
+				drop[entries[i].pos] = true
+			}
+		}
+	}
+	f.mu.RUnlock()
+	if len(drop) == 0 {
+		return stats, nil
+	}
+
+	// Copy the affected segments without the dropped records
+	affected := make(map[uint64]bool)
+	for pos := range drop {
+		affected[pos.Segment] = true
+	}
+	var rewrites []*wal.Rewrite
+	for id := range affected {
+		rw, err := f.log.RewriteSegment(sealed[id], func(pos wal.Position, _ []byte) bool {
+			return !drop[pos]
+		})
+		if err != nil {
+			for _, done := range rewrites {
+				done.Abort()
+			}
+			return stats, err
+		}
+		rewrites = append(rewrites, rw)
+	}
+
+	// Swap them in and move the index over to the new offsets
+	f.readMu.Lock()
+	f.mu.Lock()
+	offsets := make(map[uint64]map[int64]int64)
+	var commitErr error
+	for _, rw := range rewrites {
+		// A stale sidecar must never describe the rewritten segment
+		os.Remove(indexPath(rw.Segment))
+		if commitErr != nil {
+			rw.Abort()
 			continue
 		}
-		messages = append(messages, msg)
+		if commitErr = rw.Commit(); commitErr != nil {
+			continue
+		}
+		offsets[rw.Segment.ID] = rw.Offsets
+		stats.Dropped += rw.Dropped
+	}
+	entries := f.index.remap(offsets)
+	f.mu.Unlock()
+	f.readMu.Unlock()
+
+	for _, seg := range f.log.Segments() {
+		if _, rewritten := offsets[seg.ID]; rewritten {
+			if err := writeSegmentIndex(seg, entries[seg.ID]); err != nil {
+				common.Logger.Printf("Failed to write index of segment %d: %v", seg.ID, err)
+			}
+		}
 	}
-	return messages, nil
+	return stats, commitErr
+}
+
+// Close flushes and closes the log
+func (f *FileStore) Close() error {
+	return f.log.Close()
 }
 
-func splitLines(s string) []string {
-	var lines []string
-	var line string
-	for _, r := range s {
-		if r == '\n' {
-			lines = append(lines, line)
-			line = ""
-		} else {
-			line += string(r)
+// readEntry loads the record at an index entry
+func (f *FileStore) readEntry(e indexEntry) (Record, error) {
+	payload, err := f.log.ReadAt(e.pos)
+	if err != nil {
+		return Record{}, err
+	}
+	return DecodeRecord(payload)
+}
+
+func (f *FileStore) addToIndex(vessel string, ts int64, pos wal.Position) {
+	f.index.add(vessel, ts, pos)
+	f.activeEntries = append(f.activeEntries, segmentEntry{vessel: vessel, time: ts, offset: pos.Offset})
+}
+
+// sealActive persists the index of the segment that was just sealed
+func (f *FileStore) sealActive() {
+	for _, seg := range f.log.Segments() {
+		if seg.ID == f.activeSegment && seg.Sealed {
+			if err := writeSegmentIndex(seg, f.activeEntries); err != nil {
+				common.Logger.Printf("Failed to write index of segment %d: %v", seg.ID, err)
+			}
+		}
+	}
+	f.activeEntries = nil
+}
+
+// buildIndex loads the sidecar index of every sealed segment and scans the
+// segments without one, including the active segment
+func (f *FileStore) buildIndex() error {
+	for _, seg := range f.log.Segments() {
+		f.activeSegment = seg.ID
+		f.activeEntries = nil
+
+		if seg.Sealed {
+			if entries, err := readSegmentIndex(seg); err == nil {
+				for _, e := range entries {
+					f.index.add(e.vessel, e.time, wal.Position{Segment: seg.ID, Offset: e.offset})
+				}
+				continue
+			}
+		}
+
+		err := f.log.ReadSegment(seg, func(pos wal.Position, payload []byte) error {
+			rec, err := DecodeRecord(payload)
+			if err != nil {
+				common.Logger.Printf("Failed to decode record at %d:%d: %v", pos.Segment, pos.Offset, err)
+				return nil
+			}
+			f.addToIndex(rec.Position.VesselID, rec.Position.Timestamp.UnixNano(), pos)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if seg.Sealed {
+			f.sealActive()
+		}
+	}
+	return nil
+}
+
+// importOnce imports the legacy database at path unless the log directory
+// records that it was imported already. A log holding records without either
+// marker predates the markers, so its import is recorded as done.
+func (f *FileStore) importOnce(dir, path string) error {
+	marker, done := filepath.Join(dir, importMarker), filepath.Join(dir, importDone)
+	if _, err := os.Stat(done); err == nil {
+		return nil
+	}
+	_, pendingErr := os.Stat(marker)
+	if !f.log.Empty() && pendingErr != nil {
+		return writeMarker(done, path)
+	}
+	if err := f.importLegacy(path, marker); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// importLegacy streams the records of a JSON-lines database into the log,
+// migrating legacy lines to the current format. The marker file exists until
+// the import is complete; when it is found, the log holds the records of an
+// interrupted import and the lines they came from are skipped.
+func (f *FileStore) importLegacy(path, marker string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	skip := 0
+	if _, err := os.Stat(marker); err == nil {
+		err := f.log.Replay(func(wal.Position, []byte) error {
+			skip++
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+		common.Logger.Printf("Resuming import from %s after %d records", path, skip)
+	} else if err := writeMarker(marker, path); err != nil {
+		return err
 	}
-	if line != "" {
-		lines = append(lines, line)
+
+	imported := 0
+	err = readLines(file, func(line []byte) error {
+		rec, err := DecodeRecord(line)
+		if err != nil {
+			common.Logger.Println("Failed to decode line:", err)
+			return nil
+		}
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if rec.Receipt.Seq == 0 {
+			rec.Receipt.Seq = nextSeq()
+		}
+		imported++
+		return f.Append(rec)
+	})
+	if err != nil {
+		return err
+	}
+	if err := f.log.Sync(); err != nil {
+		return err
+	}
+	common.Logger.Printf("Imported %d records from %s", imported, path)
+	if err := writeMarker(filepath.Join(filepath.Dir(marker), importDone), path); err != nil {
+		return err
+	}
+	if err := os.Remove(marker); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(marker))
+}
+
+// writeMarker durably creates an import marker, naming the imported file
+func writeMarker(marker, source string) error {
+	file, err := os.Create(marker)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(source + "\n")
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(marker))
+}
+
+// readLines calls fn for every non-empty line of r without loading it all into memory
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if ferr := fn(line); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// syncDir flushes directory metadata so that created or removed files survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
 	}
-	return lines
+	defer d.Close()
+	return d.Sync()
 }
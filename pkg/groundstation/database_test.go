@@ -0,0 +1,269 @@
+package groundstation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"project3/pkg/common"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeLegacy writes n records as a JSON-lines database
+func writeLegacy(t *testing.T, path string, n int) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for i := 0; i < n; i++ {
+		line, _ := json.Marshal(testRecord("Vessel-1", i+1, i))
+		file.Write(append(line, '\n'))
+	}
+	file.WriteString("not a record\n")
+}
+
+func storedIDs(t *testing.T, store Store) []int {
+	t.Helper()
+	var ids []int
+	if err := store.Scan(func(rec Record) bool {
+		ids = append(ids, rec.Envelope.ID)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestImportLegacyRunsOnce(t *testing.T) {
+	dir := t.TempDir()
+	cfg := common.StorageConfig{Path: filepath.Join(dir, "log"), Import: filepath.Join(dir, "database.json"), Fsync: "always"}
+	writeLegacy(t, cfg.Import, 5)
+
+	store, err := OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := storedIDs(t, store); len(ids) != 5 {
+		t.Errorf("imported %v, want 5 records", ids)
+	}
+	store.Close()
+	if _, err := os.Stat(filepath.Join(cfg.Path, importMarker)); !os.IsNotExist(err) {
+		t.Errorf("marker left after the import: %v", err)
+	}
+
+	store, err = OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if ids := storedIDs(t, store); len(ids) != 5 {
+		t.Errorf("%v after reopening, want 5 records", ids)
+	}
+}
+
+func TestImportLegacyResumesAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	cfg := common.StorageConfig{Path: filepath.Join(dir, "log"), Import: filepath.Join(dir, "database.json"), Fsync: "always"}
+	writeLegacy(t, cfg.Import, 5)
+
+	// An import that stopped after its first two records
+	partial := cfg
+	partial.Import = ""
+	store, err := OpenFileStore(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Append(testRecord("Vessel-1", i+1, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+	if err := writeMarker(filepath.Join(cfg.Path, importMarker), cfg.Import); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ids := storedIDs(t, store)
+	if len(ids) != 5 {
+		t.Fatalf("stored %v, want 5 records", ids)
+	}
+	for i, id := range ids {
+		if id != i+1 {
+			t.Errorf("record %d has ID %d, want %d", i, id, i+1)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Path, importMarker)); !os.IsNotExist(err) {
+		t.Errorf("marker left after the resumed import: %v", err)
+	}
+}
+
+func TestImportNotRepeatedAfterRetentionEmptiesLog(t *testing.T) {
+	dir := t.TempDir()
+	cfg := common.StorageConfig{Path: filepath.Join(dir, "log"), Import: filepath.Join(dir, "database.json"), Fsync: "always"}
+	writeLegacy(t, cfg.Import, 5)
+
+	store, err := OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Path, importDone)); err != nil {
+		t.Errorf("no marker after the import: %v", err)
+	}
+	// Retention only rewrites sealed segments
+	if err := store.log.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := store.ApplyRetention(RetentionPolicy{MaxAge: time.Hour}, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || stats.Dropped != 5 {
+		t.Fatalf("retention dropped %d records, %v, want all 5", stats.Dropped, err)
+	}
+	if !store.log.Empty() {
+		t.Fatal("log not empty after retention")
+	}
+	store.Close()
+
+	store, err = OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if ids := storedIDs(t, store); len(ids) != 0 {
+		t.Errorf("imported again after retention: %v", ids)
+	}
+}
+
+func TestImportRecordedForLogPredatingMarkers(t *testing.T) {
+	dir := t.TempDir()
+	cfg := common.StorageConfig{Path: filepath.Join(dir, "log"), Fsync: "always"}
+	store, err := OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Append(testRecord("Vessel-1", 1, 0))
+	store.Close()
+
+	cfg.Import = filepath.Join(dir, "database.json")
+	writeLegacy(t, cfg.Import, 5)
+	store, err = OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if ids := storedIDs(t, store); len(ids) != 1 {
+		t.Errorf("stored %v, want the record already in the log only", ids)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Path, importDone)); err != nil {
+		t.Errorf("import of an existing log not recorded as done: %v", err)
+	}
+}
+
+// recordIDs returns the envelope IDs of records in order
+func recordIDs(records []Record) []int {
+	ids := []int{}
+	for _, rec := range records {
+		ids = append(ids, rec.Envelope.ID)
+	}
+	return ids
+}
+
+func TestRetentionSurvivesReopen(t *testing.T) {
+	cfg := common.StorageConfig{Path: filepath.Join(t.TempDir(), "log"), Fsync: "always"}
+	store, err := OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAll := func(records ...Record) {
+		for _, rec := range records {
+			if err := store.Append(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// First sealed segment: both vessels from 06:00:00, thinned to their latest
+	for s := 0; s < 10; s++ {
+		appendAll(testRecord("Vessel-1", 1000+s, s), testRecord("Vessel-2", 2000+s, s))
+	}
+	if err := store.log.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// Second sealed segment: Vessel-2 from 06:35:00, downsampled to one per 10s
+	for s := 2100; s < 2130; s += 5 {
+		appendAll(testRecord("Vessel-2", 2000+s, s))
+	}
+	if err := store.log.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// Active segment, which retention leaves alone
+	appendAll(testRecord("Vessel-1", 1020, 20), testRecord("Vessel-1", 4000, 3000))
+
+	policy := RetentionPolicy{
+		MaxAge:             24 * time.Hour,
+		LatestOnlyAfter:    50 * time.Minute,
+		DownsampleAfter:    20 * time.Minute,
+		DownsampleInterval: 10 * time.Second,
+	}
+	stats, err := store.ApplyRetention(policy, time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Examined != 28 || stats.Dropped != 22 {
+		t.Errorf("retention examined %d and dropped %d records, want 28 and 22", stats.Examined, stats.Dropped)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		all, err := store.Query(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := recordIDs(all), []int{1020, 4100, 4110, 4120, 4125, 4000}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: query returned %v, want %v", when, got, want)
+		}
+		vessel2, err := store.Query(Query{VesselIDs: []string{"Vessel-2"}, Descending: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := recordIDs(vessel2), []int{4125, 4120, 4110, 4100}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Vessel-2 query returned %v, want %v", when, got, want)
+		}
+		latest, err := store.Latest("Vessel-1", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := recordIDs(latest), []int{4000, 1020}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: latest of Vessel-1 is %v, want %v", when, got, want)
+		}
+		if vessels, _ := store.Vessels(); !reflect.DeepEqual(vessels, []string{"Vessel-1", "Vessel-2"}) {
+			t.Errorf("%s: vessels %v", when, vessels)
+		}
+		if got, want := storedIDs(t, store), []int{4100, 4110, 4120, 4125, 1020, 4000}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: log holds %v, want %v", when, got, want)
+		}
+	}
+	check("after retention")
+	store.Close()
+
+	// The rewritten segments are indexed from their remapped sidecars
+	for _, seg := range store.log.Segments() {
+		if !seg.Sealed {
+			continue
+		}
+		if _, err := os.Stat(indexPath(seg)); err != nil {
+			t.Errorf("no index for sealed segment %d: %v", seg.ID, err)
+		}
+	}
+	store, err = OpenFileStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	check("after reopening")
+}
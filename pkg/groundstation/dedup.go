@@ -0,0 +1,161 @@
+package groundstation
+
+import (
+	"container/list"
+	"project3/pkg/satellite"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seedDelay is how much longer before the window Seed looks for positions: they
+// are timestamped before they are received, after waiting in satellite queues
+const seedDelay = time.Hour
+
+// dedupKey identifies a message: IDs are assigned per source vessel
+type dedupKey struct {
+	source string
+	id     int
+}
+
+type dedupEntry struct {
+	key    dedupKey
+	seenAt time.Time
+}
+
+// DedupStats reports how many messages the deduplicator let through or dropped
+type DedupStats struct {
+	Accepted      uint64            `json:"accepted"`
+	Dropped       uint64            `json:"dropped"`
+	DroppedByPath map[string]uint64 `json:"droppedByPath"` // Keyed by the satellites traversed, e.g. "Satellite-1>Satellite-2"
+	Tracked       int               `json:"tracked"`
+}
+
+// Deduplicator drops messages whose (Source, ID) was already seen within a time
+// window. Memory is bounded: at most capacity keys are remembered, oldest first out.
+type Deduplicator struct {
+	mu            sync.Mutex
+	window        time.Duration
+	capacity      int
+	seen          map[dedupKey]*list.Element
+	order         *list.List // Of dedupEntry, oldest first
+	accepted      uint64
+	droppedByPath map[string]uint64
+}
+
+// NewDeduplicator creates a deduplicator remembering up to capacity messages for window
+func NewDeduplicator(capacity int, window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window:        window,
+		capacity:      capacity,
+		seen:          make(map[dedupKey]*list.Element),
+		order:         list.New(),
+		droppedByPath: make(map[string]uint64),
+	}
+}
+
+// Check records msg and reports whether it duplicates a message seen within the window
+func (d *Deduplicator) Check(msg satellite.Message, now time.Time) bool {
+	key := dedupKey{source: msg.Source, id: msg.ID}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	if _, exists := d.seen[key]; exists {
+		d.droppedByPath[pathKey(msg.Path)]++
+		return true
+	}
+	d.remember(key, now)
+	d.accepted++
+	return false
+}
+
+// Forget drops the key of a message that Check let through but that could
+// not be stored, so that the sender's retry is accepted
+func (d *Deduplicator) Forget(msg satellite.Message) {
+	key := dedupKey{source: msg.Source, id: msg.ID}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, exists := d.seen[key]; exists {
+		d.order.Remove(e)
+		delete(d.seen, key)
+		d.accepted--
+	}
+}
+
+// Seed remembers the messages already in the store that were received within the
+// window, so that deduplication carries over a restart
+func (d *Deduplicator) Seed(store Store, now time.Time) error {
+	records, err := store.Range(now.Add(-d.window-seedDelay), time.Time{})
+	if err != nil {
+		return err
+	}
+	sortByReceiveTime(records)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, rec := range records {
+		if now.Sub(rec.Receipt.ReceivedAt) > d.window {
+			continue
+		}
+		key := dedupKey{source: rec.Envelope.Source, id: rec.Envelope.ID}
+		if _, exists := d.seen[key]; !exists {
+			d.remember(key, rec.Receipt.ReceivedAt)
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the counters
+func (d *Deduplicator) Stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := DedupStats{
+		Accepted:      d.accepted,
+		DroppedByPath: make(map[string]uint64, len(d.droppedByPath)),
+		Tracked:       d.order.Len(),
+	}
+	for path, count := range d.droppedByPath {
+		stats.DroppedByPath[path] = count
+		stats.Dropped += count
+	}
+	return stats
+}
+
+// remember adds a key, evicting the oldest one when full
+func (d *Deduplicator) remember(key dedupKey, seenAt time.Time) {
+	if d.capacity > 0 && d.order.Len() >= d.capacity {
+		oldest := d.order.Front()
+		delete(d.seen, oldest.Value.(dedupEntry).key)
+		d.order.Remove(oldest)
+	}
+	d.seen[key] = d.order.PushBack(dedupEntry{key: key, seenAt: seenAt})
+}
+
+// expire forgets keys seen before the window
+func (d *Deduplicator) expire(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		entry := e.Value.(dedupEntry)
+		if now.Sub(entry.seenAt) <= d.window {
+			return
+		}
+		delete(d.seen, entry.key)
+		d.order.Remove(e)
+	}
+}
+
+// pathKey names the route a message took through the constellation
+func pathKey(path []string) string {
+	if len(path) == 0 {
+		return "direct"
+	}
+	return strings.Join(path, ">")
+}
+
+func sortByReceiveTime(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Receipt.ReceivedAt.Before(records[j].Receipt.ReceivedAt)
+	})
+}
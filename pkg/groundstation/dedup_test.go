@@ -0,0 +1,112 @@
+package groundstation
+
+import (
+	"project3/pkg/satellite"
+	"testing"
+	"time"
+)
+
+var dedupNow = time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+
+func dedupMessage(source string, id int, path ...string) satellite.Message {
+	return satellite.Message{ID: id, Source: source, Destination: NodeID, Path: path}
+}
+
+func TestDedupWindow(t *testing.T) {
+	d := NewDeduplicator(100, time.Minute)
+	msg := dedupMessage("Vessel-1", 1, "Satellite-1", "Satellite-2")
+	if d.Check(msg, dedupNow) {
+		t.Fatal("first sighting reported as duplicate")
+	}
+	if !d.Check(msg, dedupNow.Add(time.Second)) {
+		t.Error("repeat within the window accepted")
+	}
+	if !d.Check(msg, dedupNow.Add(time.Minute)) {
+		t.Error("repeat at the end of the window accepted")
+	}
+	if d.Check(dedupMessage("Vessel-2", 1), dedupNow.Add(time.Minute)) {
+		t.Error("same ID from another vessel reported as duplicate")
+	}
+	if d.Check(msg, dedupNow.Add(time.Minute+time.Nanosecond)) {
+		t.Error("repeat after the window reported as duplicate")
+	}
+
+	stats := d.Stats()
+	if stats.Accepted != 3 || stats.Dropped != 2 || stats.DroppedByPath["Satellite-1>Satellite-2"] != 2 {
+		t.Errorf("stats %+v, want 3 accepted and 2 dropped on Satellite-1>Satellite-2", stats)
+	}
+	if stats.Tracked != 2 {
+		t.Errorf("tracking %d keys, want the 2 seen within the window", stats.Tracked)
+	}
+}
+
+func TestDedupEvictsOldestAtCapacity(t *testing.T) {
+	d := NewDeduplicator(2, time.Hour)
+	for i := 1; i <= 3; i++ {
+		d.Check(dedupMessage("Vessel-1", i), dedupNow.Add(time.Duration(i)*time.Second))
+	}
+	if stats := d.Stats(); stats.Tracked != 2 {
+		t.Errorf("tracking %d keys, want 2", stats.Tracked)
+	}
+	if !d.Check(dedupMessage("Vessel-1", 3), dedupNow.Add(4*time.Second)) {
+		t.Error("newest key forgotten")
+	}
+	if d.Check(dedupMessage("Vessel-1", 1), dedupNow.Add(5*time.Second)) {
+		t.Error("oldest key still remembered beyond capacity")
+	}
+	// Remembering 1 again evicted 2, the oldest left
+	if d.Check(dedupMessage("Vessel-1", 2), dedupNow.Add(6*time.Second)) {
+		t.Error("key 2 still remembered after 1 took its place")
+	}
+}
+
+func TestDedupForget(t *testing.T) {
+	d := NewDeduplicator(100, time.Hour)
+	msg := dedupMessage("Vessel-1", 7)
+	d.Check(msg, dedupNow)
+	d.Forget(msg)
+	if stats := d.Stats(); stats.Accepted != 0 || stats.Tracked != 0 {
+		t.Errorf("stats %+v after forgetting, want nothing accepted or tracked", stats)
+	}
+	if d.Check(msg, dedupNow.Add(time.Second)) {
+		t.Error("retry of a forgotten message reported as duplicate")
+	}
+	d.Forget(dedupMessage("Vessel-1", 8)) // Never seen: no effect
+	if stats := d.Stats(); stats.Accepted != 1 || stats.Tracked != 1 {
+		t.Errorf("stats %+v, want the retry accepted and tracked", stats)
+	}
+}
+
+func TestDedupSeed(t *testing.T) {
+	store := NewMemoryStore()
+	add := func(id int, timestamp, received time.Duration) {
+		rec := testRecord("Vessel-1", id, 0)
+		rec.Position.Timestamp = dedupNow.Add(-timestamp)
+		rec.Receipt.ReceivedAt = dedupNow.Add(-received)
+		if err := store.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(1, 3*time.Hour, 2*time.Hour)       // Received before the window
+	add(2, 40*time.Minute, 30*time.Minute) // Received within it
+	add(3, 90*time.Minute, 50*time.Minute) // Timestamped before it, delivered late
+	add(4, 61*time.Minute, 61*time.Minute) // Just before it
+	add(5, time.Hour, time.Hour)           // At its start
+	d := NewDeduplicator(100, time.Hour)
+	if err := d.Seed(store, dedupNow); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]bool{1: false, 2: true, 3: true, 4: false, 5: true}
+	for id := 1; id <= 5; id++ {
+		// Checked at the same time, so nothing seeded has expired yet
+		if got := d.Check(dedupMessage("Vessel-1", id), dedupNow); got != want[id] {
+			t.Errorf("message %d after seeding: duplicate %v, want %v", id, got, want[id])
+		}
+	}
+
+	// Seeded keys expire by the time they were received
+	if d.Check(dedupMessage("Vessel-1", 5), dedupNow.Add(time.Nanosecond)) {
+		t.Error("seeded key outlived the window")
+	}
+}
@@ -0,0 +1,154 @@
+package groundstation
+
+import (
+	"project3/pkg/protocol"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default staleness thresholds of the fleet picture
+const (
+	DefaultStaleAfter = time.Minute
+	DefaultLostAfter  = 10 * time.Minute
+)
+
+// staticLookback is how many of a vessel's latest records Rebuild searches for
+// static data, which vessels send only every few reports
+const staticLookback = 100
+
+// Staleness classifies how recently a vessel was heard from
+type Staleness string
+
+const (
+	Fresh Staleness = "fresh"
+	Stale Staleness = "stale"
+	Lost  Staleness = "lost"
+)
+
+// VesselState is the current picture of one vessel
+type VesselState struct {
+	VesselID  string                   `json:"vesselID"`
+	Static    *protocol.VesselInfo     `json:"static,omitempty"` // Latest identity and static data
+	Position  protocol.PositionMessage `json:"position"`         // Last fix
+	LastSeen  time.Time                `json:"lastSeen"`         // When the last fix was received
+	Satellite string                   `json:"satellite,omitempty"`
+	Feed      string                   `json:"feed,omitempty"`
+	Hops      int                      `json:"hops"`
+	State     Staleness                `json:"state"`
+}
+
+// Fleet maintains the latest known position of every vessel. It is updated on
+// every ingest so that reading the fleet picture never touches the store.
+type Fleet struct {
+	mu         sync.RWMutex
+	vessels    map[string]VesselState
+	staleAfter time.Duration
+	lostAfter  time.Duration
+}
+
+// NewFleet creates an empty fleet picture with the default staleness thresholds
+func NewFleet() *Fleet {
+	return &Fleet{
+		vessels:    make(map[string]VesselState),
+		staleAfter: DefaultStaleAfter,
+		lostAfter:  DefaultLostAfter,
+	}
+}
+
+// SetThresholds changes after how long without a fix a vessel becomes stale and lost
+func (f *Fleet) SetThresholds(staleAfter, lostAfter time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.staleAfter = staleAfter
+	f.lostAfter = lostAfter
+}
+
+// Update records a stored record if it is the newest fix of its vessel
+func (f *Fleet) Update(rec Record) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := rec.Position.VesselID
+	current, exists := f.vessels[id]
+	if exists && rec.Position.Timestamp.Before(current.Position.Timestamp) {
+		if current.Static == nil && rec.Position.Static != nil {
+			current.Static = rec.Position.Static
+			f.vessels[id] = current
+		}
+		return
+	}
+	static := rec.Position.Static
+	if static == nil {
+		static = current.Static
+	}
+	f.vessels[id] = VesselState{
+		VesselID:  id,
+		Static:    static,
+		Position:  rec.Position,
+		LastSeen:  rec.Receipt.ReceivedAt,
+		Satellite: rec.Receipt.Satellite,
+		Feed:      rec.Receipt.Feed,
+		Hops:      rec.Receipt.Hops,
+	}
+}
+
+// Rebuild loads the latest record of every stored vessel
+func (f *Fleet) Rebuild(store Store) error {
+	ids, err := store.Vessels()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		latest, err := store.Latest(id, staticLookback)
+		if err != nil {
+			return err
+		}
+		if len(latest) == 0 {
+			continue
+		}
+		f.Update(latest[0])
+		for _, rec := range latest[1:] {
+			if rec.Position.Static != nil {
+				f.Update(rec) // Older, so it only fills in the static data
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the state of every vessel, sorted by vessel ID
+func (f *Fleet) Snapshot(now time.Time) []VesselState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	states := make([]VesselState, 0, len(f.vessels))
+	for _, state := range f.vessels {
+		states = append(states, f.withStaleness(state, now))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].VesselID < states[j].VesselID })
+	return states
+}
+
+// Vessel returns the state of one vessel
+func (f *Fleet) Vessel(id string, now time.Time) (VesselState, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	state, exists := f.vessels[id]
+	if !exists {
+		return VesselState{}, false
+	}
+	return f.withStaleness(state, now), true
+}
+
+func (f *Fleet) withStaleness(state VesselState, now time.Time) VesselState {
+	age := now.Sub(state.LastSeen)
+	switch {
+	case age > f.lostAfter:
+		state.State = Lost
+	case age > f.staleAfter:
+		state.State = Stale
+	default:
+		state.State = Fresh
+	}
+	return state
+}
@@ -1,53 +1,216 @@
 package groundstation
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
+	"errors"
+	"fmt"
+	"project3/pkg/auth"
 	"project3/pkg/common"
 	"project3/pkg/satellite"
+	"project3/pkg/transport"
+	"strings"
+	"time"
 )
 
-// StartServer starts the HTTP server for the ground station
-func StartServer() {
-	http.HandleFunc("/", handleSatelliteMessage) // Matches the root endpoint used by the satellite
+// NodeID identifies the ground station, as the destination of messages and in its certificate
+const NodeID = "GroundStation"
 
-	address := common.AppConfig.GroundStationAddress
-	common.Logger.Printf("Ground station HTTP server started at %s\n", address)
+// ErrDuplicate is returned by Ingest for a message that was already received
+var ErrDuplicate = errors.New("duplicate message")
 
-	if err := http.ListenAndServe(address, nil); err != nil {
-		common.Logger.Fatalf("Failed to start Ground Station server: %v\n", err)
+// ErrUnauthenticated is returned by Ingest for a report that failed verification
+var ErrUnauthenticated = errors.New("report failed authentication")
+
+// Server is the ground station receiving messages relayed by satellites
+type Server struct {
+	store      Store
+	dedup      *Deduplicator
+	verifier   *auth.Verifier
+	quarantine *Quarantine
+	trustFeeds bool // Feed reports bypass the verifier
+	fleet      *Fleet
+	bus        *Bus
+}
+
+// AuthStats reports the verification of reports at ingest
+type AuthStats struct {
+	auth.Stats
+	Quarantined uint64 `json:"quarantined"` // Reports in quarantine, including those of earlier runs
+}
+
+// NewServer creates a ground station that persists received messages to store
+func NewServer(store Store) *Server {
+	return &Server{store: store, fleet: NewFleet(), bus: NewBus()}
+}
+
+// Store returns the store the ground station writes to
+func (s *Server) Store() Store {
+	return s.store
+}
+
+// Fleet returns the current fleet picture maintained on ingest
+func (s *Server) Fleet() *Fleet {
+	return s.fleet
+}
+
+// Bus returns the bus every ingested record is published on
+func (s *Server) Bus() *Bus {
+	return s.bus
+}
+
+// SetDeduplicator enables duplicate suppression on ingest
+func (s *Server) SetDeduplicator(dedup *Deduplicator) {
+	s.dedup = dedup
+}
+
+// DedupStats returns the duplicate suppression counters, if enabled
+func (s *Server) DedupStats() (DedupStats, bool) {
+	if s.dedup == nil {
+		return DedupStats{}, false
 	}
+	return s.dedup.Stats(), true
+}
+
+// SetVerifier enables the verification of report signatures on ingest.
+// Rejected reports are kept in quarantine if one is given, dropped otherwise.
+func (s *Server) SetVerifier(verifier *auth.Verifier, quarantine *Quarantine) {
+	s.verifier = verifier
+	s.quarantine = quarantine
+}
+
+// TrustFeeds exempts reports of AIS feeds, which carry no signatures, from
+// verification. Otherwise they are verified like relayed reports, so they are
+// rejected where signatures are required.
+func (s *Server) TrustFeeds(trust bool) {
+	s.trustFeeds = trust
 }
 
-// handleSatelliteMessage handles incoming HTTP POST requests from satellites
-func handleSatelliteMessage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
+// AuthStats returns the verification counters, if enabled
+func (s *Server) AuthStats() (AuthStats, bool) {
+	if s.verifier == nil {
+		return AuthStats{}, false
+	}
+	stats := AuthStats{Stats: s.verifier.Stats()}
+	if s.quarantine != nil {
+		stats.Quarantined = s.quarantine.Len()
 	}
+	return stats, true
+}
 
-	body, err := io.ReadAll(r.Body)
+// Quarantine returns the quarantine of rejected reports, or nil if they are dropped
+func (s *Server) Quarantine() *Quarantine {
+	return s.quarantine
+}
+
+// Ingest stores a received message together with its receive metadata.
+// Reports failing verification are rejected with ErrUnauthenticated before
+// duplicate suppression sees them, so that a forged report cannot mask the
+// genuine one. Messages already received are dropped with ErrDuplicate.
+func (s *Server) Ingest(msg satellite.Message, receivedAt time.Time) error {
+	rec := NewRecord(msg, receivedAt)
+	if s.verifier != nil {
+		verified, err := s.verifier.Verify(msg)
+		if err != nil {
+			return s.reject(msg, rec, err)
+		}
+		rec.Receipt.Verified = verified
+	}
+	return s.ingest(msg, rec)
+}
+
+// reject quarantines a report that failed verification, if enabled
+func (s *Server) reject(msg satellite.Message, rec Record, reason error) error {
+	if s.quarantine == nil {
+		return fmt.Errorf("%w: %v", ErrUnauthenticated, reason)
+	}
+	report := QuarantinedReport{Record: rec, Reason: reason.Error(), Signature: msg.Signature}
+	if err := s.quarantine.Add(report); err != nil {
+		return fmt.Errorf("failed to quarantine report: %w", err)
+	}
+	return fmt.Errorf("%w, quarantined: %v", ErrUnauthenticated, reason)
+}
+
+// IngestFeed stores a message received from an external feed rather than
+// relayed by a satellite, tagging its record with the feed. Unless feeds are
+// trusted it is verified as Ingest does.
+func (s *Server) IngestFeed(msg satellite.Message, feed string, receivedAt time.Time) error {
+	rec := NewRecord(msg, receivedAt)
+	rec.Receipt.Feed = feed
+	if s.verifier != nil && !s.trustFeeds {
+		verified, err := s.verifier.Verify(msg)
+		if err != nil {
+			return s.reject(msg, rec, err)
+		}
+		rec.Receipt.Verified = verified
+	}
+	return s.ingest(msg, rec)
+}
+
+func (s *Server) ingest(msg satellite.Message, rec Record) error {
+	if s.dedup != nil && s.dedup.Check(msg, rec.Receipt.ReceivedAt) {
+		return ErrDuplicate
+	}
+	if err := s.store.Append(rec); err != nil {
+		if s.dedup != nil {
+			s.dedup.Forget(msg)
+		}
+		return err
+	}
+	s.fleet.Update(rec)
+	s.bus.Publish(rec)
+	return nil
+}
+
+// StartServer serves the ground station on address, with the transport it
+// names: host:port or http://host:port for HTTP, tcp://host:port for TCP
+func (s *Server) StartServer(address string) {
+	name, hostport, err := transport.Parse(address)
+	if err != nil {
+		common.Logger.Fatalf("Failed to start Ground Station server: %v\n", err)
+	}
+	t, err := transport.ForNode(NodeID, name)
 	if err != nil {
-		common.Logger.Printf("Failed to read request body: %v\n", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+		common.Logger.Fatalf("Failed to start Ground Station server: %v\n", err)
 	}
-	defer r.Body.Close()
 
-	var msg satellite.Message // Use the correct struct to unmarshal the satellite's payload
-	if err := json.Unmarshal(body, &msg); err != nil {
-		common.Logger.Printf("Failed to decode JSON message: %v\n", err)
-		http.Error(w, "Failed to decode JSON message", http.StatusBadRequest)
-		return
+	common.Logger.Printf("Ground station %s server started at %s\n", strings.ToUpper(t.Name()), hostport)
+
+	if err := t.Listen(hostport, s.handleFrame); err != nil {
+		common.Logger.Fatalf("Failed to start Ground Station server: %v\n", err)
 	}
+}
 
-	common.Logger.Printf("Received message: %+v\n", msg)
+// handleFrame stores the messages of a frame received from a satellite
+func (s *Server) handleFrame(frame transport.Frame, peer transport.Peer) error {
+	// Satellites send JSON or the binary codec, named by the content type
+	msgs, err := satellite.DecodeFrame(frame)
+	if err != nil {
+		common.Logger.Printf("Failed to decode message from %s: %v\n", peer, err)
+		return err
+	}
+	if err := satellite.CheckSender(msgs, peer); err != nil {
+		common.Logger.Printf("Refused a frame: %v\n", err)
+		return err
+	}
 
-	// Example: Storing the message or processing it
-	SaveToDatabase(msg)
+	receivedAt := time.Now().UTC()
+	for _, msg := range msgs {
+		common.Logger.Printf("Received message: %+v\n", msg)
 
-	// Respond to the satellite to confirm receipt
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Message received and processed"))
+		err = s.Ingest(msg, receivedAt)
+		if err == ErrDuplicate {
+			// Acknowledged with the frame so the sender does not retransmit it again
+			common.Logger.Printf("Dropped duplicate message %d from %s via %s\n", msg.ID, msg.Source, pathKey(msg.Path))
+			continue
+		}
+		if errors.Is(err, ErrUnauthenticated) {
+			// Also acknowledged: sending it again would not make it authentic
+			common.Logger.Printf("Rejected message %d from %s via %s: %v\n", msg.ID, msg.Source, pathKey(msg.Path), err)
+			continue
+		}
+		if err != nil {
+			common.Logger.Printf("Failed to store message: %v\n", err)
+			return fmt.Errorf("failed to store message: %w", err)
+		}
+	}
+	return nil
 }
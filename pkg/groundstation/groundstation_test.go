@@ -0,0 +1,33 @@
+package groundstation
+
+import (
+	"errors"
+	"project3/pkg/auth"
+	"project3/pkg/common"
+	"project3/pkg/satellite"
+	"testing"
+	"time"
+)
+
+func TestFeedReportsWhereSignaturesAreRequired(t *testing.T) {
+	keys, err := auth.LoadVerificationKeys(common.AuthConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := testRecord("MMSI-257000000", 1, 0)
+	msg := satellite.Message{ID: 1, Source: rec.Envelope.Source, Destination: NodeID, Content: rec.Position}
+
+	for _, trust := range []bool{false, true} {
+		station := NewServer(NewMemoryStore())
+		station.SetVerifier(auth.NewVerifier(keys, true), nil)
+		station.TrustFeeds(trust)
+		err := station.IngestFeed(msg, "tcp 127.0.0.1:40000", time.Now())
+		stored := storedIDs(t, station.Store())
+		if !trust && (!errors.Is(err, ErrUnauthenticated) || len(stored) != 0) {
+			t.Errorf("untrusted feed: %v, stored %v, want the report rejected", err, stored)
+		}
+		if trust && (err != nil || len(stored) != 1) {
+			t.Errorf("trusted feed: %v, stored %v, want the report stored", err, stored)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package groundstation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"project3/pkg/wal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// indexBucketWidth is the span of time covered by one bucket of the time index
+const indexBucketWidth = time.Hour
+
+// indexFileExt is the extension of the index sidecar written next to a sealed segment
+const indexFileExt = ".idx"
+
+var errBadIndex = errors.New("invalid index file")
+
+// indexEntry locates one record in the log
+type indexEntry struct {
+	time int64 // Position timestamp in Unix nanoseconds
+	pos  wal.Position
+}
+
+// segmentEntry is an index entry as persisted in a segment sidecar
+type segmentEntry struct {
+	vessel string
+	time   int64
+	offset int64
+}
+
+// recordIndex maps vessels and time buckets to record positions. It is not safe
+// for concurrent use; FileStore guards it with its lock.
+type recordIndex struct {
+	byVessel map[string][]indexEntry // Sorted by time
+	byBucket map[int64][]indexEntry  // Sorted by time
+	buckets  []int64                 // Sorted bucket keys
+}
+
+func newRecordIndex() *recordIndex {
+	return &recordIndex{
+		byVessel: make(map[string][]indexEntry),
+		byBucket: make(map[int64][]indexEntry),
+	}
+}
+
+// add indexes a record stored at pos
+func (idx *recordIndex) add(vessel string, ts int64, pos wal.Position) {
+	e := indexEntry{time: ts, pos: pos}
+	idx.byVessel[vessel] = insertEntry(idx.byVessel[vessel], e)
+
+	bucket := bucketOf(ts)
+	if _, exists := idx.byBucket[bucket]; !exists {
+		i := sort.Search(len(idx.buckets), func(i int) bool { return idx.buckets[i] >= bucket })
+		idx.buckets = append(idx.buckets, 0)
+		copy(idx.buckets[i+1:], idx.buckets[i:])
+		idx.buckets[i] = bucket
+	}
+	idx.byBucket[bucket] = insertEntry(idx.byBucket[bucket], e)
+}
+
+// vessels returns the indexed vessel IDs, sorted
+func (idx *recordIndex) vessels() []string {
+	ids := make([]string, 0, len(idx.byVessel))
+	for id := range idx.byVessel {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// latest returns the positions of the n newest records of a vessel, newest first
+func (idx *recordIndex) latest(vessel string, n int) []indexEntry {
+	entries := idx.byVessel[vessel]
+	if n <= 0 || n > len(entries) {
+		n = len(entries)
+	}
+	latest := make([]indexEntry, 0, n)
+	for i := len(entries) - 1; i >= len(entries)-n; i-- {
+		latest = append(latest, entries[i])
+	}
+	return latest
+}
+
+// lookup returns the entries of the given vessels (all when empty) with a time
+// in [fromTime, toTime], ordered by time and position. Zero times are unbounded.
+func (idx *recordIndex) lookup(vessels []string, fromTime, toTime time.Time) []indexEntry {
+	from, to := int64(-1<<63), int64(1<<63-1)
+	if !fromTime.IsZero() {
+		from = fromTime.UnixNano()
+	}
+	if !toTime.IsZero() {
+		to = toTime.UnixNano()
+	}
+
+	var found []indexEntry
+	if len(vessels) > 0 {
+		for _, vessel := range vessels {
+			found = append(found, entriesBetween(idx.byVessel[vessel], from, to)...)
+		}
+	} else {
+		first := sort.Search(len(idx.buckets), func(i int) bool { return idx.buckets[i] >= bucketOf(from) })
+		for i := first; i < len(idx.buckets) && idx.buckets[i] <= bucketOf(to); i++ {
+			found = append(found, entriesBetween(idx.byBucket[idx.buckets[i]], from, to)...)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return entryLess(found[i], found[j]) })
+	return found
+}
+
+// remap applies committed segment rewrites to the index. offsets maps every
+// rewritten segment to the new offsets of its kept records; entries of those
+// segments without a new offset are removed. The surviving entries of each
+// rewritten segment are returned for persisting in its sidecar.
+func (idx *recordIndex) remap(offsets map[uint64]map[int64]int64) map[uint64][]segmentEntry {
+	rewritten := make(map[uint64][]segmentEntry)
+	filter := func(entries []indexEntry, vessel string) []indexEntry {
+		kept := entries[:0]
+		for _, e := range entries {
+			if moved, ok := offsets[e.pos.Segment]; ok {
+				offset, found := moved[e.pos.Offset]
+				if !found {
+					continue
+				}
+				e.pos.Offset = offset
+				if vessel != "" {
+					rewritten[e.pos.Segment] = append(rewritten[e.pos.Segment], segmentEntry{vessel: vessel, time: e.time, offset: offset})
+				}
+			}
+			kept = append(kept, e)
+		}
+		return kept
+	}
+
+	for vessel, entries := range idx.byVessel {
+		if entries = filter(entries, vessel); len(entries) > 0 {
+			idx.byVessel[vessel] = entries
+		} else {
+			delete(idx.byVessel, vessel)
+		}
+	}
+	buckets := idx.buckets[:0]
+	for _, bucket := range idx.buckets {
+		if entries := filter(idx.byBucket[bucket], ""); len(entries) > 0 {
+			idx.byBucket[bucket] = entries
+			buckets = append(buckets, bucket)
+		} else {
+			delete(idx.byBucket, bucket)
+		}
+	}
+	idx.buckets = buckets
+
+	for _, entries := range rewritten {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].offset < entries[j].offset })
+	}
+	return rewritten
+}
+
+// entriesBetween returns the entries of a time-sorted slice with time in [from, to]
+func entriesBetween(entries []indexEntry, from, to int64) []indexEntry {
+	start := sort.Search(len(entries), func(i int) bool { return entries[i].time >= from })
+	end := sort.Search(len(entries), func(i int) bool { return entries[i].time > to })
+	if start >= end {
+		return nil
+	}
+	return entries[start:end]
+}
+
+// insertEntry inserts e into a time-sorted slice. Records mostly arrive in
+// order, so the search starts from the end.
+func insertEntry(entries []indexEntry, e indexEntry) []indexEntry {
+	i := len(entries)
+	for i > 0 && entryLess(e, entries[i-1]) {
+		i--
+	}
+	entries = append(entries, indexEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = e
+	return entries
+}
+
+func entryLess(a, b indexEntry) bool {
+	if a.time != b.time {
+		return a.time < b.time
+	}
+	if a.pos.Segment != b.pos.Segment {
+		return a.pos.Segment < b.pos.Segment
+	}
+	return a.pos.Offset < b.pos.Offset
+}
+
+func bucketOf(ts int64) int64 {
+	width := int64(indexBucketWidth)
+	bucket := ts / width
+	if ts < 0 && ts%width != 0 {
+		bucket--
+	}
+	return bucket
+}
+
+// indexPath returns the sidecar index path of a segment
+func indexPath(seg wal.Segment) string {
+	return strings.TrimSuffix(seg.Path, ".wal") + indexFileExt
+}
+
+// writeSegmentIndex persists the entries of a sealed segment next to it
+func writeSegmentIndex(seg wal.Segment, entries []segmentEntry) error {
+	var buf bytes.Buffer
+	scratch := make([]byte, binary.MaxVarintLen64)
+	for _, e := range entries {
+		buf.Write(scratch[:binary.PutUvarint(scratch, uint64(len(e.vessel)))])
+		buf.WriteString(e.vessel)
+		buf.Write(scratch[:binary.PutVarint(scratch, e.time)])
+		buf.Write(scratch[:binary.PutUvarint(scratch, uint64(e.offset))])
+	}
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum)
+
+	path := indexPath(seg)
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readSegmentIndex loads the sidecar index of a segment
+func readSegmentIndex(seg wal.Segment) ([]segmentEntry, error) {
+	data, err := ioutil.ReadFile(indexPath(seg))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errBadIndex
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, errBadIndex
+	}
+
+	var entries []segmentEntry
+	reader := bytes.NewReader(body)
+	for reader.Len() > 0 {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil || size > uint64(reader.Len()) {
+			return nil, errBadIndex
+		}
+		vessel := make([]byte, size)
+		reader.Read(vessel)
+		ts, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, errBadIndex
+		}
+		offset, err := binary.ReadUvarint(reader)
+		if err != nil || int64(offset) >= seg.Size {
+			return nil, errBadIndex
+		}
+		entries = append(entries, segmentEntry{vessel: string(vessel), time: ts, offset: int64(offset)})
+	}
+	return entries, nil
+}
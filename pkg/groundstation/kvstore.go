@@ -0,0 +1,349 @@
+package groundstation
+
+import (
+	"encoding/json"
+	"fmt"
+	"project3/pkg/common"
+	"project3/pkg/kvstore"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key layout of the embedded key-value backend:
+//
+//	r/<time>/<seq>            -> JSON record, ordered by position timestamp
+//	v/<vessel>\x00<time>/<seq> -> primary key of the record, ordered per vessel
+//
+// The index entry of a record is written before the record and deleted after
+// it, so a crash in between can only leave an index entry without a record.
+// Such entries are skipped on read and removed when the database is opened.
+const (
+	kvRecordPrefix = "r/"
+	kvVesselPrefix = "v/"
+)
+
+// indexBatch is how many vessel index entries are read before their records are loaded
+const indexBatch = 256
+
+// KVStore stores records in an embedded key-value database
+type KVStore struct {
+	mu  sync.Mutex // Serializes appends so that sequence numbers are handed out in order
+	db  *kvstore.DB
+	seq uint64
+}
+
+// OpenKVStore opens or creates the key-value database at cfg.Path
+func OpenKVStore(cfg common.StorageConfig) (*KVStore, error) {
+	path := cfg.Path
+	if path == "" {
+		path = "database.kv"
+	}
+	db, err := kvstore.Open(path, kvstore.Options{
+		Sync:         kvstore.SyncPolicy(cfg.Fsync),
+		SyncInterval: time.Duration(cfg.FsyncIntervalMs) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume the sequence after the highest one in use
+	store := &KVStore{db: db}
+	err = db.Ascend([]byte(kvRecordPrefix), prefixEnd(kvRecordPrefix), func(key, _ []byte) bool {
+		parts := strings.Split(string(key), "/")
+		if seq, err := strconv.ParseUint(parts[len(parts)-1], 16, 64); err == nil && seq > store.seq {
+			store.seq = seq
+		}
+		return true
+	})
+	if err == nil {
+		err = store.repairIndex()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// repairIndex deletes the vessel index entries whose record was never written
+// or already deleted when the process stopped
+func (k *KVStore) repairIndex() error {
+	var keys, primaries [][]byte
+	err := k.db.Ascend([]byte(kvVesselPrefix), prefixEnd(kvVesselPrefix), func(key, primary []byte) bool {
+		keys = append(keys, key)
+		primaries = append(primaries, primary)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	repaired := 0
+	for i, primary := range primaries {
+		if _, ok, err := k.db.Get(primary); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		if err := k.db.Delete(keys[i]); err != nil {
+			return err
+		}
+		repaired++
+	}
+	if repaired > 0 {
+		common.Logger.Printf("Removed %d dangling vessel index entries", repaired)
+	}
+	return nil
+}
+
+// Append stores a new record
+func (k *KVStore) Append(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.seq++
+	suffix := fmt.Sprintf("%s/%016x", timeKey(rec.Position.Timestamp), k.seq)
+	primary := kvRecordPrefix + suffix
+	if err := k.db.Put([]byte(vesselPrefix(rec.Position.VesselID)+suffix), []byte(primary)); err != nil {
+		return err
+	}
+	return k.db.Put([]byte(primary), data)
+}
+
+// Vessels returns the IDs of all vessels with stored records, sorted
+func (k *KVStore) Vessels() ([]string, error) {
+	var ids []string
+	start := []byte(kvVesselPrefix)
+	for {
+		// Find the first key of the next vessel, then skip past all of its keys
+		var next string
+		found := false
+		err := k.db.Ascend(start, prefixEnd(kvVesselPrefix), func(key, _ []byte) bool {
+			rest := strings.TrimPrefix(string(key), kvVesselPrefix)
+			if sep := strings.IndexByte(rest, 0); sep >= 0 {
+				next, found = rest[:sep], true
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return ids, nil
+		}
+		ids = append(ids, next)
+		start = prefixEnd(vesselPrefix(next))
+	}
+}
+
+// Latest returns up to n of the most recent records for a vessel, newest first
+func (k *KVStore) Latest(vesselID string, n int) ([]Record, error) {
+	prefix := vesselPrefix(vesselID)
+	var records []Record
+	err := k.walkIndex([]byte(prefix), prefixEnd(prefix), true, func(rec Record) bool {
+		records = append(records, rec)
+		return n <= 0 || len(records) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Range returns all records with a position timestamp in [from, to], oldest first
+func (k *KVStore) Range(from, to time.Time) ([]Record, error) {
+	return k.Query(Query{From: from, To: to})
+}
+
+// Query returns the records matching q in the order it asks for
+func (k *KVStore) Query(q Query) ([]Record, error) {
+	if len(q.VesselIDs) == 0 {
+		return k.scan(kvRecordPrefix, q, k.walkRecords)
+	}
+
+	// Each vessel contributes at most one page; the merged result is cut to size
+	var records []Record
+	for _, vesselID := range q.VesselIDs {
+		found, err := k.scan(vesselPrefix(vesselID), q, k.walkIndex)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	return selectRecords(records, q), nil
+}
+
+// Scan streams every stored record to fn in timestamp order until fn returns false
+func (k *KVStore) Scan(fn func(rec Record) bool) error {
+	return k.walkRecords([]byte(kvRecordPrefix), prefixEnd(kvRecordPrefix), false, fn)
+}
+
+// ApplyRetention deletes the records the policy no longer keeps and compacts the database
+func (k *KVStore) ApplyRetention(policy RetentionPolicy, now time.Time) (RetentionStats, error) {
+	type track struct {
+		times []int64
+		keys  []string // Vessel index keys, parallel to times
+	}
+
+	// The vessel index holds every track in timestamp order
+	tracks := make(map[string]*track)
+	err := k.db.Ascend([]byte(kvVesselPrefix), prefixEnd(kvVesselPrefix), func(key, _ []byte) bool {
+		rest := strings.TrimPrefix(string(key), kvVesselPrefix)
+		sep := strings.LastIndexByte(rest, 0)
+		if sep < 0 {
+			return true
+		}
+		vessel, suffix := rest[:sep], rest[sep+1:]
+		ts, err := strconv.ParseUint(strings.SplitN(suffix, "/", 2)[0], 16, 64)
+		if err != nil {
+			return true
+		}
+		t := tracks[vessel]
+		if t == nil {
+			t = &track{}
+			tracks[vessel] = t
+		}
+		t.times = append(t.times, int64(ts^(1<<63)))
+		t.keys = append(t.keys, string(key))
+		return true
+	})
+	if err != nil {
+		return RetentionStats{}, err
+	}
+
+	var stats RetentionStats
+	for vessel, t := range tracks {
+		stats.Examined += len(t.times)
+		for i, kept := range policy.retainTrack(t.times, now) {
+			if kept {
+				continue
+			}
+			suffix := strings.TrimPrefix(t.keys[i], vesselPrefix(vessel))
+			if err := k.db.Delete([]byte(kvRecordPrefix + suffix)); err != nil {
+				return stats, err
+			}
+			if err := k.db.Delete([]byte(t.keys[i])); err != nil {
+				return stats, err
+			}
+			stats.Dropped++
+		}
+	}
+	if stats.Dropped == 0 {
+		return stats, nil
+	}
+	return stats, k.db.Compact()
+}
+
+// Close closes the database
+func (k *KVStore) Close() error {
+	return k.db.Close()
+}
+
+// walkFunc calls fn for the records under the keys in [start, end) until fn returns false
+type walkFunc func(start, end []byte, descending bool, fn func(Record) bool) error
+
+// scan collects a page of the records under prefix, walking the time keys in query order
+func (k *KVStore) scan(prefix string, q Query, walk walkFunc) ([]Record, error) {
+	from, to := q.timeBounds()
+	start := []byte(prefix)
+	if !from.IsZero() {
+		start = []byte(prefix + timeKey(from))
+	}
+	end := prefixEnd(prefix)
+	if !to.IsZero() {
+		// Every suffix of the last included timestamp sorts below "<time>0"
+		end = []byte(prefix + timeKey(to) + "0")
+	}
+
+	collector := &pageCollector{q: q}
+	if err := walk(start, end, q.Descending, collector.add); err != nil {
+		return nil, err
+	}
+	return collector.result(), nil
+}
+
+// walkRecords walks primary keys, whose values are the records
+func (k *KVStore) walkRecords(start, end []byte, descending bool, fn func(Record) bool) error {
+	walk := k.db.Ascend
+	if descending {
+		walk = k.db.Descend
+	}
+	var decodeErr error
+	err := walk(start, end, func(_, value []byte) bool {
+		var rec Record
+		rec, decodeErr = DecodeRecord(value)
+		return decodeErr == nil && fn(rec)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// walkIndex walks vessel index keys and loads the record each one points to.
+// The entries are read in batches and their records loaded after each batch,
+// as the database cannot be read from inside one of its own scans. Entries
+// whose record was deleted meanwhile are skipped.
+func (k *KVStore) walkIndex(start, end []byte, descending bool, fn func(Record) bool) error {
+	walk := k.db.Ascend
+	if descending {
+		walk = k.db.Descend
+	}
+	for {
+		var primaries [][]byte
+		var last []byte
+		err := walk(start, end, func(key, primary []byte) bool {
+			primaries = append(primaries, primary)
+			last = key
+			return len(primaries) < indexBatch
+		})
+		if err != nil {
+			return err
+		}
+		for _, primary := range primaries {
+			data, ok, err := k.db.Get(primary)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			rec, err := DecodeRecord(data)
+			if err != nil {
+				return err
+			}
+			if !fn(rec) {
+				return nil
+			}
+		}
+		if len(primaries) < indexBatch {
+			return nil
+		}
+		if descending {
+			end = last
+		} else {
+			start = append(last, 0)
+		}
+	}
+}
+
+// timeKey encodes t so that byte order matches chronological order
+func timeKey(t time.Time) string {
+	return fmt.Sprintf("%016x", uint64(t.UnixNano())^(1<<63))
+}
+
+func vesselPrefix(vesselID string) string {
+	return kvVesselPrefix + vesselID + "\x00"
+}
+
+// prefixEnd returns the smallest key greater than every key starting with prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	end[len(end)-1]++
+	return end
+}
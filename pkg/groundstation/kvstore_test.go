@@ -0,0 +1,104 @@
+package groundstation
+
+import (
+	"path/filepath"
+	"project3/pkg/common"
+	"project3/pkg/protocol"
+	"testing"
+	"time"
+)
+
+// testRecord is a position of a vessel, seconds after a fixed time
+func testRecord(vesselID string, id, seconds int) Record {
+	return Record{
+		Version:  1,
+		Envelope: Envelope{ID: id, Source: vesselID, Destination: "GroundStation", Priority: 5},
+		Position: protocol.PositionMessage{
+			Type:      protocol.PositionUpdate,
+			VesselID:  vesselID,
+			Latitude:  50 + float64(seconds)/1000,
+			Longitude: -4,
+			Timestamp: time.Date(2026, 10, 18, 6, 0, seconds, 0, time.UTC),
+		},
+	}
+}
+
+func openTestKVStore(t *testing.T, path string) *KVStore {
+	t.Helper()
+	store, err := OpenKVStore(common.StorageConfig{Path: path, Fsync: "always"})
+	if err != nil {
+		t.Fatalf("OpenKVStore: %v", err)
+	}
+	return store
+}
+
+func TestKVStoreRemovesDanglingIndexEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	store := openTestKVStore(t, path)
+	for i := 0; i < 3; i++ {
+		if err := store.Append(testRecord("Vessel-1", i+1, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash between the two writes of an append leaves only the index entry
+	rec := testRecord("Vessel-1", 4, 10)
+	suffix := timeKey(rec.Position.Timestamp) + "/00000000000000ff"
+	if err := store.db.Put([]byte(vesselPrefix("Vessel-1")+suffix), []byte(kvRecordPrefix+suffix)); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := store.Latest("Vessel-1", 2)
+	if err != nil {
+		t.Fatalf("Latest with a dangling entry: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Envelope.ID != 3 || latest[1].Envelope.ID != 2 {
+		t.Errorf("Latest = %+v, want records 3 and 2", latest)
+	}
+	store.Close()
+
+	store = openTestKVStore(t, path)
+	defer store.Close()
+	if _, ok, _ := store.db.Get([]byte(vesselPrefix("Vessel-1") + suffix)); ok {
+		t.Error("dangling index entry survived reopening")
+	}
+	records, err := store.Query(Query{VesselIDs: []string{"Vessel-1"}})
+	if err != nil || len(records) != 3 {
+		t.Errorf("Query = %d records, %v; want 3", len(records), err)
+	}
+}
+
+func TestKVStoreQueriesAcrossIndexBatches(t *testing.T) {
+	store := openTestKVStore(t, filepath.Join(t.TempDir(), "test.kv"))
+	defer store.Close()
+	n := 2*indexBatch + 10
+	for i := 0; i < n; i++ {
+		vessel := "Vessel-1"
+		if i%2 == 1 {
+			vessel = "Vessel-2"
+		}
+		if err := store.Append(testRecord(vessel, i+1, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, descending := range []bool{false, true} {
+		records, err := store.Query(Query{VesselIDs: []string{"Vessel-1"}, Descending: descending})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != n/2 {
+			t.Fatalf("descending=%v: %d records, want %d", descending, len(records), n/2)
+		}
+		for i := 1; i < len(records); i++ {
+			before := records[i-1].Position.Timestamp.Before(records[i].Position.Timestamp)
+			if before == descending {
+				t.Fatalf("descending=%v: records %d and %d out of order", descending, i-1, i)
+			}
+		}
+	}
+
+	latest, err := store.Latest("Vessel-2", 0)
+	if err != nil || len(latest) != n/2 {
+		t.Errorf("Latest = %d records, %v; want %d", len(latest), err, n/2)
+	}
+}
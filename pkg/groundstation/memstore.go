@@ -0,0 +1,93 @@
+package groundstation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in memory only. It is intended for tests and
+// short-lived simulations.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append stores a new record
+func (m *MemoryStore) Append(rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	return nil
+}
+
+// Vessels returns the IDs of all vessels with stored records, sorted
+func (m *MemoryStore) Vessels() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]bool)
+	var ids []string
+	for _, rec := range m.records {
+		if id := rec.Position.VesselID; !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Latest returns up to n of the most recent records for a vessel, newest first
+func (m *MemoryStore) Latest(vesselID string, n int) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return latestRecords(m.records, vesselID, n), nil
+}
+
+// Range returns all records with a position timestamp in [from, to], oldest first
+func (m *MemoryStore) Range(from, to time.Time) ([]Record, error) {
+	return m.Query(Query{From: from, To: to})
+}
+
+// Query returns the records matching q in the order it asks for
+func (m *MemoryStore) Query(q Query) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return selectRecords(m.records, q), nil
+}
+
+// Scan streams every stored record to fn in arrival order until fn returns false
+func (m *MemoryStore) Scan(fn func(rec Record) bool) error {
+	m.mu.RLock()
+	records := m.records
+	m.mu.RUnlock()
+	for _, rec := range records {
+		if !fn(rec) {
+			break
+		}
+	}
+	return nil
+}
+
+// ApplyRetention drops the records the policy no longer keeps
+func (m *MemoryStore) ApplyRetention(policy RetentionPolicy, now time.Time) (RetentionStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := RetentionStats{Examined: len(m.records)}
+	m.records = retainRecords(m.records, policy, now)
+	stats.Dropped = stats.Examined - len(m.records)
+	return stats, nil
+}
+
+// Close releases the stored records
+func (m *MemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = nil
+	return nil
+}
@@ -0,0 +1,86 @@
+package groundstation
+
+import (
+	"encoding/json"
+	"project3/pkg/wal"
+	"sync/atomic"
+	"time"
+)
+
+// QuarantinedReport is a report that failed authentication, kept for inspection
+type QuarantinedReport struct {
+	Record    Record `json:"record"`
+	Reason    string `json:"reason"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Quarantine keeps rejected reports in a log of their own, apart from the
+// stored positions, so that they never reach the fleet picture or the API
+type Quarantine struct {
+	count uint64 // First, for 64-bit alignment of the atomic
+	log   *wal.Log
+}
+
+// OpenQuarantine opens the quarantine log in dir, creating it if needed
+func OpenQuarantine(dir string) (*Quarantine, error) {
+	log, err := wal.Open(dir, wal.Options{SyncInterval: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	q := &Quarantine{log: log}
+	err = log.Replay(func(_ wal.Position, _ []byte) error {
+		q.count++
+		return nil
+	})
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Add quarantines a report
+func (q *Quarantine) Add(report QuarantinedReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if _, err := q.log.Append(data); err != nil {
+		return err
+	}
+	atomic.AddUint64(&q.count, 1)
+	return nil
+}
+
+// Len returns the number of quarantined reports
+func (q *Quarantine) Len() uint64 {
+	return atomic.LoadUint64(&q.count)
+}
+
+// List returns up to limit of the most recently quarantined reports, newest first
+func (q *Quarantine) List(limit int) ([]QuarantinedReport, error) {
+	reports := []QuarantinedReport{}
+	err := q.log.Replay(func(_ wal.Position, payload []byte) error {
+		var report QuarantinedReport
+		if err := json.Unmarshal(payload, &report); err != nil {
+			return err
+		}
+		reports = append(reports, report)
+		if len(reports) > limit {
+			reports = reports[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(reports)-1; i < j; i, j = i+1, j-1 {
+		reports[i], reports[j] = reports[j], reports[i]
+	}
+	return reports, nil
+}
+
+// Close flushes and closes the quarantine log
+func (q *Quarantine) Close() error {
+	return q.log.Close()
+}
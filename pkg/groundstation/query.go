@@ -0,0 +1,174 @@
+package groundstation
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects stored records. Zero-valued fields do not filter.
+type Query struct {
+	VesselIDs   []string
+	From        time.Time // Inclusive
+	To          time.Time // Inclusive
+	BBox        *BoundingBox
+	MinPriority *int
+	MaxPriority *int
+	After       *Cursor // Resume after this record, in the query's sort order
+	Descending  bool    // Newest first instead of oldest first
+	Limit       int
+}
+
+// Matches reports whether rec satisfies the query filters
+func (q Query) Matches(rec Record) bool {
+	if len(q.VesselIDs) > 0 && !containsString(q.VesselIDs, rec.Position.VesselID) {
+		return false
+	}
+	ts := rec.Position.Timestamp
+	if !q.From.IsZero() && ts.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && ts.After(q.To) {
+		return false
+	}
+	if q.BBox != nil && !q.BBox.Contains(rec.Position.Latitude, rec.Position.Longitude) {
+		return false
+	}
+	if q.MinPriority != nil && rec.Envelope.Priority < *q.MinPriority {
+		return false
+	}
+	if q.MaxPriority != nil && rec.Envelope.Priority > *q.MaxPriority {
+		return false
+	}
+	if q.After != nil {
+		key := CursorOf(rec)
+		if q.Descending && !key.Less(*q.After) || !q.Descending && !q.After.Less(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// timeBounds returns the time window to scan, narrowed by the cursor
+func (q Query) timeBounds() (from, to time.Time) {
+	from, to = q.From, q.To
+	if q.After != nil {
+		if q.Descending && (to.IsZero() || q.After.Time.Before(to)) {
+			to = q.After.Time
+		}
+		if !q.Descending && (from.IsZero() || q.After.Time.After(from)) {
+			from = q.After.Time
+		}
+	}
+	return from, to
+}
+
+// BoundingBox is a latitude/longitude rectangle. A box whose MinLon is greater
+// than its MaxLon crosses the antimeridian.
+type BoundingBox struct {
+	MinLat float64 `json:"minLat"`
+	MinLon float64 `json:"minLon"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLon float64 `json:"maxLon"`
+}
+
+// Contains reports whether a position lies inside the box
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
+
+// Cursor identifies a record's place in query order: records are ordered by
+// position timestamp, then vessel ID, then message ID, then receive sequence
+// number. Message IDs repeat (legacy records carry 0, feed reports a checksum),
+// so the sequence number is what keeps two records from sharing a place.
+type Cursor struct {
+	Time      time.Time
+	VesselID  string
+	MessageID int
+	Seq       uint64
+}
+
+// CursorOf returns the cursor of a record
+func CursorOf(rec Record) Cursor {
+	return Cursor{Time: rec.Position.Timestamp, VesselID: rec.Position.VesselID, MessageID: rec.Envelope.ID, Seq: rec.Receipt.Seq}
+}
+
+// Less reports whether c orders before other
+func (c Cursor) Less(other Cursor) bool {
+	if !c.Time.Equal(other.Time) {
+		return c.Time.Before(other.Time)
+	}
+	if c.VesselID != other.VesselID {
+		return c.VesselID < other.VesselID
+	}
+	if c.MessageID != other.MessageID {
+		return c.MessageID < other.MessageID
+	}
+	return c.Seq < other.Seq
+}
+
+// Encode returns the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d|%d|%d|%s", c.Time.UnixNano(), c.MessageID, c.Seq, c.VesselID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode
+func DecodeCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 4)
+	if len(parts) != 4 {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	seq, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+	return Cursor{Time: time.Unix(0, nanos).UTC(), VesselID: parts[3], MessageID: id, Seq: seq}, nil
+}
+
+// pageCollector gathers the matching records of a scan running in timestamp
+// order (ascending or descending, as the query asks). Once the page is full it
+// keeps going only through records sharing the last timestamp, whose final order
+// depends on the rest of their cursor.
+type pageCollector struct {
+	q        Query
+	records  []Record
+	lastTime time.Time
+}
+
+// add offers the next scanned record and reports whether the scan should continue
+func (c *pageCollector) add(rec Record) bool {
+	if c.q.Limit > 0 && len(c.records) >= c.q.Limit && !rec.Position.Timestamp.Equal(c.lastTime) {
+		return false
+	}
+	if c.q.Matches(rec) {
+		c.records = append(c.records, rec)
+		c.lastTime = rec.Position.Timestamp
+	}
+	return true
+}
+
+// result returns the page in query order
+func (c *pageCollector) result() []Record {
+	return selectRecords(c.records, c.q)
+}
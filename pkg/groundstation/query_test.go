@@ -0,0 +1,82 @@
+package groundstation
+
+import (
+	"path/filepath"
+	"project3/pkg/common"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	cursor := Cursor{Time: time.Date(2026, 10, 18, 6, 0, 0, 123, time.UTC), VesselID: "Vessel|7", MessageID: -3, Seq: 42}
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, cursor) {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+	for _, token := range []string{"", "!!", "MXwyfDM"} {
+		if _, err := DecodeCursor(token); err == nil {
+			t.Errorf("DecodeCursor(%q) succeeded", token)
+		}
+	}
+}
+
+// TestPagingThroughTies pages one record at a time through records that share
+// their timestamp, vessel and message ID, as feed reports can
+func TestPagingThroughTies(t *testing.T) {
+	dir := t.TempDir()
+	backends := map[string]func() (Store, error){
+		"memory": func() (Store, error) { return NewMemoryStore(), nil },
+		"file": func() (Store, error) {
+			return OpenFileStore(common.StorageConfig{Path: filepath.Join(dir, "log"), Fsync: "none"})
+		},
+		"kv": func() (Store, error) {
+			return OpenKVStore(common.StorageConfig{Path: filepath.Join(dir, "test.kv"), Fsync: "none"})
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			want := make(map[uint64]bool)
+			for i := 0; i < 6; i++ {
+				rec := testRecord("Vessel-1", 0, i/3)
+				rec.Receipt.Seq = nextSeq()
+				want[rec.Receipt.Seq] = true
+				if err := store.Append(rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, descending := range []bool{false, true} {
+				seen := make(map[uint64]bool)
+				q := Query{Limit: 1, Descending: descending}
+				for page := 0; page < 10; page++ {
+					records, err := store.Query(q)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(records) == 0 {
+						break
+					}
+					rec := records[0]
+					if seen[rec.Receipt.Seq] {
+						t.Fatalf("descending=%v: record %d returned twice", descending, rec.Receipt.Seq)
+					}
+					seen[rec.Receipt.Seq] = true
+					cursor := CursorOf(rec)
+					q.After = &cursor
+				}
+				if !reflect.DeepEqual(seen, want) {
+					t.Errorf("descending=%v: paged through %d of %d records", descending, len(seen), len(want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package groundstation
+
+import (
+	"encoding/json"
+	"fmt"
+	"project3/pkg/protocol"
+	"project3/pkg/satellite"
+	"sync/atomic"
+	"time"
+)
+
+// RecordVersion is the current version of the on-disk record format
+const RecordVersion = 1
+
+// legacyInitialTTL is the TTL the vessel simulator stamped on every message
+// before records carried their own hop count
+const legacyInitialTTL = 5
+
+// Record is the versioned on-disk representation of a received position
+type Record struct {
+	Version  int                      `json:"version"`
+	Envelope Envelope                 `json:"envelope"`
+	Position protocol.PositionMessage `json:"position"`
+	Receipt  Receipt                  `json:"receipt"`
+}
+
+// Envelope holds the routing fields of the satellite message that carried the position
+type Envelope struct {
+	ID          int    `json:"id"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Priority    int    `json:"priority"`
+	TTL         int    `json:"ttl"`
+}
+
+// Receipt describes how and when the ground station received a message
+type Receipt struct {
+	Satellite  string    `json:"satellite,omitempty"` // Satellite that delivered the message
+	Feed       string    `json:"feed,omitempty"`      // Feed that delivered the message instead, e.g. "tcp 10.0.0.5:40112"
+	Hops       int       `json:"hops"`
+	Verified   bool      `json:"verified,omitempty"` // The report's signature was verified
+	ReceivedAt time.Time `json:"receivedAt"`
+	Seq        uint64    `json:"seq,omitempty"` // Unique receive sequence number, missing on records stored before it existed
+}
+
+// lastSeq is the receive sequence number handed out last
+var lastSeq uint64
+
+// nextSeq returns a receive sequence number. Numbers start from the clock, so
+// they keep increasing across restarts without being persisted.
+func nextSeq() uint64 {
+	for {
+		last := atomic.LoadUint64(&lastSeq)
+		next := uint64(time.Now().UnixNano())
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&lastSeq, last, next) {
+			return next
+		}
+	}
+}
+
+// NewRecord builds a record from a satellite message received at the given time
+func NewRecord(msg satellite.Message, receivedAt time.Time) Record {
+	receipt := Receipt{
+		Hops:       len(msg.Path),
+		ReceivedAt: receivedAt,
+		Seq:        nextSeq(),
+	}
+	if len(msg.Path) > 0 {
+		receipt.Satellite = msg.Path[len(msg.Path)-1]
+	}
+	return Record{
+		Version:  RecordVersion,
+		Envelope: envelopeOf(msg),
+		Position: msg.Content,
+		Receipt:  receipt,
+	}
+}
+
+func envelopeOf(msg satellite.Message) Envelope {
+	return Envelope{
+		ID:          msg.ID,
+		Source:      msg.Source,
+		Destination: msg.Destination,
+		Priority:    msg.Priority,
+		TTL:         msg.TTL,
+	}
+}
+
+// recordProbe is used to detect which format a stored line was written in
+type recordProbe struct {
+	Version  int             `json:"version"`
+	Content  json.RawMessage `json:"content"`
+	VesselID string          `json:"vesselID"`
+}
+
+// DecodeRecord decodes a stored line, migrating legacy formats to the current record.
+// Two legacy shapes are understood: bare satellite.Message envelopes and bare
+// protocol.PositionMessage values.
+func DecodeRecord(line []byte) (Record, error) {
+	var probe recordProbe
+	if err := json.Unmarshal(line, &probe); err != nil {
+		return Record{}, err
+	}
+
+	switch {
+	case probe.Version > RecordVersion:
+		return Record{}, fmt.Errorf("unsupported record version %d", probe.Version)
+	case probe.Version > 0:
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return Record{}, err
+		}
+		return rec, nil
+	case probe.Content != nil:
+		var msg satellite.Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return Record{}, err
+		}
+		return migrateEnvelope(msg), nil
+	case probe.VesselID != "":
+		var pos protocol.PositionMessage
+		if err := json.Unmarshal(line, &pos); err != nil {
+			return Record{}, err
+		}
+		return migratePosition(pos), nil
+	default:
+		return Record{}, fmt.Errorf("unrecognized record format")
+	}
+}
+
+// migrateEnvelope upgrades a legacy satellite.Message line. The receive time was
+// never stored, so the position timestamp is the best available estimate.
+func migrateEnvelope(msg satellite.Message) Record {
+	hops := legacyInitialTTL - msg.TTL
+	if hops < 0 {
+		hops = 0
+	}
+	return Record{
+		Version:  RecordVersion,
+		Envelope: envelopeOf(msg),
+		Position: msg.Content,
+		Receipt: Receipt{
+			Hops:       hops,
+			ReceivedAt: msg.Content.Timestamp,
+		},
+	}
+}
+
+// migratePosition upgrades a legacy protocol.PositionMessage line, which carried no envelope
+func migratePosition(pos protocol.PositionMessage) Record {
+	return Record{
+		Version: RecordVersion,
+		Envelope: Envelope{
+			Source:      pos.VesselID,
+			Destination: "GroundStation",
+		},
+		Position: pos,
+		Receipt: Receipt{
+			ReceivedAt: pos.Timestamp,
+		},
+	}
+}
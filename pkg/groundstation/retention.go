@@ -0,0 +1,166 @@
+package groundstation
+
+import (
+	"project3/pkg/common"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy decides which stored positions are kept as they age. Rules are
+// applied in order; a zero duration disables a rule.
+type RetentionPolicy struct {
+	MaxAge             time.Duration // Drop records older than this
+	LatestOnlyAfter    time.Duration // Beyond this age, keep only each vessel's latest record
+	DownsampleAfter    time.Duration // Beyond this age, thin tracks...
+	DownsampleInterval time.Duration // ...to one record per interval
+}
+
+// RetentionPolicyFromConfig converts the retention settings of config.json
+func RetentionPolicyFromConfig(cfg common.RetentionConfig) RetentionPolicy {
+	day := 24 * time.Hour
+	return RetentionPolicy{
+		MaxAge:             time.Duration(cfg.MaxAgeDays) * day,
+		LatestOnlyAfter:    time.Duration(cfg.LatestOnlyAfterDays) * day,
+		DownsampleAfter:    time.Duration(cfg.DownsampleAfterDays) * day,
+		DownsampleInterval: time.Duration(cfg.DownsampleIntervalMinutes) * time.Minute,
+	}
+}
+
+// Enabled reports whether the policy ever drops records
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.LatestOnlyAfter > 0 || (p.DownsampleAfter > 0 && p.DownsampleInterval > 0)
+}
+
+// retainTrack decides which records of one vessel survive the policy. times holds
+// the record timestamps in Unix nanoseconds, sorted ascending.
+func (p RetentionPolicy) retainTrack(times []int64, now time.Time) []bool {
+	keep := make([]bool, len(times))
+	last := len(times) - 1
+	lastBucket, haveBucket := int64(0), false
+
+	for i, ts := range times {
+		age := now.Sub(time.Unix(0, ts))
+		switch {
+		case p.MaxAge > 0 && age > p.MaxAge:
+			keep[i] = false
+		case p.LatestOnlyAfter > 0 && age > p.LatestOnlyAfter:
+			keep[i] = i == last
+		case p.DownsampleAfter > 0 && p.DownsampleInterval > 0 && age > p.DownsampleAfter:
+			bucket := ts / int64(p.DownsampleInterval)
+			keep[i] = i == last || !haveBucket || bucket != lastBucket
+			if keep[i] {
+				lastBucket, haveBucket = bucket, true
+			}
+		default:
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+// RetentionStats summarizes one retention pass
+type RetentionStats struct {
+	Examined int
+	Dropped  int
+}
+
+// Retainer is implemented by stores that can enforce a retention policy
+type Retainer interface {
+	ApplyRetention(policy RetentionPolicy, now time.Time) (RetentionStats, error)
+}
+
+// Compactor periodically applies a retention policy to a store in the background
+type Compactor struct {
+	store    Retainer
+	policy   RetentionPolicy
+	interval time.Duration
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+// NewCompactor creates a compactor running every interval
+func NewCompactor(store Retainer, policy RetentionPolicy, interval time.Duration) *Compactor {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &Compactor{
+		store:    store,
+		policy:   policy,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs a first pass immediately and then one per interval
+func (c *Compactor) Start() {
+	c.done.Add(1)
+	go func() {
+		defer c.done.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.RunOnce()
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce applies the policy once
+func (c *Compactor) RunOnce() {
+	started := time.Now()
+	stats, err := c.store.ApplyRetention(c.policy, started)
+	if err != nil {
+		common.Logger.Printf("Retention pass failed: %v\n", err)
+		return
+	}
+	if stats.Dropped > 0 {
+		common.Logger.Printf("Retention pass dropped %d of %d records in %v\n", stats.Dropped, stats.Examined, time.Since(started))
+	}
+}
+
+// Stop halts the compactor and waits for a running pass to finish
+func (c *Compactor) Stop() {
+	close(c.stop)
+	c.done.Wait()
+}
+
+// retainRecords applies the policy to records held in memory, preserving their order
+func retainRecords(records []Record, policy RetentionPolicy, now time.Time) []Record {
+	// Group record indexes per vessel in timestamp order
+	ordered := make([]int, len(records))
+	for i := range ordered {
+		ordered[i] = i
+	}
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return records[ordered[a]].Position.Timestamp.Before(records[ordered[b]].Position.Timestamp)
+	})
+	tracks := make(map[string][]int)
+	for _, i := range ordered {
+		vessel := records[i].Position.VesselID
+		tracks[vessel] = append(tracks[vessel], i)
+	}
+
+	keep := make([]bool, len(records))
+	for _, track := range tracks {
+		times := make([]int64, len(track))
+		for j, i := range track {
+			times[j] = records[i].Position.Timestamp.UnixNano()
+		}
+		for j, kept := range policy.retainTrack(times, now) {
+			keep[track[j]] = kept
+		}
+	}
+
+	var retained []Record
+	for i, rec := range records {
+		if keep[i] {
+			retained = append(retained, rec)
+		}
+	}
+	return retained
+}
@@ -0,0 +1,132 @@
+package groundstation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetainTrack(t *testing.T) {
+	// Noon falls on a boundary of every downsample interval used below
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		ages   []time.Duration // Oldest first
+		want   []bool
+	}{
+		{
+			name:   "empty track",
+			policy: RetentionPolicy{MaxAge: time.Hour, LatestOnlyAfter: time.Minute},
+			want:   []bool{},
+		},
+		{
+			name: "no rules",
+			ages: []time.Duration{48 * time.Hour, time.Hour, 0},
+			want: []bool{true, true, true},
+		},
+		{
+			name:   "max age",
+			policy: RetentionPolicy{MaxAge: 2 * time.Hour},
+			ages:   []time.Duration{3 * time.Hour, 2*time.Hour + time.Nanosecond, 2 * time.Hour, time.Hour},
+			want:   []bool{false, false, true, true},
+		},
+		{
+			name:   "max age drops the last fix too",
+			policy: RetentionPolicy{MaxAge: 2 * time.Hour},
+			ages:   []time.Duration{4 * time.Hour, 3 * time.Hour},
+			want:   []bool{false, false},
+		},
+		{
+			name:   "latest only",
+			policy: RetentionPolicy{LatestOnlyAfter: 30 * time.Minute},
+			ages:   []time.Duration{2 * time.Hour, time.Hour, 30 * time.Minute, 10 * time.Minute},
+			want:   []bool{false, false, true, true},
+		},
+		{
+			name:   "latest only keeps the last fix",
+			policy: RetentionPolicy{LatestOnlyAfter: 30 * time.Minute},
+			ages:   []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour},
+			want:   []bool{false, false, true},
+		},
+		{
+			name:   "latest only keeps a single fix",
+			policy: RetentionPolicy{LatestOnlyAfter: 30 * time.Minute},
+			ages:   []time.Duration{48 * time.Hour},
+			want:   []bool{true},
+		},
+		{
+			name:   "max age before latest only",
+			policy: RetentionPolicy{MaxAge: 2 * time.Hour, LatestOnlyAfter: 30 * time.Minute},
+			ages:   []time.Duration{4 * time.Hour, 3 * time.Hour},
+			want:   []bool{false, false},
+		},
+		{
+			name:   "downsample",
+			policy: RetentionPolicy{DownsampleAfter: 40 * time.Minute, DownsampleInterval: 10 * time.Minute},
+			ages: []time.Duration{
+				60 * time.Minute, 58 * time.Minute, 52 * time.Minute, // 11:00 bucket
+				50 * time.Minute, 45 * time.Minute, // 11:10 bucket
+				40 * time.Minute, 30 * time.Minute, 29 * time.Minute, // Too recent
+			},
+			want: []bool{true, false, false, true, false, true, true, true},
+		},
+		{
+			name:   "downsample keeps the last fix",
+			policy: RetentionPolicy{DownsampleAfter: 40 * time.Minute, DownsampleInterval: 10 * time.Minute},
+			ages:   []time.Duration{50 * time.Minute, 48 * time.Minute, 45 * time.Minute},
+			want:   []bool{true, false, true},
+		},
+		{
+			name:   "downsample without an interval",
+			policy: RetentionPolicy{DownsampleAfter: 40 * time.Minute},
+			ages:   []time.Duration{50 * time.Minute, 48 * time.Minute, 45 * time.Minute},
+			want:   []bool{true, true, true},
+		},
+		{
+			name: "all rules",
+			policy: RetentionPolicy{
+				MaxAge:             24 * time.Hour,
+				LatestOnlyAfter:    6 * time.Hour,
+				DownsampleAfter:    time.Hour,
+				DownsampleInterval: 30 * time.Minute,
+			},
+			ages: []time.Duration{
+				48 * time.Hour,                // Too old
+				10 * time.Hour, 7 * time.Hour, // Not the latest
+				3 * time.Hour, 2*time.Hour + 50*time.Minute, // 09:00 bucket
+				2*time.Hour + 20*time.Minute, // 09:30 bucket
+				30 * time.Minute, 29 * time.Minute,
+			},
+			want: []bool{false, false, false, true, false, true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := make([]int64, len(tt.ages))
+			for i, age := range tt.ages {
+				times[i] = now.Add(-age).UnixNano()
+			}
+			if got := tt.policy.retainTrack(times, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retainTrack = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetainRecordsPreservesOrder(t *testing.T) {
+	now := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	records := []Record{
+		testRecord("Vessel-2", 1, 2),
+		testRecord("Vessel-1", 2, 1),
+		testRecord("Vessel-1", 3, 0),
+		testRecord("Vessel-2", 4, 0),
+	}
+	var ids []int
+	for _, rec := range retainRecords(records, RetentionPolicy{LatestOnlyAfter: time.Minute}, now) {
+		ids = append(ids, rec.Envelope.ID)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("retained %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,83 @@
+package groundstation
+
+import (
+	"errors"
+	"fmt"
+	"project3/pkg/common"
+	"sort"
+	"time"
+)
+
+// Store persists records received by the ground station
+type Store interface {
+	// Append stores a new record
+	Append(rec Record) error
+	// Vessels returns the IDs of all vessels with stored records, sorted
+	Vessels() ([]string, error)
+	// Latest returns up to n of the most recent records for a vessel, newest first
+	Latest(vesselID string, n int) ([]Record, error)
+	// Range returns all records with a position timestamp in [from, to], oldest first
+	Range(from, to time.Time) ([]Record, error)
+	// Query returns the records matching q in the order it asks for
+	Query(q Query) ([]Record, error)
+	// Scan streams every stored record to fn in storage order until fn returns false
+	Scan(fn func(rec Record) bool) error
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// errStopScan ends a scan early when the caller's callback returns false
+var errStopScan = errors.New("scan stopped")
+
+// OpenStore creates the store backend selected in the configuration
+func OpenStore(cfg common.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "file":
+		return OpenFileStore(cfg)
+	case "memory":
+		return NewMemoryStore(), nil
+	case "kv":
+		return OpenKVStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// selectRecords filters records by q and returns them in the order it asks for
+func selectRecords(records []Record, q Query) []Record {
+	var selected []Record
+	for _, rec := range records {
+		if q.Matches(rec) {
+			selected = append(selected, rec)
+		}
+	}
+	sortRecords(selected, q.Descending)
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	return selected
+}
+
+// latestRecords returns up to n of the newest records of a vessel, newest first
+func latestRecords(records []Record, vesselID string, n int) []Record {
+	return selectRecords(records, Query{VesselIDs: []string{vesselID}, Descending: true, Limit: n})
+}
+
+// sortRecords orders records by their cursor key, oldest first unless descending
+func sortRecords(records []Record, descending bool) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if descending {
+			return CursorOf(records[j]).Less(CursorOf(records[i]))
+		}
+		return CursorOf(records[i]).Less(CursorOf(records[j]))
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+// Package kvstore is a small embedded key-value store. Every write is appended to a
+// single data file and an in-memory sorted index maps keys to their latest value,
+// so point lookups and ordered range scans never touch unrelated data.
+package kvstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// headerSize is the size of an entry header: crc32, flags, key length, value length
+const headerSize = 4 + 1 + 4 + 4
+
+// Bounds of the lengths in an entry header, so that a corrupt header cannot trigger a huge allocation
+const (
+	maxKeySize   = 64 << 10
+	maxValueSize = 64 << 20
+)
+
+const flagDelete = 1
+
+// ErrClosed is returned by operations on a closed DB
+var ErrClosed = errors.New("kvstore: database is closed")
+
+// SyncPolicy controls when writes are flushed to stable storage
+type SyncPolicy string
+
+const (
+	SyncAlways SyncPolicy = "always" // fsync after every write
+	SyncBatch  SyncPolicy = "batch"  // fsync periodically in the background
+	SyncNone   SyncPolicy = "none"   // leave flushing to the operating system
+)
+
+// Options configures a database
+type Options struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // Flush interval for SyncBatch
+}
+
+// entry locates the value of a key inside the data file
+type entry struct {
+	offset int64 // Offset of the value
+	size   uint32
+}
+
+// DB is an open key-value database backed by a single append-only file
+type DB struct {
+	mu       sync.RWMutex
+	path     string
+	opts     Options
+	file     *os.File
+	size     int64
+	dirty    bool // Unsynced writes are pending
+	index    map[string]entry
+	keys     []string      // Sorted keys present in index
+	stop     chan struct{} // Closed to end the background sync loop
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Open opens or creates the database at path, rebuilding the index from the data
+// file. An incomplete or corrupt entry at the end of the file is truncated away.
+func Open(path string, opts Options) (*DB, error) {
+	if opts.Sync == "" {
+		opts.Sync = SyncBatch
+	}
+	if opts.Sync == SyncBatch && opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		path:  path,
+		opts:  opts,
+		file:  file,
+		index: make(map[string]entry),
+	}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if opts.Sync == SyncBatch {
+		db.stop = make(chan struct{})
+		db.done = make(chan struct{})
+		go db.syncLoop()
+	}
+	return db, nil
+}
+
+// load replays the data file into the index
+func (db *DB) load() error {
+	reader := bufio.NewReader(db.file)
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		keyLen := binary.BigEndian.Uint32(header[5:9])
+		valLen := binary.BigEndian.Uint32(header[9:13])
+		if keyLen > maxKeySize || valLen > maxValueSize {
+			break
+		}
+		body := make([]byte, int(keyLen)+int(valLen))
+		if _, err := io.ReadFull(reader, body); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(append(header[4:], body...)) != binary.BigEndian.Uint32(header[:4]) {
+			break
+		}
+		key := string(body[:keyLen])
+		if header[4]&flagDelete != 0 {
+			db.remove(key)
+		} else {
+			db.insert(key, entry{offset: offset + headerSize + int64(keyLen), size: valLen})
+		}
+		offset += headerSize + int64(len(body))
+	}
+
+	// Drop anything after the last complete entry
+	if info, err := db.file.Stat(); err == nil && info.Size() > offset {
+		log.Printf("kvstore: truncating %s from %d to %d bytes", db.path, info.Size(), offset)
+		if err := db.file.Truncate(offset); err != nil {
+			return err
+		}
+		if err := db.file.Sync(); err != nil {
+			return err
+		}
+	}
+	db.size = offset
+	return nil
+}
+
+// Put stores value under key, replacing any previous value
+func (db *DB) Put(key, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	offset, err := db.write(0, key, value)
+	if err != nil {
+		return err
+	}
+	db.insert(string(key), entry{offset: offset, size: uint32(len(value))})
+	return db.synced()
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (db *DB) Delete(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	if _, exists := db.index[string(key)]; !exists {
+		return nil
+	}
+	if _, err := db.write(flagDelete, key, nil); err != nil {
+		return err
+	}
+	db.remove(string(key))
+	return db.synced()
+}
+
+// Get returns the value stored under key
+func (db *DB) Get(key []byte) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.file == nil {
+		return nil, false, ErrClosed
+	}
+	e, exists := db.index[string(key)]
+	if !exists {
+		return nil, false, nil
+	}
+	value, err := db.read(e)
+	return value, err == nil, err
+}
+
+// Ascend calls fn for every key in [start, end) in ascending order until fn returns false.
+// A nil end means no upper bound.
+func (db *DB) Ascend(start, end []byte, fn func(key, value []byte) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	for i := sort.SearchStrings(db.keys, string(start)); i < len(db.keys); i++ {
+		key := db.keys[i]
+		if end != nil && key >= string(end) {
+			break
+		}
+		value, err := db.read(db.index[key])
+		if err != nil {
+			return err
+		}
+		if !fn([]byte(key), value) {
+			break
+		}
+	}
+	return nil
+}
+
+// Descend calls fn for every key in [start, end) in descending order until fn returns false.
+// A nil end means no upper bound.
+func (db *DB) Descend(start, end []byte, fn func(key, value []byte) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	i := len(db.keys)
+	if end != nil {
+		i = sort.SearchStrings(db.keys, string(end))
+	}
+	for i--; i >= 0; i-- {
+		key := db.keys[i]
+		if key < string(start) {
+			break
+		}
+		value, err := db.read(db.index[key])
+		if err != nil {
+			return err
+		}
+		if !fn([]byte(key), value) {
+			break
+		}
+	}
+	return nil
+}
+
+// Len returns the number of live keys
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.keys)
+}
+
+// Sync flushes the data file to stable storage
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	return db.syncLocked()
+}
+
+// synced flushes a write under SyncAlways and leaves it to the background
+// loop otherwise; db.mu must be held
+func (db *DB) synced() error {
+	db.dirty = true
+	if db.opts.Sync != SyncAlways {
+		return nil
+	}
+	return db.syncLocked()
+}
+
+func (db *DB) syncLocked() error {
+	if !db.dirty {
+		return nil
+	}
+	if err := db.file.Sync(); err != nil {
+		return fmt.Errorf("kvstore: sync failed: %w", err)
+	}
+	db.dirty = false
+	return nil
+}
+
+func (db *DB) syncLoop() {
+	defer close(db.done)
+	ticker := time.NewTicker(db.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			db.mu.Lock()
+			if db.file != nil {
+				if err := db.syncLocked(); err != nil {
+					log.Printf("kvstore: background sync failed: %v", err)
+				}
+			}
+			db.mu.Unlock()
+		}
+	}
+}
+
+// Compact rewrites the data file so that it only holds live values
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	compacted := &DB{file: tmp, index: make(map[string]entry, len(db.index))}
+	for _, key := range db.keys {
+		value, err := db.read(db.index[key])
+		if err == nil {
+			var offset int64
+			offset, err = compacted.write(0, []byte(key), value)
+			compacted.index[key] = entry{offset: offset, size: uint32(len(value))}
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	db.file.Close()
+	db.file = tmp
+	db.size = compacted.size
+	db.index = compacted.index
+	db.dirty = false
+	return syncDir(filepath.Dir(db.path))
+}
+
+// Close closes the database
+func (db *DB) Close() error {
+	db.stopOnce.Do(func() {
+		if db.stop != nil {
+			close(db.stop)
+			<-db.done
+		}
+	})
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return nil
+	}
+	err := db.file.Sync()
+	if cerr := db.file.Close(); err == nil {
+		err = cerr
+	}
+	db.file = nil
+	return err
+}
+
+// write appends an entry and returns the offset of its value
+func (db *DB) write(flags byte, key, value []byte) (int64, error) {
+	if len(key) > maxKeySize || len(value) > maxValueSize {
+		return 0, fmt.Errorf("kvstore: entry of %d+%d bytes exceeds limit", len(key), len(value))
+	}
+	buf := make([]byte, headerSize+len(key)+len(value))
+	buf[4] = flags
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(value)))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(buf[:4], crc32.ChecksumIEEE(buf[4:]))
+
+	if _, err := db.file.WriteAt(buf, db.size); err != nil {
+		return 0, fmt.Errorf("kvstore: write failed: %w", err)
+	}
+	offset := db.size + headerSize + int64(len(key))
+	db.size += int64(len(buf))
+	return offset, nil
+}
+
+func (db *DB) read(e entry) ([]byte, error) {
+	value := make([]byte, e.size)
+	if _, err := db.file.ReadAt(value, e.offset); err != nil {
+		return nil, fmt.Errorf("kvstore: read failed: %w", err)
+	}
+	return value, nil
+}
+
+// insert records key in the index, keeping keys sorted
+func (db *DB) insert(key string, e entry) {
+	if _, exists := db.index[key]; !exists {
+		i := sort.SearchStrings(db.keys, key)
+		db.keys = append(db.keys, "")
+		copy(db.keys[i+1:], db.keys[i:])
+		db.keys[i] = key
+	}
+	db.index[key] = e
+}
+
+func (db *DB) remove(key string) {
+	if _, exists := db.index[key]; !exists {
+		return
+	}
+	delete(db.index, key)
+	i := sort.SearchStrings(db.keys, key)
+	db.keys = append(db.keys[:i], db.keys[i+1:]...)
+}
+
+// syncDir flushes directory metadata so that a renamed file survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
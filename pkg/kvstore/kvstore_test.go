@@ -0,0 +1,209 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTest(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path, Options{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return db
+}
+
+func mustPut(t *testing.T, db *DB, key, value string) {
+	t.Helper()
+	if err := db.Put([]byte(key), []byte(value)); err != nil {
+		t.Fatalf("Put %s: %v", key, err)
+	}
+}
+
+// contents returns every key and value of db in ascending order
+func contents(t *testing.T, db *DB) []string {
+	t.Helper()
+	var kvs []string
+	err := db.Ascend(nil, nil, func(key, value []byte) bool {
+		kvs = append(kvs, string(key)+"="+string(value))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kvs
+}
+
+func TestReopenRestoresEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db := openTest(t, path)
+	mustPut(t, db, "b", "1")
+	mustPut(t, db, "a", "2")
+	mustPut(t, db, "b", "3")
+	mustPut(t, db, "c", "4")
+	if err := db.Delete([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTest(t, path)
+	defer db.Close()
+	if got, want := contents(t, db), []string{"a=2", "b=3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("contents = %v, want %v", got, want)
+	}
+}
+
+func TestOpenTruncatesDamagedTail(t *testing.T) {
+	damage := map[string]func(data []byte, last int) []byte{
+		"torn entry": func(data []byte, last int) []byte {
+			return data[:len(data)-2]
+		},
+		"corrupt checksum": func(data []byte, last int) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		},
+		"oversized key": func(data []byte, last int) []byte {
+			binary.BigEndian.PutUint32(data[last+5:], maxKeySize+1)
+			return data
+		},
+		"oversized value": func(data []byte, last int) []byte {
+			binary.BigEndian.PutUint32(data[last+9:], 0xffffffff)
+			return data
+		},
+	}
+	for name, fn := range damage {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.kv")
+			db := openTest(t, path)
+			mustPut(t, db, "a", "1")
+			mustPut(t, db, "b", "2")
+			last := int(db.size)
+			mustPut(t, db, "c", "3")
+			db.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, fn(data, last), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db = openTest(t, path)
+			if got, want := contents(t, db), []string{"a=1", "b=2"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("contents = %v, want %v", got, want)
+			}
+			if info, err := os.Stat(path); err != nil || info.Size() != int64(last) {
+				t.Errorf("file not truncated to %d bytes: %v, %v", last, info.Size(), err)
+			}
+
+			// New entries go after the truncation point and survive another reopen
+			mustPut(t, db, "d", "4")
+			db.Close()
+			db = openTest(t, path)
+			defer db.Close()
+			if got, want := contents(t, db), []string{"a=1", "b=2", "d=4"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("contents after reopen = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPutRejectsOversizedEntries(t *testing.T) {
+	db := openTest(t, filepath.Join(t.TempDir(), "test.kv"))
+	defer db.Close()
+	if err := db.Put(make([]byte, maxKeySize+1), nil); err == nil {
+		t.Error("Put of an oversized key succeeded")
+	}
+	if got := contents(t, db); len(got) != 0 {
+		t.Errorf("contents = %v, want none", got)
+	}
+}
+
+func TestRangeScans(t *testing.T) {
+	db := openTest(t, filepath.Join(t.TempDir(), "test.kv"))
+	defer db.Close()
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1", "c/1"} {
+		mustPut(t, db, key, "x")
+	}
+
+	var asc, desc []string
+	db.Ascend([]byte("a/2"), []byte("b/2"), func(key, _ []byte) bool {
+		asc = append(asc, string(key))
+		return true
+	})
+	db.Descend([]byte("a/2"), []byte("b/2"), func(key, _ []byte) bool {
+		desc = append(desc, string(key))
+		return true
+	})
+	if want := []string{"a/2", "a/3", "b/1"}; !reflect.DeepEqual(asc, want) {
+		t.Errorf("Ascend = %v, want %v", asc, want)
+	}
+	if want := []string{"b/1", "a/3", "a/2"}; !reflect.DeepEqual(desc, want) {
+		t.Errorf("Descend = %v, want %v", desc, want)
+	}
+
+	var first []string
+	db.Ascend(nil, nil, func(key, _ []byte) bool {
+		first = append(first, string(key))
+		return len(first) < 2
+	})
+	if want := []string{"a/1", "a/2"}; !reflect.DeepEqual(first, want) {
+		t.Errorf("stopped Ascend = %v, want %v", first, want)
+	}
+}
+
+func TestCompactDropsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db := openTest(t, path)
+	for i := 0; i < 100; i++ {
+		mustPut(t, db, fmt.Sprintf("k%02d", i%10), fmt.Sprintf("v%d", i))
+	}
+	db.Delete([]byte("k00"))
+	before := db.size
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if db.size >= before {
+		t.Errorf("size %d after compaction, was %d", db.size, before)
+	}
+	want := contents(t, db)
+	if len(want) != 9 || want[0] != "k01=v91" {
+		t.Errorf("contents = %v", want)
+	}
+
+	// The compacted file is the one written to and reopened
+	mustPut(t, db, "k00", "new")
+	db.Close()
+	db = openTest(t, path)
+	defer db.Close()
+	want = append([]string{"k00=new"}, want...)
+	if got := contents(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("contents after reopen = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestClosedDB(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.kv"), Options{Sync: SyncBatch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "a", "1")
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := db.Put([]byte("b"), nil); err != ErrClosed {
+		t.Errorf("Put after Close = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,746 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupportedAISType is returned for AIS message types this package does not decode
+var ErrUnsupportedAISType = errors.New("unsupported AIS message type")
+
+// AISMessage is a decoded AIS message. Optional quantities are pointers that
+// are nil when the transmitter reports them as not available.
+type AISMessage interface {
+	Header() AISHeader
+}
+
+// AISHeader is common to every AIS message
+type AISHeader struct {
+	Type   uint8  // Message type, 1 to 27
+	Repeat uint8  // How many times the message was repeated
+	MMSI   uint32 // Maritime Mobile Service Identity of the sender
+}
+
+// Header returns the header, making every message embedding it an AISMessage
+func (h AISHeader) Header() AISHeader {
+	return h
+}
+
+// NavigationStatus is the navigational status of a class A vessel
+type NavigationStatus uint8
+
+const (
+	UnderWayUsingEngine NavigationStatus = iota
+	AtAnchor
+	NotUnderCommand
+	RestrictedManeuverability
+	ConstrainedByDraught
+	Moored
+	Aground
+	EngagedInFishing
+	UnderWaySailing
+	AISSARTActive       NavigationStatus = 14
+	NavigationUndefined NavigationStatus = 15
+)
+
+func (s NavigationStatus) String() string {
+	switch s {
+	case UnderWayUsingEngine:
+		return "under way using engine"
+	case AtAnchor:
+		return "at anchor"
+	case NotUnderCommand:
+		return "not under command"
+	case RestrictedManeuverability:
+		return "restricted maneuverability"
+	case ConstrainedByDraught:
+		return "constrained by draught"
+	case Moored:
+		return "moored"
+	case Aground:
+		return "aground"
+	case EngagedInFishing:
+		return "engaged in fishing"
+	case UnderWaySailing:
+		return "under way sailing"
+	case AISSARTActive:
+		return "AIS-SART active"
+	case NavigationUndefined:
+		return "not defined"
+	}
+	return "reserved (" + strconv.Itoa(int(s)) + ")"
+}
+
+// ShipType is the AIS type of ship and cargo
+type ShipType uint8
+
+func (t ShipType) String() string {
+	switch {
+	case t == 0:
+		return "not available"
+	case t >= 20 && t <= 29:
+		return "wing in ground"
+	case t == 30:
+		return "fishing"
+	case t == 31 || t == 32:
+		return "towing"
+	case t == 33:
+		return "dredging or underwater operations"
+	case t == 34:
+		return "diving operations"
+	case t == 35:
+		return "military operations"
+	case t == 36:
+		return "sailing"
+	case t == 37:
+		return "pleasure craft"
+	case t >= 40 && t <= 49:
+		return "high speed craft"
+	case t == 50:
+		return "pilot vessel"
+	case t == 51:
+		return "search and rescue vessel"
+	case t == 52:
+		return "tug"
+	case t == 53:
+		return "port tender"
+	case t == 54:
+		return "anti-pollution equipment"
+	case t == 55:
+		return "law enforcement"
+	case t == 58:
+		return "medical transport"
+	case t == 59:
+		return "noncombatant ship"
+	case t >= 60 && t <= 69:
+		return "passenger"
+	case t >= 70 && t <= 79:
+		return "cargo"
+	case t >= 80 && t <= 89:
+		return "tanker"
+	case t >= 90 && t <= 99:
+		return "other"
+	}
+	return "reserved (" + strconv.Itoa(int(t)) + ")"
+}
+
+// Dimensions locate the position reference point on the hull, in meters
+type Dimensions struct {
+	ToBow       int `json:"toBow"`
+	ToStern     int `json:"toStern"`
+	ToPort      int `json:"toPort"`
+	ToStarboard int `json:"toStarboard"`
+}
+
+// Length returns the overall length in meters, 0 if unknown
+func (d Dimensions) Length() int {
+	return d.ToBow + d.ToStern
+}
+
+// Beam returns the overall beam in meters, 0 if unknown
+func (d Dimensions) Beam() int {
+	return d.ToPort + d.ToStarboard
+}
+
+// PositionReport is a class A position report, message types 1, 2 and 3
+type PositionReport struct {
+	AISHeader
+	NavStatus        NavigationStatus
+	RateOfTurn       *float64 // Degrees per minute, positive to starboard; ±720 when turning faster than 5° per 30 s
+	SpeedOverGround  *float64 // Knots; 102.2 means 102.2 knots or more
+	Accuracy         bool     // Position accurate to better than 10 m
+	Longitude        *float64 // Degrees
+	Latitude         *float64 // Degrees
+	CourseOverGround *float64 // Degrees true
+	Heading          *int     // Degrees true
+	Second           uint8    // UTC second of the fix; 60 and above when unavailable
+	Maneuver         uint8    // Special maneuver indicator
+	RAIM             bool
+	Radio            uint32 // Communication state
+}
+
+// ClassBPositionReport is a standard class B position report, message type 18
+type ClassBPositionReport struct {
+	AISHeader
+	SpeedOverGround  *float64
+	Accuracy         bool
+	Longitude        *float64
+	Latitude         *float64
+	CourseOverGround *float64
+	Heading          *int
+	Second           uint8
+	CarrierSense     bool // Class B "CS" unit rather than SOTDMA
+	Display          bool
+	DSC              bool
+	Band             bool
+	Message22        bool
+	Assigned         bool
+	RAIM             bool
+	Radio            uint32
+}
+
+// ExtendedClassBPositionReport is a class B position report with static data, message type 19
+type ExtendedClassBPositionReport struct {
+	AISHeader
+	SpeedOverGround  *float64
+	Accuracy         bool
+	Longitude        *float64
+	Latitude         *float64
+	CourseOverGround *float64
+	Heading          *int
+	Second           uint8
+	Name             string
+	ShipType         ShipType
+	Dimensions       Dimensions
+	EPFD             uint8 // Type of position fixing device
+	RAIM             bool
+	DTE              bool // Data terminal not ready
+	Assigned         bool
+}
+
+// StaticVoyageData is class A static and voyage related data, message type 5
+type StaticVoyageData struct {
+	AISHeader
+	AISVersion  uint8
+	IMO         uint32
+	CallSign    string
+	Name        string
+	ShipType    ShipType
+	Dimensions  Dimensions
+	EPFD        uint8
+	ETAMonth    uint8   // 0 when not available
+	ETADay      uint8   // 0 when not available
+	ETAHour     uint8   // 24 when not available
+	ETAMinute   uint8   // 60 when not available
+	Draught     float64 // Meters
+	Destination string
+	DTE         bool
+}
+
+// StaticDataReport is class B static data, message type 24. Part A carries the
+// name; part B the remaining fields.
+type StaticDataReport struct {
+	AISHeader
+	PartNumber uint8 // 0 for part A, 1 for part B
+
+	// Part A
+	Name string
+
+	// Part B
+	ShipType     ShipType
+	VendorID     string // Manufacturer ID
+	Model        uint8
+	Serial       uint32
+	CallSign     string
+	Dimensions   Dimensions
+	MothershipID uint32 // Instead of dimensions, for auxiliary craft (MMSI 98XXXYYYY)
+	EPFD         uint8
+}
+
+// IsAuxiliaryCraft reports whether the MMSI belongs to a craft associated with a parent ship
+func IsAuxiliaryCraft(mmsi uint32) bool {
+	return mmsi/10000000 == 98
+}
+
+// Bit lengths of the supported messages. Shorter payloads are accepted down to
+// the minimum, as many transmitters omit trailing spare bits.
+var aisMinimumBits = map[uint8]int{1: 168, 2: 168, 3: 168, 5: 420, 18: 168, 19: 312, 24: 160}
+
+// DecodeAIS decodes the armored payload of a complete AIVDM/AIVDO message
+func DecodeAIS(payload string, fillBits int) (AISMessage, error) {
+	b, err := dearmor(payload, fillBits)
+	if err != nil {
+		return nil, err
+	}
+	if b.len < 38 {
+		return nil, fmt.Errorf("AIS message too short: %d bits", b.len)
+	}
+	header := AISHeader{Type: uint8(b.uint(0, 6)), Repeat: uint8(b.uint(6, 2)), MMSI: uint32(b.uint(8, 30))}
+	minimum, supported := aisMinimumBits[header.Type]
+	if !supported {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedAISType, header.Type)
+	}
+	if b.len < minimum {
+		return nil, fmt.Errorf("AIS message type %d too short: %d bits, need %d", header.Type, b.len, minimum)
+	}
+
+	switch header.Type {
+	case 1, 2, 3:
+		return PositionReport{
+			AISHeader:        header,
+			NavStatus:        NavigationStatus(b.uint(38, 4)),
+			RateOfTurn:       decodeRateOfTurn(b.int(42, 8)),
+			SpeedOverGround:  decodeSpeed(b.uint(50, 10)),
+			Accuracy:         b.bool(60),
+			Longitude:        decodeCoordinate(b.int(61, 28), 181),
+			Latitude:         decodeCoordinate(b.int(89, 27), 91),
+			CourseOverGround: decodeCourse(b.uint(116, 12)),
+			Heading:          decodeHeading(b.uint(128, 9)),
+			Second:           uint8(b.uint(137, 6)),
+			Maneuver:         uint8(b.uint(143, 2)),
+			RAIM:             b.bool(148),
+			Radio:            uint32(b.uint(149, 19)),
+		}, nil
+	case 18:
+		return ClassBPositionReport{
+			AISHeader:        header,
+			SpeedOverGround:  decodeSpeed(b.uint(46, 10)),
+			Accuracy:         b.bool(56),
+			Longitude:        decodeCoordinate(b.int(57, 28), 181),
+			Latitude:         decodeCoordinate(b.int(85, 27), 91),
+			CourseOverGround: decodeCourse(b.uint(112, 12)),
+			Heading:          decodeHeading(b.uint(124, 9)),
+			Second:           uint8(b.uint(133, 6)),
+			CarrierSense:     b.bool(141),
+			Display:          b.bool(142),
+			DSC:              b.bool(143),
+			Band:             b.bool(144),
+			Message22:        b.bool(145),
+			Assigned:         b.bool(146),
+			RAIM:             b.bool(147),
+			Radio:            uint32(b.uint(148, 20)),
+		}, nil
+	case 19:
+		return ExtendedClassBPositionReport{
+			AISHeader:        header,
+			SpeedOverGround:  decodeSpeed(b.uint(46, 10)),
+			Accuracy:         b.bool(56),
+			Longitude:        decodeCoordinate(b.int(57, 28), 181),
+			Latitude:         decodeCoordinate(b.int(85, 27), 91),
+			CourseOverGround: decodeCourse(b.uint(112, 12)),
+			Heading:          decodeHeading(b.uint(124, 9)),
+			Second:           uint8(b.uint(133, 6)),
+			Name:             b.text(143, 20),
+			ShipType:         ShipType(b.uint(263, 8)),
+			Dimensions:       decodeDimensions(b, 271),
+			EPFD:             uint8(b.uint(301, 4)),
+			RAIM:             b.bool(305),
+			DTE:              b.bool(306),
+			Assigned:         b.bool(307),
+		}, nil
+	case 5:
+		return StaticVoyageData{
+			AISHeader:   header,
+			AISVersion:  uint8(b.uint(38, 2)),
+			IMO:         uint32(b.uint(40, 30)),
+			CallSign:    b.text(70, 7),
+			Name:        b.text(112, 20),
+			ShipType:    ShipType(b.uint(232, 8)),
+			Dimensions:  decodeDimensions(b, 240),
+			EPFD:        uint8(b.uint(270, 4)),
+			ETAMonth:    uint8(b.uint(274, 4)),
+			ETADay:      uint8(b.uint(278, 5)),
+			ETAHour:     uint8(b.uint(283, 5)),
+			ETAMinute:   uint8(b.uint(288, 6)),
+			Draught:     float64(b.uint(294, 8)) / 10,
+			Destination: b.text(302, 20),
+			DTE:         b.bool(422),
+		}, nil
+	case 24:
+		report := StaticDataReport{AISHeader: header, PartNumber: uint8(b.uint(38, 2))}
+		switch report.PartNumber {
+		case 0:
+			report.Name = b.text(40, 20)
+		case 1:
+			if b.len < 168 {
+				return nil, fmt.Errorf("AIS message type 24 part B too short: %d bits", b.len)
+			}
+			report.ShipType = ShipType(b.uint(40, 8))
+			report.VendorID = b.text(48, 3)
+			report.Model = uint8(b.uint(66, 4))
+			report.Serial = uint32(b.uint(70, 20))
+			report.CallSign = b.text(90, 7)
+			if IsAuxiliaryCraft(header.MMSI) {
+				report.MothershipID = uint32(b.uint(132, 30))
+			} else {
+				report.Dimensions = decodeDimensions(b, 132)
+			}
+			report.EPFD = uint8(b.uint(162, 4))
+		default:
+			return nil, fmt.Errorf("invalid AIS message type 24 part number %d", report.PartNumber)
+		}
+		return report, nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnsupportedAISType, header.Type)
+}
+
+// EncodeAIS encodes a message into an armored AIVDM payload
+func EncodeAIS(msg AISMessage) (payload string, fillBits int, err error) {
+	b := &bitBuffer{}
+	putHeader := func(h AISHeader, want ...uint8) error {
+		for _, t := range want {
+			if h.Type == t {
+				b.putUint(uint64(h.Type), 6)
+				b.putUint(uint64(h.Repeat), 2)
+				b.putUint(uint64(h.MMSI), 30)
+				return nil
+			}
+		}
+		return fmt.Errorf("message type %d does not match %T", h.Type, msg)
+	}
+
+	switch m := msg.(type) {
+	case PositionReport:
+		if err := putHeader(m.AISHeader, 1, 2, 3); err != nil {
+			return "", 0, err
+		}
+		b.putUint(uint64(m.NavStatus), 4)
+		b.putInt(encodeRateOfTurn(m.RateOfTurn), 8)
+		b.putUint(encodeSpeed(m.SpeedOverGround), 10)
+		b.putBool(m.Accuracy)
+		b.putInt(encodeCoordinate(m.Longitude, 181), 28)
+		b.putInt(encodeCoordinate(m.Latitude, 91), 27)
+		b.putUint(encodeCourse(m.CourseOverGround), 12)
+		b.putUint(encodeHeading(m.Heading), 9)
+		b.putUint(uint64(m.Second), 6)
+		b.putUint(uint64(m.Maneuver), 2)
+		b.putUint(0, 3)
+		b.putBool(m.RAIM)
+		b.putUint(uint64(m.Radio), 19)
+	case ClassBPositionReport:
+		if err := putHeader(m.AISHeader, 18); err != nil {
+			return "", 0, err
+		}
+		b.putUint(0, 8)
+		b.putUint(encodeSpeed(m.SpeedOverGround), 10)
+		b.putBool(m.Accuracy)
+		b.putInt(encodeCoordinate(m.Longitude, 181), 28)
+		b.putInt(encodeCoordinate(m.Latitude, 91), 27)
+		b.putUint(encodeCourse(m.CourseOverGround), 12)
+		b.putUint(encodeHeading(m.Heading), 9)
+		b.putUint(uint64(m.Second), 6)
+		b.putUint(0, 2)
+		for _, flag := range []bool{m.CarrierSense, m.Display, m.DSC, m.Band, m.Message22, m.Assigned, m.RAIM} {
+			b.putBool(flag)
+		}
+		b.putUint(uint64(m.Radio), 20)
+	case ExtendedClassBPositionReport:
+		if err := putHeader(m.AISHeader, 19); err != nil {
+			return "", 0, err
+		}
+		b.putUint(0, 8)
+		b.putUint(encodeSpeed(m.SpeedOverGround), 10)
+		b.putBool(m.Accuracy)
+		b.putInt(encodeCoordinate(m.Longitude, 181), 28)
+		b.putInt(encodeCoordinate(m.Latitude, 91), 27)
+		b.putUint(encodeCourse(m.CourseOverGround), 12)
+		b.putUint(encodeHeading(m.Heading), 9)
+		b.putUint(uint64(m.Second), 6)
+		b.putUint(0, 4)
+		b.putText(m.Name, 20)
+		b.putUint(uint64(m.ShipType), 8)
+		encodeDimensions(b, m.Dimensions)
+		b.putUint(uint64(m.EPFD), 4)
+		b.putBool(m.RAIM)
+		b.putBool(m.DTE)
+		b.putBool(m.Assigned)
+		b.putUint(0, 4)
+	case StaticVoyageData:
+		if err := putHeader(m.AISHeader, 5); err != nil {
+			return "", 0, err
+		}
+		b.putUint(uint64(m.AISVersion), 2)
+		b.putUint(uint64(m.IMO), 30)
+		b.putText(m.CallSign, 7)
+		b.putText(m.Name, 20)
+		b.putUint(uint64(m.ShipType), 8)
+		encodeDimensions(b, m.Dimensions)
+		b.putUint(uint64(m.EPFD), 4)
+		b.putUint(uint64(m.ETAMonth), 4)
+		b.putUint(uint64(m.ETADay), 5)
+		b.putUint(uint64(m.ETAHour), 5)
+		b.putUint(uint64(m.ETAMinute), 6)
+		b.putUint(uint64(math.Min(math.Round(m.Draught*10), 255)), 8)
+		b.putText(m.Destination, 20)
+		b.putBool(m.DTE)
+		b.putUint(0, 1)
+	case StaticDataReport:
+		if err := putHeader(m.AISHeader, 24); err != nil {
+			return "", 0, err
+		}
+		b.putUint(uint64(m.PartNumber), 2)
+		switch m.PartNumber {
+		case 0:
+			b.putText(m.Name, 20)
+			b.putUint(0, 8)
+		case 1:
+			b.putUint(uint64(m.ShipType), 8)
+			b.putText(m.VendorID, 3)
+			b.putUint(uint64(m.Model), 4)
+			b.putUint(uint64(m.Serial), 20)
+			b.putText(m.CallSign, 7)
+			if IsAuxiliaryCraft(m.MMSI) {
+				b.putUint(uint64(m.MothershipID), 30)
+			} else {
+				encodeDimensions(b, m.Dimensions)
+			}
+			b.putUint(uint64(m.EPFD), 4)
+			b.putUint(0, 2)
+		default:
+			return "", 0, fmt.Errorf("invalid AIS message type 24 part number %d", m.PartNumber)
+		}
+	default:
+		return "", 0, fmt.Errorf("%w: %T", ErrUnsupportedAISType, msg)
+	}
+	payload, fillBits = b.armor()
+	return payload, fillBits, nil
+}
+
+// Field codecs. Each maps the "not available" value of its field to nil.
+
+func decodeRateOfTurn(raw int64) *float64 {
+	if raw == -128 {
+		return nil
+	}
+	rot := math.Pow(float64(raw)/4.733, 2)
+	if raw == 127 || raw == -127 {
+		rot = 720 // Turning faster than 5° per 30 s, no turn indicator
+	}
+	if raw < 0 {
+		rot = -rot
+	}
+	return &rot
+}
+
+func encodeRateOfTurn(rot *float64) int64 {
+	if rot == nil {
+		return -128
+	}
+	raw := math.Min(math.Round(4.733*math.Sqrt(math.Abs(*rot))), 126)
+	if math.Abs(*rot) >= 720 {
+		raw = 127
+	}
+	if *rot < 0 {
+		return -int64(raw)
+	}
+	return int64(raw)
+}
+
+func decodeSpeed(raw uint64) *float64 {
+	if raw == 1023 {
+		return nil
+	}
+	speed := float64(raw) / 10
+	return &speed
+}
+
+func encodeSpeed(speed *float64) uint64 {
+	if speed == nil {
+		return 1023
+	}
+	return uint64(math.Max(0, math.Min(math.Round(*speed*10), 1022)))
+}
+
+// Coordinates are in 1/10000 minutes; unavailable is 181° longitude and 91° latitude
+func decodeCoordinate(raw int64, unavailable float64) *float64 {
+	degrees := float64(raw) / 600000
+	if degrees == unavailable {
+		return nil
+	}
+	return &degrees
+}
+
+func encodeCoordinate(degrees *float64, unavailable float64) int64 {
+	if degrees == nil {
+		return int64(unavailable * 600000)
+	}
+	return int64(math.Round(*degrees * 600000))
+}
+
+func decodeCourse(raw uint64) *float64 {
+	if raw >= 3600 {
+		return nil
+	}
+	course := float64(raw) / 10
+	return &course
+}
+
+func encodeCourse(course *float64) uint64 {
+	if course == nil {
+		return 3600
+	}
+	return uint64(math.Round(math.Mod(*course+360, 360)*10)) % 3600
+}
+
+func decodeHeading(raw uint64) *int {
+	if raw == 511 || raw >= 360 {
+		return nil
+	}
+	heading := int(raw)
+	return &heading
+}
+
+func encodeHeading(heading *int) uint64 {
+	if heading == nil {
+		return 511
+	}
+	return uint64((*heading%360 + 360) % 360)
+}
+
+func decodeDimensions(b *bitBuffer, pos int) Dimensions {
+	return Dimensions{
+		ToBow:       int(b.uint(pos, 9)),
+		ToStern:     int(b.uint(pos+9, 9)),
+		ToPort:      int(b.uint(pos+18, 6)),
+		ToStarboard: int(b.uint(pos+24, 6)),
+	}
+}
+
+func encodeDimensions(b *bitBuffer, d Dimensions) {
+	clamp := func(v, max int) uint64 {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return uint64(max)
+		}
+		return uint64(v)
+	}
+	b.putUint(clamp(d.ToBow, 511), 9)
+	b.putUint(clamp(d.ToStern, 511), 9)
+	b.putUint(clamp(d.ToPort, 63), 6)
+	b.putUint(clamp(d.ToStarboard, 63), 6)
+}
+
+// fixClockSkew is how far ahead of the receiver's clock a fix may be
+const fixClockSkew = 5 * time.Second
+
+// fixTime returns the time of a fix reported at second of the minute: the
+// latest such time not after receivedAt, allowing for clock skew. Unavailable
+// seconds give receivedAt.
+func fixTime(second uint8, receivedAt time.Time) time.Time {
+	receivedAt = receivedAt.UTC()
+	if second > 59 {
+		return receivedAt
+	}
+	fix := receivedAt.Truncate(time.Minute).Add(time.Duration(second) * time.Second)
+	if fix.After(receivedAt.Add(fixClockSkew)) {
+		fix = fix.Add(-time.Minute)
+	}
+	return fix
+}
+
+// Position maps the report to a position message, with ok unset when the
+// report carries no position. receivedAt dates the fix.
+func (r PositionReport) Position(receivedAt time.Time) (pos PositionMessage, ok bool) {
+	status := r.NavStatus
+	nav := &Navigation{
+		SpeedOverGround:  r.SpeedOverGround,
+		CourseOverGround: r.CourseOverGround,
+		Heading:          r.Heading,
+		RateOfTurn:       r.RateOfTurn,
+		Status:           &status,
+	}
+	if status == NavigationUndefined {
+		nav.Status = nil
+	}
+	return aisPosition(r.MMSI, r.Latitude, r.Longitude, r.Second, nav, receivedAt)
+}
+
+// Position maps the report to a position message, with ok unset when the
+// report carries no position. receivedAt dates the fix.
+func (r ClassBPositionReport) Position(receivedAt time.Time) (pos PositionMessage, ok bool) {
+	nav := &Navigation{SpeedOverGround: r.SpeedOverGround, CourseOverGround: r.CourseOverGround, Heading: r.Heading}
+	return aisPosition(r.MMSI, r.Latitude, r.Longitude, r.Second, nav, receivedAt)
+}
+
+// Position maps the report to a position message, with ok unset when the
+// report carries no position. receivedAt dates the fix.
+func (r ExtendedClassBPositionReport) Position(receivedAt time.Time) (pos PositionMessage, ok bool) {
+	nav := &Navigation{SpeedOverGround: r.SpeedOverGround, CourseOverGround: r.CourseOverGround, Heading: r.Heading}
+	return aisPosition(r.MMSI, r.Latitude, r.Longitude, r.Second, nav, receivedAt)
+}
+
+// PositionSource is implemented by AIS messages carrying a position
+type PositionSource interface {
+	AISMessage
+	Position(receivedAt time.Time) (PositionMessage, bool)
+}
+
+func aisPosition(mmsi uint32, lat, lon *float64, second uint8, nav *Navigation, receivedAt time.Time) (PositionMessage, bool) {
+	if lat == nil || lon == nil {
+		return PositionMessage{}, false
+	}
+	if *nav == (Navigation{}) {
+		nav = nil
+	}
+	return PositionMessage{
+		Type:       PositionUpdate,
+		VesselID:   strconv.FormatUint(uint64(mmsi), 10),
+		Latitude:   *lat,
+		Longitude:  *lon,
+		Timestamp:  fixTime(second, receivedAt),
+		MMSI:       mmsi,
+		Navigation: nav,
+	}, true
+}
+
+// Update merges the static data of an AIS message (types 5, 19 and 24) into
+// the vessel info and reports whether anything changed. Fields the message
+// reports as not available are left as they were.
+func (v *VesselInfo) Update(msg AISMessage) bool {
+	before := *v
+	v.MMSI = msg.Header().MMSI
+	switch m := msg.(type) {
+	case StaticVoyageData:
+		v.setIMO(m.IMO)
+		v.setName(m.Name)
+		v.setCallSign(m.CallSign)
+		v.setShipType(m.ShipType)
+		v.setDimensions(m.Dimensions)
+		if m.Draught > 0 {
+			v.Draught = m.Draught
+		}
+		if m.Destination != "" {
+			v.Destination = m.Destination
+		}
+	case ExtendedClassBPositionReport:
+		v.setName(m.Name)
+		v.setShipType(m.ShipType)
+		v.setDimensions(m.Dimensions)
+	case StaticDataReport:
+		if m.PartNumber == 0 {
+			v.setName(m.Name)
+			break
+		}
+		v.setCallSign(m.CallSign)
+		v.setShipType(m.ShipType)
+		if m.MothershipID == 0 {
+			v.setDimensions(m.Dimensions)
+		}
+	}
+	return !v.Equal(before)
+}
+
+func (v *VesselInfo) setIMO(imo uint32) {
+	if imo != 0 {
+		v.IMO = imo
+	}
+}
+
+func (v *VesselInfo) setName(name string) {
+	if name != "" {
+		v.Name = name
+	}
+}
+
+func (v *VesselInfo) setCallSign(callSign string) {
+	if callSign != "" {
+		v.CallSign = callSign
+	}
+}
+
+func (v *VesselInfo) setShipType(shipType ShipType) {
+	if shipType != 0 {
+		v.ShipType = shipType
+	}
+}
+
+func (v *VesselInfo) setDimensions(d Dimensions) {
+	if d != (Dimensions{}) {
+		v.Dimensions = &d
+	}
+}
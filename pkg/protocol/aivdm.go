@@ -0,0 +1,230 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AIVDM sentence limits
+const (
+	maxSentenceLength  = 82 // Including the line ending
+	maxFragmentPayload = 60 // Armored characters per sentence that keep it within maxSentenceLength
+	maxFragments       = 9
+	maxPendingMessages = 256 // Incomplete messages held by an Assembler
+)
+
+// DefaultFragmentTimeout is how long the fragments of an incomplete message are kept
+const DefaultFragmentTimeout = 10 * time.Second
+
+// ErrNotAIS is returned for valid NMEA sentences that are not AIVDM or AIVDO
+var ErrNotAIS = errors.New("not an AIVDM/AIVDO sentence")
+
+// Fragment is one AIVDM or AIVDO sentence of a possibly multi-sentence message
+type Fragment struct {
+	Count      int    // Sentences making up the message
+	Number     int    // 1-based number of this sentence
+	SequenceID string // Tells apart interleaved multi-sentence messages; empty for single ones
+	Channel    string // Radio channel, "A" or "B"
+	Payload    string // Armored payload
+	FillBits   int
+	Own        bool // AIVDO: reported by the receiving station's own vessel
+}
+
+// ParseFragment extracts the AIS fragment of a parsed sentence
+func ParseFragment(s Sentence) (Fragment, error) {
+	if s.Start != '!' || (s.Type != "VDM" && s.Type != "VDO") {
+		return Fragment{}, ErrNotAIS
+	}
+	if len(s.Fields) != 6 {
+		return Fragment{}, fmt.Errorf("%w: AIVDM has %d fields, want 6", ErrMalformedSentence, len(s.Fields))
+	}
+	f := Fragment{SequenceID: s.Fields[2], Channel: s.Fields[3], Payload: s.Fields[4], Own: s.Type == "VDO"}
+	var err error
+	if f.Count, err = strconv.Atoi(s.Fields[0]); err != nil || f.Count < 1 || f.Count > maxFragments {
+		return Fragment{}, fmt.Errorf("%w: invalid fragment count %q", ErrMalformedSentence, s.Fields[0])
+	}
+	if f.Number, err = strconv.Atoi(s.Fields[1]); err != nil || f.Number < 1 || f.Number > f.Count {
+		return Fragment{}, fmt.Errorf("%w: invalid fragment number %q", ErrMalformedSentence, s.Fields[1])
+	}
+	if f.FillBits, err = strconv.Atoi(s.Fields[5]); err != nil || f.FillBits < 0 || f.FillBits > 5 {
+		return Fragment{}, fmt.Errorf("%w: invalid fill bits %q", ErrMalformedSentence, s.Fields[5])
+	}
+	return f, nil
+}
+
+// Assembler reassembles multi-sentence AIS messages. Fragments of a message
+// may arrive out of order and interleaved with other messages; incomplete
+// messages are dropped after a timeout. It is safe for concurrent use.
+type Assembler struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	pending map[fragmentKey]*partialMessage
+}
+
+// fragmentKey identifies the message a fragment belongs to
+type fragmentKey struct {
+	sequenceID string
+	channel    string
+	count      int
+	own        bool
+}
+
+type partialMessage struct {
+	payloads []string // By fragment number - 1
+	received int
+	fillBits int // Of the last fragment
+	started  time.Time
+}
+
+// NewAssembler creates an assembler keeping incomplete messages for timeout
+func NewAssembler(timeout time.Duration) *Assembler {
+	return &Assembler{timeout: timeout, pending: make(map[fragmentKey]*partialMessage)}
+}
+
+// Add adds a fragment. Once the message is complete it returns the assembled
+// payload with complete set; until then it returns complete unset.
+func (a *Assembler) Add(f Fragment, now time.Time) (payload string, fillBits int, complete bool) {
+	if f.Count == 1 {
+		return f.Payload, f.FillBits, true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(now)
+	key := fragmentKey{sequenceID: f.SequenceID, channel: f.Channel, count: f.Count, own: f.Own}
+	partial, exists := a.pending[key]
+	if !exists && len(a.pending) >= maxPendingMessages {
+		a.evictOldest()
+	}
+	if !exists || partial.payloads[f.Number-1] != "" {
+		// A repeated fragment number means the sequence ID was reused for a new message
+		partial = &partialMessage{payloads: make([]string, f.Count), started: now}
+		a.pending[key] = partial
+	}
+	if partial.payloads[f.Number-1] == "" {
+		partial.received++
+	}
+	partial.payloads[f.Number-1] = f.Payload
+	if f.Number == f.Count {
+		partial.fillBits = f.FillBits
+	}
+	if partial.received < f.Count {
+		return "", 0, false
+	}
+	delete(a.pending, key)
+	return strings.Join(partial.payloads, ""), partial.fillBits, true
+}
+
+// Pending returns how many incomplete messages are held
+func (a *Assembler) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+func (a *Assembler) expire(now time.Time) {
+	for key, partial := range a.pending {
+		if now.Sub(partial.started) > a.timeout {
+			delete(a.pending, key)
+		}
+	}
+}
+
+func (a *Assembler) evictOldest() {
+	var oldest fragmentKey
+	var started time.Time
+	for key, partial := range a.pending {
+		if started.IsZero() || partial.started.Before(started) {
+			oldest, started = key, partial.started
+		}
+	}
+	delete(a.pending, oldest)
+}
+
+// AISDecoder decodes a stream of AIVDM/AIVDO sentences into AIS messages
+type AISDecoder struct {
+	assembler *Assembler
+}
+
+// NewAISDecoder creates a decoder with the default fragment timeout
+func NewAISDecoder() *AISDecoder {
+	return &AISDecoder{assembler: NewAssembler(DefaultFragmentTimeout)}
+}
+
+// Decode decodes one sentence. It returns a nil message without error while a
+// multi-sentence message is incomplete.
+func (d *AISDecoder) Decode(line string, now time.Time) (AISMessage, error) {
+	msg, _, err := d.DecodePayload(line, now)
+	return msg, err
+}
+
+// DecodePayload decodes one sentence like Decode, also returning the armored
+// payload of a completed message as reassembled from all of its sentences
+func (d *AISDecoder) DecodePayload(line string, now time.Time) (AISMessage, string, error) {
+	sentence, err := ParseSentence(line)
+	if err != nil {
+		return nil, "", err
+	}
+	fragment, err := ParseFragment(sentence)
+	if err != nil {
+		return nil, "", err
+	}
+	payload, fillBits, complete := d.assembler.Add(fragment, now)
+	if !complete {
+		return nil, "", nil
+	}
+	msg, err := DecodeAIS(payload, fillBits)
+	if err != nil {
+		return nil, "", err
+	}
+	return msg, payload, nil
+}
+
+// EncodeAIVDM encodes a message as AIVDM sentences on channel ("A" or "B").
+// Messages longer than one sentence are split and tagged with sequenceID (0-9).
+func EncodeAIVDM(msg AISMessage, channel string, sequenceID int) ([]string, error) {
+	payload, fillBits, err := EncodeAIS(msg)
+	if err != nil {
+		return nil, err
+	}
+	return FormatAIVDM(payload, fillBits, channel, sequenceID, false), nil
+}
+
+// FormatAIVDM splits an armored payload into AIVDM (or, for own, AIVDO) sentences
+func FormatAIVDM(payload string, fillBits int, channel string, sequenceID int, own bool) []string {
+	sentenceType := "VDM"
+	if own {
+		sentenceType = "VDO"
+	}
+	count := (len(payload) + maxFragmentPayload - 1) / maxFragmentPayload
+	if count == 0 {
+		count = 1
+	}
+	sequence := ""
+	if count > 1 {
+		sequence = strconv.Itoa(sequenceID % 10)
+	}
+
+	sentences := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		start, end := i*maxFragmentPayload, (i+1)*maxFragmentPayload
+		if end > len(payload) {
+			end = len(payload)
+		}
+		fill := 0
+		if i == count-1 {
+			fill = fillBits
+		}
+		sentences = append(sentences, Sentence{
+			Start:  '!',
+			Talker: "AI",
+			Type:   sentenceType,
+			Fields: []string{strconv.Itoa(count), strconv.Itoa(i + 1), sequence, channel, payload[start:end], strconv.Itoa(fill)},
+		}.String())
+	}
+	return sentences
+}
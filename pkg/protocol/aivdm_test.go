@@ -0,0 +1,293 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Sentences from public AIVDM decoding references, with their published values
+var (
+	moored       = "!AIVDM,1,1,,B,177KQJ5000G?tO`K>RA1wUbN0TKH,0*5C"
+	underWay     = "!AIVDM,1,1,,A,15RTgt0PAso;90TKcjM8h6g208CQ,0*4A"
+	noHeading    = "!AIVDM,1,1,,A,13HOI:0P0000VOHLCnHQKwvL05Ip,0*23"
+	staticVoyage = []string{
+		"!AIVDM,2,1,1,A,55?MbV02;H;s<HtKR20EHE:0@T4@Dn2222222216L961O5Gf0NSQEp6ClRp8,0*1C",
+		"!AIVDM,2,2,1,A,88888888880,2*25",
+	}
+	classB       = "!AIVDM,1,1,,A,B6CdCm0t3`tba35f@V9faHi7kP06,0*58"
+	staticPartA  = "!AIVDM,1,1,,A,H42O55i18tMET00000000000000,2*6D"
+	staticPartB  = "!AIVDM,1,1,,A,H42O55lti4hhhilD3nink000?050,0*40"
+	testReceived = time.Date(2026, 10, 18, 6, 25, 0, 0, time.UTC)
+)
+
+// decodeLines decodes sentences forming one message
+func decodeLines(t *testing.T, lines ...string) AISMessage {
+	t.Helper()
+	d := NewAISDecoder()
+	var msg AISMessage
+	for i, line := range lines {
+		var err error
+		msg, err = d.Decode(line, testReceived)
+		if err != nil {
+			t.Fatalf("Decode %q: %v", line, err)
+		}
+		if (msg == nil) != (i < len(lines)-1) {
+			t.Fatalf("Decode %q returned %v after %d of %d sentences", line, msg, i+1, len(lines))
+		}
+	}
+	return msg
+}
+
+func near(got *float64, want float64) bool {
+	return got != nil && math.Abs(*got-want) < 1e-6
+}
+
+func TestDecodePositionReports(t *testing.T) {
+	r := decodeLines(t, moored).(PositionReport)
+	if r.Type != 1 || r.MMSI != 477553000 || r.NavStatus != Moored || r.Second != 15 {
+		t.Errorf("moored header: %+v", r)
+	}
+	if !near(r.Latitude, 47.582833) || !near(r.Longitude, -122.345833) {
+		t.Errorf("moored position: %v, %v", *r.Latitude, *r.Longitude)
+	}
+	if !near(r.SpeedOverGround, 0) || !near(r.CourseOverGround, 51) || r.Heading == nil || *r.Heading != 181 {
+		t.Errorf("moored navigation: %v, %v, %v", *r.SpeedOverGround, *r.CourseOverGround, r.Heading)
+	}
+
+	r = decodeLines(t, underWay).(PositionReport)
+	if r.MMSI != 371798000 || r.NavStatus != UnderWayUsingEngine || !r.Accuracy || r.Second != 33 {
+		t.Errorf("under way header: %+v", r)
+	}
+	if !near(r.Latitude, 48.381633) || !near(r.Longitude, -123.395383) {
+		t.Errorf("under way position: %v, %v", *r.Latitude, *r.Longitude)
+	}
+	if !near(r.SpeedOverGround, 12.3) || !near(r.CourseOverGround, 224) || *r.Heading != 215 {
+		t.Errorf("under way navigation: %v, %v, %v", *r.SpeedOverGround, *r.CourseOverGround, *r.Heading)
+	}
+	if !near(r.RateOfTurn, -720) {
+		t.Errorf("rate of turn = %v, want -720 (turning left faster than 5° per 30 s)", *r.RateOfTurn)
+	}
+
+	r = decodeLines(t, noHeading).(PositionReport)
+	if r.MMSI != 227006760 || !near(r.Latitude, 49.475577) || !near(r.Longitude, 0.13138) || !near(r.CourseOverGround, 36.7) {
+		t.Errorf("no heading: %+v", r)
+	}
+	if r.Heading != nil || r.RateOfTurn != nil {
+		t.Errorf("heading %v and rate of turn %v, want both not available", r.Heading, r.RateOfTurn)
+	}
+
+	pos, ok := r.Position(testReceived)
+	if !ok || pos.MMSI != 227006760 || pos.Timestamp != time.Date(2026, 10, 18, 6, 24, 14, 0, time.UTC) {
+		t.Errorf("Position = %+v, %v", pos, ok)
+	}
+}
+
+func TestDecodeStaticVoyageData(t *testing.T) {
+	got := decodeLines(t, staticVoyage...).(StaticVoyageData)
+	want := StaticVoyageData{
+		AISHeader:   AISHeader{Type: 5, MMSI: 351759000},
+		IMO:         9134270,
+		CallSign:    "3FOF8",
+		Name:        "EVER DIADEM",
+		ShipType:    70,
+		Dimensions:  Dimensions{ToBow: 225, ToStern: 70, ToPort: 1, ToStarboard: 31},
+		EPFD:        1,
+		ETAMonth:    5,
+		ETADay:      15,
+		ETAHour:     14,
+		Draught:     12.2,
+		Destination: "NEW YORK",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if got.Dimensions.Length() != 295 || got.Dimensions.Beam() != 32 {
+		t.Errorf("length %d, beam %d", got.Dimensions.Length(), got.Dimensions.Beam())
+	}
+}
+
+func TestDecodeClassB(t *testing.T) {
+	r := decodeLines(t, classB).(ClassBPositionReport)
+	if r.MMSI != 423302100 || r.Second != 34 || !r.CarrierSense {
+		t.Errorf("header: %+v", r)
+	}
+	if !near(r.Latitude, 40.005283) || !near(r.Longitude, 53.010997) {
+		t.Errorf("position: %v, %v", *r.Latitude, *r.Longitude)
+	}
+	if !near(r.SpeedOverGround, 1.4) || !near(r.CourseOverGround, 177) || *r.Heading != 177 {
+		t.Errorf("navigation: %v, %v, %v", *r.SpeedOverGround, *r.CourseOverGround, *r.Heading)
+	}
+}
+
+func TestDecodeStaticDataReport(t *testing.T) {
+	a := decodeLines(t, staticPartA).(StaticDataReport)
+	if a.MMSI != 271041815 || a.PartNumber != 0 || a.Name != "PROGUY" {
+		t.Errorf("part A: %+v", a)
+	}
+	b := decodeLines(t, staticPartB).(StaticDataReport)
+	if b.MMSI != 271041815 || b.PartNumber != 1 || b.ShipType != 60 || b.CallSign != "TC6163" {
+		t.Errorf("part B: %+v", b)
+	}
+	if b.Dimensions != (Dimensions{ToStern: 15, ToStarboard: 5}) {
+		t.Errorf("part B dimensions: %+v", b.Dimensions)
+	}
+
+	info := VesselInfo{}
+	if !info.Update(a) || !info.Update(b) || info.Name != "PROGUY" || info.CallSign != "TC6163" {
+		t.Errorf("VesselInfo = %+v", info)
+	}
+}
+
+func TestEncodeReproducesSentences(t *testing.T) {
+	// Messages without spare or padding bits set encode back to the same sentence
+	for _, line := range []string{moored, underWay, noHeading, staticPartB} {
+		msg := decodeLines(t, line)
+		fragment, _ := ParseFragment(mustParse(t, line))
+		sentences, err := EncodeAIVDM(msg, fragment.Channel, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sentences) != 1 || sentences[0] != line {
+			t.Errorf("encoded %v, want %s", sentences, line)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	// Transmitters pad text and set reserved bits differently; the decoded values survive
+	for _, lines := range [][]string{staticVoyage, {classB}, {staticPartA}} {
+		msg := decodeLines(t, lines...)
+		sentences, err := EncodeAIVDM(msg, "B", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sentences) != len(lines) {
+			t.Errorf("%d sentences, want %d", len(sentences), len(lines))
+		}
+		for _, s := range sentences {
+			if len(s)+2 > maxSentenceLength {
+				t.Errorf("sentence of %d characters: %s", len(s), s)
+			}
+		}
+		if got := decodeLines(t, sentences...); !reflect.DeepEqual(got, msg) {
+			t.Errorf("round trip of %T:\ngot  %+v\nwant %+v", msg, got, msg)
+		}
+	}
+
+	if _, _, err := EncodeAIS(PositionReport{AISHeader: AISHeader{Type: 5}}); err == nil {
+		t.Error("encoded a position report as type 5")
+	}
+}
+
+func mustParse(t *testing.T, line string) Sentence {
+	t.Helper()
+	s, err := ParseSentence(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseSentence(t *testing.T) {
+	s, err := ParseSentence("\\s:2573135,c:1671620143*0B\\" + moored + "\r\n")
+	if err != nil || s.Talker != "AI" || s.Type != "VDM" || len(s.Fields) != 6 {
+		t.Errorf("tag block: %+v, %v", s, err)
+	}
+	if s.String() != moored {
+		t.Errorf("String = %s, want %s", s.String(), moored)
+	}
+	if s, err := ParseSentence("$GPGLL,4916.45,N,12311.12,W,225444,A"); err != nil || s.Type != "GLL" {
+		t.Errorf("parametric sentence without checksum: %+v, %v", s, err)
+	}
+
+	cases := map[string]error{
+		moored[:len(moored)-2] + "5D":      ErrChecksum,
+		moored[:len(moored)-3]:             ErrMalformedSentence,
+		"!AIVDM,1,1,,B,177KQJ5000G?tO`K>R": ErrMalformedSentence,
+		"AIVDM,1,1,,B,1,0*00":              ErrMalformedSentence,
+		"\\s:2573135" + moored:             ErrMalformedSentence,
+	}
+	for line, want := range cases {
+		if _, err := ParseSentence(line); !errors.Is(err, want) {
+			t.Errorf("%q: got %v, want %v", line, err, want)
+		}
+	}
+	if _, err := NewAISDecoder().Decode("$GPGLL,4916.45,N,12311.12,W,225444,A", testReceived); !errors.Is(err, ErrNotAIS) {
+		t.Errorf("GLL decoded as AIS: %v", err)
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	first, _ := ParseFragment(mustParse(t, staticVoyage[0]))
+	second, _ := ParseFragment(mustParse(t, staticVoyage[1]))
+	other := first
+	other.SequenceID = "2"
+
+	a := NewAssembler(time.Second)
+	if _, _, complete := a.Add(second, testReceived); complete {
+		t.Fatal("complete after the second fragment alone")
+	}
+	if _, _, complete := a.Add(other, testReceived); complete {
+		t.Fatal("complete after an interleaved fragment")
+	}
+	payload, fillBits, complete := a.Add(first, testReceived)
+	if !complete || fillBits != 2 || payload != first.Payload+second.Payload {
+		t.Errorf("out of order: %q, %d, %v", payload, fillBits, complete)
+	}
+	if a.Pending() != 1 {
+		t.Errorf("%d pending, want the interleaved message", a.Pending())
+	}
+
+	// Fragments older than the timeout are dropped
+	a.Add(second, testReceived)
+	if _, _, complete := a.Add(first, testReceived.Add(2*time.Second)); complete {
+		t.Error("completed with an expired fragment")
+	}
+	if a.Pending() != 1 {
+		t.Errorf("%d pending after expiry, want 1", a.Pending())
+	}
+}
+
+func TestArmoring(t *testing.T) {
+	b, err := dearmor("0w`W", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint64{0, 63, 40, 39} {
+		if got := b.uint(6*i, 6); got != want {
+			t.Errorf("character %d = %d, want %d", i, got, want)
+		}
+	}
+	if payload, fill := b.armor(); payload != "0w`W" || fill != 0 {
+		t.Errorf("armor = %q, %d", payload, fill)
+	}
+
+	b = &bitBuffer{}
+	b.putInt(-3, 8)
+	b.putText("ab_1~", 6)
+	if b.int(0, 8) != -3 || b.text(8, 6) != "AB_1?" {
+		t.Errorf("fields: %d, %q", b.int(0, 8), b.text(8, 6))
+	}
+	payload, fill := b.armor()
+	if fill != 4 {
+		t.Errorf("fill bits = %d, want 4", fill)
+	}
+	if back, err := dearmor(payload, fill); err != nil || back.len != b.len || back.text(8, 6) != "AB_1?" {
+		t.Errorf("dearmor = %+v, %v", back, err)
+	}
+
+	for _, payload := range []string{"0X0", "0a!"} {
+		if _, err := dearmor(payload, 0); err == nil {
+			t.Errorf("dearmor(%q) accepted an invalid character", payload)
+		}
+	}
+	if _, err := DecodeAIS("1", 0); err == nil {
+		t.Error("decoded a 6-bit message")
+	}
+	if _, err := DecodeAIS("G0000000", 0); !errors.Is(err, ErrUnsupportedAISType) {
+		t.Errorf("type 23: %v", err)
+	}
+}
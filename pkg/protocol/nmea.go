@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NMEA 0183 sentence errors
+var (
+	ErrMalformedSentence = errors.New("malformed NMEA sentence")
+	ErrChecksum          = errors.New("NMEA checksum mismatch")
+)
+
+// Sentence is a parsed NMEA 0183 sentence such as !AIVDM,1,1,,A,...,0*hh
+type Sentence struct {
+	Start  byte     // '$' for parametric sentences, '!' for encapsulated ones like AIVDM
+	Talker string   // e.g. "AI"
+	Type   string   // e.g. "VDM"
+	Fields []string // Fields after the address
+}
+
+// ParseSentence parses and validates one NMEA sentence. A leading IEC 61162-450
+// tag block (\...\) and trailing line endings are ignored. The checksum is
+// mandatory for encapsulated sentences and checked when present otherwise.
+func ParseSentence(line string) (Sentence, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "\\") {
+		end := strings.Index(line[1:], "\\")
+		if end < 0 {
+			return Sentence{}, fmt.Errorf("%w: unterminated tag block", ErrMalformedSentence)
+		}
+		line = line[end+2:]
+	}
+	if len(line) < 7 || (line[0] != '$' && line[0] != '!') {
+		return Sentence{}, fmt.Errorf("%w: %q", ErrMalformedSentence, line)
+	}
+
+	body := line[1:]
+	if star := strings.LastIndexByte(body, '*'); star >= 0 {
+		want, err := strconv.ParseUint(body[star+1:], 16, 8)
+		if err != nil || len(body)-star-1 != 2 {
+			return Sentence{}, fmt.Errorf("%w: invalid checksum field in %q", ErrMalformedSentence, line)
+		}
+		body = body[:star]
+		if got := Checksum(body); got != byte(want) {
+			return Sentence{}, fmt.Errorf("%w: got %02X, sentence says %02X", ErrChecksum, got, want)
+		}
+	} else if line[0] == '!' {
+		return Sentence{}, fmt.Errorf("%w: missing checksum in %q", ErrMalformedSentence, line)
+	}
+
+	fields := strings.Split(body, ",")
+	address := fields[0]
+	if len(address) != 5 {
+		return Sentence{}, fmt.Errorf("%w: invalid address %q", ErrMalformedSentence, address)
+	}
+	return Sentence{Start: line[0], Talker: address[:2], Type: address[2:], Fields: fields[1:]}, nil
+}
+
+// String formats the sentence with its checksum, without a line ending
+func (s Sentence) String() string {
+	body := s.Talker + s.Type + "," + strings.Join(s.Fields, ",")
+	return fmt.Sprintf("%c%s*%02X", s.Start, body, Checksum(body))
+}
+
+// Checksum is the XOR of the characters between the start character and '*'
+func Checksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
@@ -1,6 +1,8 @@
 package protocol
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -19,4 +21,80 @@ type PositionMessage struct {
 	Latitude  float64     `json:"latitude"`
 	Longitude float64     `json:"longitude"`
 	Timestamp time.Time   `json:"timestamp"`
+
+	MMSI       uint32      `json:"mmsi,omitempty"`
+	Navigation *Navigation `json:"navigation,omitempty"` // Dynamic state at the fix
+	Static     *VesselInfo `json:"static,omitempty"`     // Identity and static data, sent every few reports
+}
+
+// Navigation is the dynamic state reported along with a fix. Fields are nil
+// when not reported.
+type Navigation struct {
+	SpeedOverGround  *float64          `json:"sog,omitempty"`     // Knots
+	CourseOverGround *float64          `json:"cog,omitempty"`     // Degrees true
+	Heading          *int              `json:"heading,omitempty"` // Degrees true
+	RateOfTurn       *float64          `json:"rot,omitempty"`     // Degrees per minute, positive to starboard
+	Status           *NavigationStatus `json:"navStatus,omitempty"`
+}
+
+// String summarizes the reported fields, e.g. "sog 12.3 kn, cog 224.0°, under way using engine"
+func (n *Navigation) String() string {
+	var parts []string
+	if n.SpeedOverGround != nil {
+		parts = append(parts, fmt.Sprintf("sog %.1f kn", *n.SpeedOverGround))
+	}
+	if n.CourseOverGround != nil {
+		parts = append(parts, fmt.Sprintf("cog %.1f°", *n.CourseOverGround))
+	}
+	if n.Heading != nil {
+		parts = append(parts, fmt.Sprintf("heading %d°", *n.Heading))
+	}
+	if n.RateOfTurn != nil {
+		parts = append(parts, fmt.Sprintf("rot %.1f°/min", *n.RateOfTurn))
+	}
+	if n.Status != nil {
+		parts = append(parts, n.Status.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// VesselInfo is the identity and static data of a vessel. Zero values are unknown.
+type VesselInfo struct {
+	MMSI        uint32      `json:"mmsi,omitempty"`
+	IMO         uint32      `json:"imo,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	CallSign    string      `json:"callSign,omitempty"`
+	ShipType    ShipType    `json:"shipType,omitempty"`
+	Dimensions  *Dimensions `json:"dimensions,omitempty"`
+	Draught     float64     `json:"draught,omitempty"` // Meters
+	Destination string      `json:"destination,omitempty"`
+}
+
+// String names the vessel, e.g. "EVER DIADEM (IMO 9134270, cargo)"
+func (v *VesselInfo) String() string {
+	var details []string
+	if v.IMO != 0 {
+		details = append(details, fmt.Sprintf("IMO %d", v.IMO))
+	}
+	if v.ShipType != 0 {
+		details = append(details, v.ShipType.String())
+	}
+	name := v.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	if len(details) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(details, ", ") + ")"
+}
+
+// Equal reports whether both describe the vessel the same way
+func (v VesselInfo) Equal(other VesselInfo) bool {
+	if (v.Dimensions == nil) != (other.Dimensions == nil) ||
+		(v.Dimensions != nil && *v.Dimensions != *other.Dimensions) {
+		return false
+	}
+	v.Dimensions, other.Dimensions = nil, nil
+	return v == other
 }
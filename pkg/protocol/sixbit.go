@@ -0,0 +1,143 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bitBuffer holds an AIS message as a string of bits, most significant first.
+// Reads past the end return zero bits, as receivers tolerate short spare fields.
+type bitBuffer struct {
+	data []byte
+	len  int // In bits
+}
+
+// dearmor decodes the 6-bit ASCII armoring of an AIVDM payload
+func dearmor(payload string, fillBits int) (*bitBuffer, error) {
+	if fillBits < 0 || fillBits > 5 {
+		return nil, fmt.Errorf("invalid fill bit count %d", fillBits)
+	}
+	b := &bitBuffer{}
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		if c < '0' || c > 'w' || (c > 'W' && c < '`') {
+			return nil, fmt.Errorf("invalid payload character %q", c)
+		}
+		v := c - '0'
+		if v > 40 {
+			v -= 8
+		}
+		b.putUint(uint64(v), 6)
+	}
+	if fillBits > b.len {
+		return nil, fmt.Errorf("fill bit count %d exceeds payload", fillBits)
+	}
+	b.len -= fillBits
+	return b, nil
+}
+
+// armor encodes the buffer as an AIVDM payload, padding it to whole characters
+func (b *bitBuffer) armor() (payload string, fillBits int) {
+	fillBits = (6 - b.len%6) % 6
+	var sb strings.Builder
+	for pos := 0; pos < b.len; pos += 6 {
+		v := byte(b.uint(pos, 6))
+		if v > 39 {
+			v += 8
+		}
+		sb.WriteByte(v + '0')
+	}
+	return sb.String(), fillBits
+}
+
+func (b *bitBuffer) bit(pos int) uint64 {
+	if pos >= b.len {
+		return 0
+	}
+	return uint64(b.data[pos/8]>>(7-uint(pos%8))) & 1
+}
+
+// uint reads an unsigned field of width bits at pos
+func (b *bitBuffer) uint(pos, width int) uint64 {
+	var v uint64
+	for i := 0; i < width; i++ {
+		v = v<<1 | b.bit(pos+i)
+	}
+	return v
+}
+
+// int reads a two's complement field of width bits at pos
+func (b *bitBuffer) int(pos, width int) int64 {
+	v := b.uint(pos, width)
+	if v&(1<<uint(width-1)) != 0 {
+		return int64(v) - 1<<uint(width)
+	}
+	return int64(v)
+}
+
+func (b *bitBuffer) bool(pos int) bool {
+	return b.bit(pos) == 1
+}
+
+// text reads chars 6-bit characters at pos, dropping '@' padding and trailing spaces
+func (b *bitBuffer) text(pos, chars int) string {
+	var sb strings.Builder
+	for i := 0; i < chars; i++ {
+		v := byte(b.uint(pos+6*i, 6))
+		if v == 0 {
+			break // '@' terminates the text
+		}
+		if v < 32 {
+			v += 64
+		}
+		sb.WriteByte(v)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// putUint appends the low width bits of v
+func (b *bitBuffer) putUint(v uint64, width int) {
+	for i := width - 1; i >= 0; i-- {
+		if b.len%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			b.data[b.len/8] |= 1 << (7 - uint(b.len%8))
+		}
+		b.len++
+	}
+}
+
+// putInt appends v in two's complement
+func (b *bitBuffer) putInt(v int64, width int) {
+	b.putUint(uint64(v)&(1<<uint(width)-1), width)
+}
+
+func (b *bitBuffer) putBool(v bool) {
+	if v {
+		b.putUint(1, 1)
+	} else {
+		b.putUint(0, 1)
+	}
+}
+
+// putText appends text as chars 6-bit characters, padded with '@'. Characters
+// outside the AIS character set become '?'.
+func (b *bitBuffer) putText(text string, chars int) {
+	text = strings.ToUpper(text)
+	for i := 0; i < chars; i++ {
+		var v byte // '@'
+		if i < len(text) {
+			c := text[i]
+			switch {
+			case c >= '@' && c <= '_':
+				v = c - 64
+			case c >= ' ' && c <= '?':
+				v = c
+			default:
+				v = '?'
+			}
+		}
+		b.putUint(uint64(v), 6)
+	}
+}
@@ -0,0 +1,184 @@
+package satellite
+
+import (
+	"project3/pkg/common"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchPolicy controls how the messages of a link are grouped into frames
+type BatchPolicy struct {
+	MaxCount    int           // Messages per frame; up to 1 sends every message on its own
+	MaxDelay    time.Duration // Longest a message waits for its frame to fill
+	Compression string        // CompressionNone, CompressionGzip or CompressionDeflate
+}
+
+// BatchPolicyFromConfig converts the configured batching of a link into a policy
+func BatchPolicyFromConfig(config common.BatchConfig) BatchPolicy {
+	compression := config.Compression
+	if compression == "" {
+		compression = CompressionNone
+	}
+	return BatchPolicy{
+		MaxCount:    config.MaxCount,
+		MaxDelay:    time.Duration(config.MaxDelayMs) * time.Millisecond,
+		Compression: compression,
+	}
+}
+
+// LinkStats reports the traffic of a link and what batching and compression saved
+type LinkStats struct {
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Messages       uint64 `json:"messages"`
+	Frames         uint64 `json:"frames"`
+	Failed         uint64 `json:"failed"`         // Messages of frames that could not be delivered
+	UnbatchedBytes uint64 `json:"unbatchedBytes"` // Had each message been sent alone and uncompressed
+	EncodedBytes   uint64 `json:"encodedBytes"`   // Of the frames before compression
+	SentBytes      uint64 `json:"sentBytes"`      // Of the frames on the wire
+	SavedBytes     int64  `json:"savedBytes"`     // UnbatchedBytes - SentBytes
+	SavedRequests  uint64 `json:"savedRequests"`  // Messages - Frames
+}
+
+// linkCounters is updated atomically; first in Batcher for 64-bit alignment
+type linkCounters struct {
+	messages       uint64
+	frames         uint64
+	failed         uint64
+	unbatchedBytes uint64
+	encodedBytes   uint64
+	sentBytes      uint64
+}
+
+// Batcher sends the messages of one link in frames of up to MaxCount
+// messages, flushing a frame when it is full or its first message has waited
+// MaxDelay. It is safe for concurrent use.
+type Batcher struct {
+	counters linkCounters
+	from, to string
+	address  string
+	policy   BatchPolicy
+	onSent   func(msgs []Message, err error)
+
+	mu      sync.Mutex
+	pending []Message
+	timer   *time.Timer
+}
+
+// links holds every batcher created, for Links
+var links struct {
+	sync.Mutex
+	batchers []*Batcher
+}
+
+// NewBatcher creates the batcher of the link from one node to another at
+// address. onSent is called with the messages of every frame added through
+// Add once it was delivered or failed.
+func NewBatcher(from, to, address string, policy BatchPolicy, onSent func(msgs []Message, err error)) *Batcher {
+	b := &Batcher{from: from, to: to, address: address, policy: policy, onSent: onSent}
+	links.Lock()
+	links.batchers = append(links.batchers, b)
+	links.Unlock()
+	return b
+}
+
+// Links returns the stats of every link sending through a batcher, sorted by sender
+func Links() []LinkStats {
+	links.Lock()
+	batchers := append([]*Batcher(nil), links.batchers...)
+	links.Unlock()
+	stats := make([]LinkStats, len(batchers))
+	for i, b := range batchers {
+		stats[i] = b.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].From != stats[j].From {
+			return stats[i].From < stats[j].From
+		}
+		return stats[i].To < stats[j].To
+	})
+	return stats
+}
+
+// Add queues a message, sending its frame if that fills it
+func (b *Batcher) Add(msg Message) {
+	b.mu.Lock()
+	b.pending = append(b.pending, msg)
+	if len(b.pending) >= b.policy.MaxCount || b.policy.MaxDelay <= 0 {
+		batch := b.take()
+		b.mu.Unlock()
+		go b.send(batch)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.policy.MaxDelay, b.flush)
+	}
+	b.mu.Unlock()
+}
+
+// take removes the pending messages; b.mu must be held
+func (b *Batcher) take() []Message {
+	batch := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return batch
+}
+
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+func (b *Batcher) send(batch []Message) {
+	b.onSent(batch, b.Send(batch))
+}
+
+// Send sends messages as one frame right away, leaving out the pending
+// frame, and returns the outcome. The frame counts in the link's stats.
+func (b *Batcher) Send(batch []Message) error {
+	sent, err := sendFrame(b.from, b.address, batch, b.policy.Compression)
+
+	unbatched := 0
+	if sent.codec != nil {
+		for i := range batch {
+			if data, err := sent.codec.Marshal(batch[i : i+1]); err == nil {
+				unbatched += len(data)
+			}
+		}
+	}
+	atomic.AddUint64(&b.counters.messages, uint64(len(batch)))
+	atomic.AddUint64(&b.counters.frames, 1)
+	atomic.AddUint64(&b.counters.unbatchedBytes, uint64(unbatched))
+	atomic.AddUint64(&b.counters.encodedBytes, uint64(sent.encoded))
+	atomic.AddUint64(&b.counters.sentBytes, uint64(sent.sent))
+	if err != nil {
+		atomic.AddUint64(&b.counters.failed, uint64(len(batch)))
+	}
+	return err
+}
+
+// Stats returns a snapshot of the link's counters
+func (b *Batcher) Stats() LinkStats {
+	stats := LinkStats{
+		From:           b.from,
+		To:             b.to,
+		Messages:       atomic.LoadUint64(&b.counters.messages),
+		Frames:         atomic.LoadUint64(&b.counters.frames),
+		Failed:         atomic.LoadUint64(&b.counters.failed),
+		UnbatchedBytes: atomic.LoadUint64(&b.counters.unbatchedBytes),
+		EncodedBytes:   atomic.LoadUint64(&b.counters.encodedBytes),
+		SentBytes:      atomic.LoadUint64(&b.counters.sentBytes),
+	}
+	stats.SavedBytes = int64(stats.UnbatchedBytes) - int64(stats.SentBytes)
+	stats.SavedRequests = stats.Messages - stats.Frames
+	return stats
+}
@@ -0,0 +1,590 @@
+package satellite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"project3/pkg/protocol"
+	"time"
+)
+
+// Content types of the wire codecs
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeBinary = "application/x-maritime-message"
+)
+
+// binaryVersion is the version of the binary format, carried both as the first
+// byte of every frame and as the version parameter of its content type
+const binaryVersion = 1
+
+// Limits that keep a corrupt or hostile frame from allocating without bound
+const (
+	maxFrameMessages = 10000
+	maxStringLength  = 4096
+	maxPathLength    = 256
+)
+
+// Fixed-point scales of the binary format
+const (
+	coordinateScale = 1e7 // Degrees, about 1 cm at the equator
+	navigationScale = 10  // Speed, course and rate of turn, the resolution of AIS
+)
+
+// binaryEpoch is the reference of the first timestamp of a frame
+var binaryEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Bounds of the timestamps the binary format carries, about 292 years either
+// side of binaryEpoch; beyond them the offset from it would saturate
+var (
+	minBinaryTime = binaryEpoch.Add(math.MinInt64)
+	maxBinaryTime = binaryEpoch.Add(math.MaxInt64)
+)
+
+// Codec errors
+var (
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	ErrMalformedFrame         = errors.New("malformed binary frame")
+)
+
+// Codec encodes messages for the links between vessels, satellites and the
+// ground station. A frame holds one or more messages.
+type Codec interface {
+	ContentType() string
+	Marshal(msgs []Message) ([]byte, error)
+	Unmarshal(data []byte) ([]Message, error)
+}
+
+// JSONCodec is the original, human-readable encoding: a single message as an
+// object, several as an array
+var JSONCodec Codec = jsonCodec{}
+
+// BinaryCodec is the compact encoding (see binaryCodec)
+var BinaryCodec Codec = binaryCodec{}
+
+// CodecByName returns the codec configured by name, "json" or "binary"
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "json":
+		return JSONCodec, nil
+	case "binary", "":
+		return BinaryCodec, nil
+	}
+	return nil, fmt.Errorf("unknown wire codec %q", name)
+}
+
+// CodecForContentType returns the codec of a request's Content-Type header.
+// Requests without one are JSON, as sent before the binary codec existed.
+func CodecForContentType(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentType, err)
+	}
+	switch mediaType {
+	case ContentTypeJSON:
+		return JSONCodec, nil
+	case ContentTypeBinary:
+		if version, ok := params["version"]; ok && version != fmt.Sprint(binaryVersion) {
+			return nil, fmt.Errorf("%w: binary version %s", ErrUnsupportedContentType, version)
+		}
+		return BinaryCodec, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(msgs []Message) ([]byte, error) {
+	if len(msgs) == 1 {
+		return json.Marshal(msgs[0])
+	}
+	return json.Marshal(msgs)
+}
+
+func (jsonCodec) Unmarshal(data []byte) ([]Message, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var msgs []Message
+		err := json.Unmarshal(trimmed, &msgs)
+		return msgs, err
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return []Message{msg}, nil
+}
+
+// binaryCodec encodes a frame as a version byte and a message count followed
+// by the messages. Integers are varints, coordinates are fixed-point int32s,
+// navigation fields are fixed-point at AIS resolution and timestamps are
+// millisecond deltas from the previous message of the frame (the first from
+// binaryEpoch). Optional fields are announced by a flags varint.
+type binaryCodec struct{}
+
+// Message flags of the binary format
+const (
+	flagVesselID   = 1 << iota // Content.VesselID differs from Source
+	flagType                   // Content.Type is not protocol.PositionUpdate
+	flagMMSI                   // Content.MMSI is set
+	flagNavigation             // Content.Navigation is set
+	flagStatic                 // Content.Static is set
+	flagSignature              // Signature is set
+
+	knownFlags = flagSignature<<1 - 1
+)
+
+// Navigation field flags
+const (
+	navSpeed = 1 << iota
+	navCourse
+	navHeading
+	navRateOfTurn
+	navStatus
+)
+
+// Static data field flags
+const (
+	staticMMSI = 1 << iota
+	staticIMO
+	staticName
+	staticCallSign
+	staticShipType
+	staticDimensions
+	staticDraught
+	staticDestination
+)
+
+func (binaryCodec) ContentType() string {
+	return fmt.Sprintf("%s; version=%d", ContentTypeBinary, binaryVersion)
+}
+
+func (binaryCodec) Marshal(msgs []Message) ([]byte, error) {
+	w := &binaryWriter{buf: make([]byte, 0, 64*len(msgs))}
+	w.buf = append(w.buf, binaryVersion)
+	w.uvarint(uint64(len(msgs)))
+	var previous int64 // Milliseconds since binaryEpoch
+	for i := range msgs {
+		if err := w.message(&msgs[i], previous); err != nil {
+			return nil, err
+		}
+		previous = epochMillis(msgs[i].Content.Timestamp)
+	}
+	return w.buf, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte) ([]Message, error) {
+	r := &binaryReader{data: data}
+	if version := r.byte(); r.err == nil && version != binaryVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrMalformedFrame, version)
+	}
+	count := r.uvarint()
+	if r.err == nil && count > maxFrameMessages {
+		return nil, fmt.Errorf("%w: %d messages", ErrMalformedFrame, count)
+	}
+	capacity := count
+	if capacity > uint64(len(data)) {
+		capacity = uint64(len(data)) // Every message takes several bytes
+	}
+	msgs := make([]Message, 0, int(capacity))
+	previous := binaryEpoch
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		msg := r.message(previous)
+		previous = msg.Content.Timestamp
+		msgs = append(msgs, msg)
+	}
+	if r.err == nil && r.pos != len(data) {
+		r.fail("%d trailing bytes", len(data)-r.pos)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return msgs, nil
+}
+
+type binaryWriter struct {
+	buf []byte
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func (w *binaryWriter) varint(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *binaryWriter) fixed(v float64, scale float64) {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], uint32(int32(math.Round(v*scale))))
+	w.buf = append(w.buf, tmp[:]...)
+}
+
+// epochMillis truncates a timestamp to whole milliseconds since binaryEpoch.
+// Deltas are taken between truncated timestamps, so that every timestamp of a
+// frame decodes to its own truncation whatever precedes it.
+func epochMillis(t time.Time) int64 {
+	return t.Sub(binaryEpoch).Milliseconds()
+}
+
+func (w *binaryWriter) message(msg *Message, previous int64) error {
+	pos := &msg.Content
+	if math.IsNaN(pos.Latitude) || math.Abs(pos.Latitude) > 90 || math.IsNaN(pos.Longitude) || math.Abs(pos.Longitude) > 180 {
+		return fmt.Errorf("position %g, %g out of range", pos.Latitude, pos.Longitude)
+	}
+	if len(msg.Path) > maxPathLength {
+		return fmt.Errorf("path of %d satellites too long", len(msg.Path))
+	}
+	if pos.Timestamp.Before(minBinaryTime) || pos.Timestamp.After(maxBinaryTime) {
+		return fmt.Errorf("timestamp %s out of range", pos.Timestamp.Format(time.RFC3339))
+	}
+
+	var flags uint64
+	if pos.VesselID != msg.Source {
+		flags |= flagVesselID
+	}
+	if pos.Type != protocol.PositionUpdate {
+		flags |= flagType
+	}
+	if pos.MMSI != 0 {
+		flags |= flagMMSI
+	}
+	if pos.Navigation != nil {
+		flags |= flagNavigation
+	}
+	if pos.Static != nil {
+		flags |= flagStatic
+	}
+	if len(msg.Signature) > 0 {
+		flags |= flagSignature
+	}
+
+	w.uvarint(flags)
+	w.varint(int64(msg.ID))
+	w.string(msg.Source)
+	w.string(msg.Destination)
+	w.varint(int64(msg.Priority))
+	w.varint(int64(msg.TTL))
+	w.uvarint(uint64(len(msg.Path)))
+	for _, hop := range msg.Path {
+		w.string(hop)
+	}
+	if flags&flagType != 0 {
+		w.string(string(pos.Type))
+	}
+	if flags&flagVesselID != 0 {
+		w.string(pos.VesselID)
+	}
+	w.fixed(pos.Latitude, coordinateScale)
+	w.fixed(pos.Longitude, coordinateScale)
+	w.varint(epochMillis(pos.Timestamp) - previous)
+	if flags&flagMMSI != 0 {
+		w.uvarint(uint64(pos.MMSI))
+	}
+	if flags&flagNavigation != 0 {
+		w.navigation(pos.Navigation)
+	}
+	if flags&flagStatic != 0 {
+		w.static(pos.Static)
+	}
+	if flags&flagSignature != 0 {
+		w.string(string(msg.Signature))
+	}
+	return nil
+}
+
+func (w *binaryWriter) navigation(nav *protocol.Navigation) {
+	var fields uint64
+	if nav.SpeedOverGround != nil {
+		fields |= navSpeed
+	}
+	if nav.CourseOverGround != nil {
+		fields |= navCourse
+	}
+	if nav.Heading != nil {
+		fields |= navHeading
+	}
+	if nav.RateOfTurn != nil {
+		fields |= navRateOfTurn
+	}
+	if nav.Status != nil {
+		fields |= navStatus
+	}
+	w.uvarint(fields)
+	if nav.SpeedOverGround != nil {
+		w.uvarint(uint64(math.Round(math.Max(0, *nav.SpeedOverGround) * navigationScale)))
+	}
+	if nav.CourseOverGround != nil {
+		w.uvarint(uint64(math.Round(math.Max(0, *nav.CourseOverGround) * navigationScale)))
+	}
+	if nav.Heading != nil {
+		w.varint(int64(*nav.Heading))
+	}
+	if nav.RateOfTurn != nil {
+		w.varint(int64(math.Round(*nav.RateOfTurn * navigationScale)))
+	}
+	if nav.Status != nil {
+		w.uvarint(uint64(*nav.Status))
+	}
+}
+
+func (w *binaryWriter) static(info *protocol.VesselInfo) {
+	var fields uint64
+	if info.MMSI != 0 {
+		fields |= staticMMSI
+	}
+	if info.IMO != 0 {
+		fields |= staticIMO
+	}
+	if info.Name != "" {
+		fields |= staticName
+	}
+	if info.CallSign != "" {
+		fields |= staticCallSign
+	}
+	if info.ShipType != 0 {
+		fields |= staticShipType
+	}
+	if info.Dimensions != nil {
+		fields |= staticDimensions
+	}
+	if info.Draught != 0 {
+		fields |= staticDraught
+	}
+	if info.Destination != "" {
+		fields |= staticDestination
+	}
+	w.uvarint(fields)
+	if fields&staticMMSI != 0 {
+		w.uvarint(uint64(info.MMSI))
+	}
+	if fields&staticIMO != 0 {
+		w.uvarint(uint64(info.IMO))
+	}
+	if fields&staticName != 0 {
+		w.string(info.Name)
+	}
+	if fields&staticCallSign != 0 {
+		w.string(info.CallSign)
+	}
+	if fields&staticShipType != 0 {
+		w.uvarint(uint64(info.ShipType))
+	}
+	if d := info.Dimensions; d != nil {
+		w.uvarint(uint64(d.ToBow))
+		w.uvarint(uint64(d.ToStern))
+		w.uvarint(uint64(d.ToPort))
+		w.uvarint(uint64(d.ToStarboard))
+	}
+	if fields&staticDraught != 0 {
+		w.uvarint(uint64(math.Round(info.Draught * navigationScale)))
+	}
+	if fields&staticDestination != 0 {
+		w.string(info.Destination)
+	}
+}
+
+// binaryReader decodes a frame, keeping the first error: once it is set,
+// every read returns zero values
+type binaryReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *binaryReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s at byte %d", ErrMalformedFrame, fmt.Sprintf(format, args...), r.pos)
+	}
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) string() string {
+	length := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if length > maxStringLength || length > uint64(len(r.data)-r.pos) {
+		r.fail("invalid string length %d", length)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+int(length)])
+	r.pos += int(length)
+	return s
+}
+
+func (r *binaryReader) fixed(scale float64) float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data)-r.pos < 4 {
+		r.fail("unexpected end")
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(r.data[r.pos:]))
+	r.pos += 4
+	return float64(v) / scale
+}
+
+func (r *binaryReader) message(previous time.Time) Message {
+	flags := r.uvarint()
+	if flags&^knownFlags != 0 {
+		r.fail("unknown flags %#x", flags&^knownFlags)
+	}
+	msg := Message{
+		ID:          int(r.varint()),
+		Source:      r.string(),
+		Destination: r.string(),
+		Priority:    int(r.varint()),
+		TTL:         int(r.varint()),
+	}
+	hops := r.uvarint()
+	if hops > maxPathLength {
+		r.fail("path of %d satellites", hops)
+		return msg
+	}
+	for i := uint64(0); i < hops && r.err == nil; i++ {
+		msg.Path = append(msg.Path, r.string())
+	}
+
+	pos := &msg.Content
+	pos.Type, pos.VesselID = protocol.PositionUpdate, msg.Source
+	if flags&flagType != 0 {
+		pos.Type = protocol.MessageType(r.string())
+	}
+	if flags&flagVesselID != 0 {
+		pos.VesselID = r.string()
+	}
+	pos.Latitude = r.fixed(coordinateScale)
+	pos.Longitude = r.fixed(coordinateScale)
+	pos.Timestamp = previous.Add(time.Duration(r.varint()) * time.Millisecond).UTC()
+	if flags&flagMMSI != 0 {
+		pos.MMSI = uint32(r.uvarint())
+	}
+	if flags&flagNavigation != 0 {
+		pos.Navigation = r.navigation()
+	}
+	if flags&flagStatic != 0 {
+		pos.Static = r.static()
+	}
+	if flags&flagSignature != 0 {
+		msg.Signature = []byte(r.string())
+	}
+	return msg
+}
+
+func (r *binaryReader) navigation() *protocol.Navigation {
+	fields := r.uvarint()
+	nav := &protocol.Navigation{}
+	if fields&navSpeed != 0 {
+		speed := float64(r.uvarint()) / navigationScale
+		nav.SpeedOverGround = &speed
+	}
+	if fields&navCourse != 0 {
+		course := float64(r.uvarint()) / navigationScale
+		nav.CourseOverGround = &course
+	}
+	if fields&navHeading != 0 {
+		heading := int(r.varint())
+		nav.Heading = &heading
+	}
+	if fields&navRateOfTurn != 0 {
+		rateOfTurn := float64(r.varint()) / navigationScale
+		nav.RateOfTurn = &rateOfTurn
+	}
+	if fields&navStatus != 0 {
+		status := protocol.NavigationStatus(r.uvarint())
+		nav.Status = &status
+	}
+	return nav
+}
+
+func (r *binaryReader) static() *protocol.VesselInfo {
+	fields := r.uvarint()
+	info := &protocol.VesselInfo{}
+	if fields&staticMMSI != 0 {
+		info.MMSI = uint32(r.uvarint())
+	}
+	if fields&staticIMO != 0 {
+		info.IMO = uint32(r.uvarint())
+	}
+	if fields&staticName != 0 {
+		info.Name = r.string()
+	}
+	if fields&staticCallSign != 0 {
+		info.CallSign = r.string()
+	}
+	if fields&staticShipType != 0 {
+		info.ShipType = protocol.ShipType(r.uvarint())
+	}
+	if fields&staticDimensions != 0 {
+		info.Dimensions = &protocol.Dimensions{
+			ToBow:       int(r.uvarint()),
+			ToStern:     int(r.uvarint()),
+			ToPort:      int(r.uvarint()),
+			ToStarboard: int(r.uvarint()),
+		}
+	}
+	if fields&staticDraught != 0 {
+		info.Draught = float64(r.uvarint()) / navigationScale
+	}
+	if fields&staticDestination != 0 {
+		info.Destination = r.string()
+	}
+	return info
+}
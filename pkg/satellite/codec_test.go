@@ -0,0 +1,266 @@
+package satellite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"project3/pkg/protocol"
+	"testing"
+	"time"
+)
+
+// testMessage is a report that crossed two satellites, with values at the
+// resolution of the binary format so that it survives a round trip exactly
+func testMessage(i int, withStatic bool) Message {
+	speed, course, rateOfTurn := 14.4, 39.3+float64(i%10), -3.7
+	heading := 36 + i%10
+	status := protocol.UnderWayUsingEngine
+	msg := Message{
+		ID:          1792304715 + i,
+		Source:      "Vessel-1",
+		Destination: "GroundStation",
+		Priority:    6,
+		TTL:         3,
+		Path:        []string{"Satellite-1", "Satellite-2"},
+		Content: protocol.PositionMessage{
+			Type:      protocol.PositionUpdate,
+			VesselID:  "Vessel-1",
+			Latitude:  float64(-216348342+3000*i) / coordinateScale,
+			Longitude: float64(-1358047642+2000*i) / coordinateScale,
+			Timestamp: time.Date(2026, 10, 18, 6, 25, 15, 563000000, time.UTC).Add(time.Duration(i) * 5 * time.Second),
+			MMSI:      235009801,
+			Navigation: &protocol.Navigation{
+				SpeedOverGround:  &speed,
+				CourseOverGround: &course,
+				Heading:          &heading,
+				RateOfTurn:       &rateOfTurn,
+				Status:           &status,
+			},
+		},
+	}
+	if withStatic {
+		msg.Content.Static = &protocol.VesselInfo{
+			MMSI:        235009801,
+			IMO:         9321471,
+			Name:        "NORTHERN STAR",
+			CallSign:    "2AFB1",
+			ShipType:    70,
+			Dimensions:  &protocol.Dimensions{ToBow: 143, ToStern: 47, ToPort: 15, ToStarboard: 15},
+			Draught:     10.2,
+			Destination: "ROTTERDAM",
+		}
+	}
+	return msg
+}
+
+// testBatch is consecutive reports of one vessel, every twelfth with static data
+func testBatch(n int) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = testMessage(i, i%12 == 0)
+	}
+	return msgs
+}
+
+// codecWorkload is a set of messages encoded as one frame
+type codecWorkload struct {
+	name string
+	msgs []Message
+}
+
+// codecWorkloads are the frames the codecs are tested on
+func codecWorkloads() []codecWorkload {
+	bare := Message{ID: 7, Source: "Vessel-2", Destination: "GroundStation", Content: protocol.PositionMessage{
+		Type:      protocol.PositionUpdate,
+		VesselID:  "Vessel-2",
+		Timestamp: binaryEpoch,
+	}}
+	other := testMessage(1, false)
+	other.Content.Type = protocol.MessageType("StatusUpdate")
+	other.Content.VesselID = "Vessel-9"
+	other.Signature = []byte{0x00, 0xff, 0x10, 0x80}
+	earlier := testMessage(2, false)
+	earlier.Content.Timestamp = time.Date(2019, 3, 1, 12, 0, 0, 1000000, time.UTC)
+
+	return []codecWorkload{
+		{"position", []Message{testMessage(0, false)}},
+		{"position+static", []Message{testMessage(0, true)}},
+		{"bare", []Message{bare}},
+		{"signed other vessel", []Message{other}},
+		{"before epoch", []Message{testMessage(0, false), earlier}},
+		{"batch of 100", testBatch(100)},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		for _, load := range codecWorkloads() {
+			t.Run(fmt.Sprintf("%s/%s", codec.ContentType(), load.name), func(t *testing.T) {
+				data, err := codec.Marshal(load.msgs)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				decoded, err := codec.Unmarshal(data)
+				if err != nil {
+					t.Fatalf("Unmarshal: %v", err)
+				}
+				want, _ := json.Marshal(load.msgs)
+				got, _ := json.Marshal(decoded)
+				if string(got) != string(want) {
+					t.Errorf("round trip changed the messages\ngot  %s\nwant %s", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestBinaryCodecTruncatesToResolution(t *testing.T) {
+	msg := testMessage(0, false)
+	msg.Content.Latitude = 12.345678912
+	msg.Content.Timestamp = msg.Content.Timestamp.Add(789 * time.Microsecond)
+	speed := 14.46
+	msg.Content.Navigation.SpeedOverGround = &speed
+
+	data, err := BinaryCodec.Marshal([]Message{msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := BinaryCodec.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decoded[0].Content
+	if got.Latitude != 12.3456789 {
+		t.Errorf("latitude = %v, want 12.3456789", got.Latitude)
+	}
+	if want := msg.Content.Timestamp.Truncate(time.Millisecond); !got.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", got.Timestamp, want)
+	}
+	if *got.Navigation.SpeedOverGround != 14.5 {
+		t.Errorf("speed = %v, want 14.5", *got.Navigation.SpeedOverGround)
+	}
+}
+
+func TestBinaryCodecRejectsOutOfRange(t *testing.T) {
+	zeroTime := testMessage(0, false)
+	zeroTime.Content.Timestamp = time.Time{}
+	farFuture := testMessage(0, false)
+	farFuture.Content.Timestamp = time.Date(2400, 1, 1, 0, 0, 0, 0, time.UTC)
+	latitude := testMessage(0, false)
+	latitude.Content.Latitude = 90.5
+
+	for name, msg := range map[string]Message{"zero timestamp": zeroTime, "far future": farFuture, "latitude": latitude} {
+		if _, err := BinaryCodec.Marshal([]Message{msg}); err == nil {
+			t.Errorf("%s: Marshal succeeded, want an error", name)
+		}
+	}
+}
+
+func TestBinaryCodecRejectsMalformed(t *testing.T) {
+	data, err := BinaryCodec.Marshal(testBatch(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]byte{
+		"empty":          {},
+		"version":        append([]byte{binaryVersion + 1}, data[1:]...),
+		"truncated":      data[:len(data)-5],
+		"trailing bytes": append(append([]byte(nil), data...), 0),
+		"huge count":     {binaryVersion, 0xff, 0xff, 0xff, 0xff, 0x0f},
+	}
+	for name, frame := range cases {
+		if _, err := BinaryCodec.Unmarshal(frame); !errors.Is(err, ErrMalformedFrame) {
+			t.Errorf("%s: got %v, want ErrMalformedFrame", name, err)
+		}
+	}
+}
+
+func TestCodecForContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		want        Codec
+	}{
+		{"", JSONCodec},
+		{"application/json", JSONCodec},
+		{"application/json; charset=utf-8", JSONCodec},
+		{BinaryCodec.ContentType(), BinaryCodec},
+		{ContentTypeBinary, BinaryCodec},
+		{ContentTypeBinary + "; version=2", nil},
+		{"text/plain", nil},
+	}
+	for _, c := range cases {
+		codec, err := CodecForContentType(c.contentType)
+		if c.want == nil {
+			if !errors.Is(err, ErrUnsupportedContentType) {
+				t.Errorf("%q: got %v, want ErrUnsupportedContentType", c.contentType, err)
+			}
+			continue
+		}
+		if err != nil || codec != c.want {
+			t.Errorf("%q: got %v, %v", c.contentType, codec, err)
+		}
+	}
+}
+
+// BenchmarkMarshal compares the encoding speed of the codecs, and reports
+// the encoded size of a message
+func BenchmarkMarshal(b *testing.B) {
+	for _, load := range benchmarkWorkloads() {
+		for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+			b.Run(load.name+"/"+codecName(codec), func(b *testing.B) {
+				data, err := codec.Marshal(load.msgs)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(load.msgs); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data))/float64(len(load.msgs)), "bytes/msg")
+			})
+		}
+	}
+}
+
+// BenchmarkUnmarshal compares the decoding speed of the codecs
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, load := range benchmarkWorkloads() {
+		for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+			b.Run(load.name+"/"+codecName(codec), func(b *testing.B) {
+				data, err := codec.Marshal(load.msgs)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Unmarshal(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data))/float64(len(load.msgs)), "bytes/msg")
+			})
+		}
+	}
+}
+
+// benchmarkWorkloads are the frames the codecs are benchmarked on
+func benchmarkWorkloads() []codecWorkload {
+	return []codecWorkload{
+		{"position", []Message{testMessage(0, false)}},
+		{"static", []Message{testMessage(0, true)}},
+		{"batch100", testBatch(100)},
+	}
+}
+
+func codecName(codec Codec) string {
+	if codec == JSONCodec {
+		return "json"
+	}
+	return "binary"
+}
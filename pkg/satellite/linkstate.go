@@ -0,0 +1,473 @@
+package satellite
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"mime"
+	"project3/pkg/transport"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ContentTypeRouting is the content type of the frames of the link-state protocol
+const ContentTypeRouting = "application/x-maritime-routing+json"
+
+// RoutingPacket is a frame of the link-state protocol: a hello, link-state
+// advertisements, or both. A hello tells the neighbor where to reach its
+// sender and the link as the sender has it configured.
+type RoutingPacket struct {
+	From       string  `json:"from"`
+	Hello      bool    `json:"hello,omitempty"`
+	Address    string  `json:"address,omitempty"`
+	Latency    int     `json:"latencyMs,omitempty"`
+	PacketLoss float64 `json:"packetLoss,omitempty"`
+	LSAs       []LSA   `json:"lsas,omitempty"`
+}
+
+// LSA is the link-state advertisement of a satellite: its links to the
+// neighbors it hears hellos from, and its ground link if it is a gateway
+type LSA struct {
+	Origin     string           `json:"origin"`
+	Seq        uint64           `json:"seq"` // Higher replaces lower
+	Links      []AdvertisedLink `json:"links"`
+	GroundLink *GroundLink      `json:"groundLink,omitempty"`
+}
+
+// AdvertisedLink is a link of an LSA
+type AdvertisedLink struct {
+	Neighbor   string  `json:"neighbor"`
+	Latency    int     `json:"latencyMs"`
+	PacketLoss float64 `json:"packetLoss"`
+}
+
+// RoutingStats counts the work of a satellite's router
+type RoutingStats struct {
+	HellosSent     uint64 `json:"hellosSent"`
+	HellosReceived uint64 `json:"hellosReceived"`
+	LSAsSent       uint64 `json:"lsasSent"`
+	LSAsReceived   uint64 `json:"lsasReceived"`
+	Recomputes     uint64 `json:"recomputes"`
+	RouteChanges   uint64 `json:"routeChanges"` // Recomputes that changed a route
+}
+
+// NeighborState is what a router knows of one of its neighbors
+type NeighborState struct {
+	ID        string     `json:"id"`
+	Up        bool       `json:"up"`
+	LastHello *time.Time `json:"lastHello,omitempty"`
+}
+
+// LSAInfo summarizes an LSA of a router's topology database
+type LSAInfo struct {
+	Origin  string  `json:"origin"`
+	Seq     uint64  `json:"seq"`
+	Links   int     `json:"links"`
+	Gateway bool    `json:"gateway"`
+	AgeMs   float64 `json:"ageMs"`
+}
+
+// RouterInfo is a snapshot of a satellite's router
+type RouterInfo struct {
+	ID              string          `json:"id"`
+	Status          string          `json:"status"`
+	Converged       bool            `json:"converged"` // Its routes match the routes over the actual topology
+	RoutesChangedAt time.Time       `json:"routesChangedAt"`
+	Neighbors       []NeighborState `json:"neighbors"`
+	Database        []LSAInfo       `json:"database"`
+	Stats           RoutingStats    `json:"stats"`
+}
+
+// lsdbEntry is an LSA of the topology database and when it arrived
+type lsdbEntry struct {
+	lsa        LSA
+	receivedAt time.Time
+}
+
+// adjacency is what a router learned of a neighbor from its hellos
+type adjacency struct {
+	address    string
+	latency    int
+	packetLoss float64
+	lastHello  time.Time
+	up         bool
+}
+
+// Router runs the link-state protocol of a satellite. It sends hellos over
+// the satellite's configured links, learns its neighbors from the hellos it
+// receives and declares one down once they stop, floods LSAs, and computes
+// the satellite's routes from its own topology database.
+type Router struct {
+	sat        *Satellite
+	policy     RoutingPolicy
+	mu         sync.Mutex
+	adjacent   map[string]*adjacency // By neighbor ID
+	lsdb       map[string]lsdbEntry  // By origin
+	seq        uint64
+	originated time.Time
+	changedAt  time.Time
+	stats      RoutingStats
+	stop       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+}
+
+// newRouter creates the router of a satellite
+func newRouter(sat *Satellite, policy RoutingPolicy) *Router {
+	return &Router{
+		sat:      sat,
+		policy:   policy,
+		adjacent: make(map[string]*adjacency),
+		lsdb:     make(map[string]lsdbEntry),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run sends hellos and ages the topology database every hello interval until the router stops
+func (r *Router) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.policy.HelloInterval)
+	defer ticker.Stop()
+	r.tick(time.Now())
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.tick(now)
+		}
+	}
+}
+
+// Stop stops the router and waits for its hello loop to end
+func (r *Router) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// stopped reports whether the router was stopped
+func (r *Router) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// tick runs one hello interval: hellos out, dead neighbors down, own LSA
+// refreshed and stale LSAs expired
+func (r *Router) tick(now time.Time) {
+	if r.sat.failed() {
+		return
+	}
+	address := r.sat.Address()
+	for _, l := range r.sat.links() {
+		r.sendTo(l, RoutingPacket{Hello: true, Address: address, Latency: l.latency, PacketLoss: l.packetLoss})
+	}
+
+	r.mu.Lock()
+	changed := false
+	for id, adj := range r.adjacent {
+		if adj.up && now.Sub(adj.lastHello) > r.policy.DeadInterval {
+			log.Printf("Satellite %s lost neighbor %s: no hello for %v", r.sat.ID, id, now.Sub(adj.lastHello).Round(time.Millisecond))
+			adj.up = false
+			changed = true
+		}
+	}
+	expired := false
+	for origin, entry := range r.lsdb {
+		if origin != r.sat.ID && now.Sub(entry.receivedAt) > r.policy.MaxAge() {
+			delete(r.lsdb, origin)
+			expired = true
+		}
+	}
+	var flood []LSA
+	if changed || now.Sub(r.originated) >= r.policy.Refresh {
+		flood = append(flood, r.originate(now))
+	}
+	if changed || expired {
+		r.recompute(now)
+	}
+	r.mu.Unlock()
+
+	if len(flood) > 0 {
+		r.flood(flood, "")
+	}
+}
+
+// originate issues a new LSA of the satellite and installs it; callers hold r.mu
+func (r *Router) originate(now time.Time) LSA {
+	r.seq++
+	lsa := LSA{Origin: r.sat.ID, Seq: r.seq, Links: []AdvertisedLink{}}
+	for _, id := range r.neighborIDs() {
+		if adj := r.adjacent[id]; adj.up {
+			lsa.Links = append(lsa.Links, AdvertisedLink{Neighbor: id, Latency: adj.latency, PacketLoss: adj.packetLoss})
+		}
+	}
+	r.sat.mu.Lock()
+	lsa.GroundLink = r.sat.GroundLink
+	r.sat.mu.Unlock()
+	r.lsdb[lsa.Origin] = lsdbEntry{lsa: lsa, receivedAt: now}
+	r.originated = now
+	return lsa
+}
+
+// handle processes a routing frame from a neighbor
+func (r *Router) handle(frame transport.Frame, peer transport.Peer) error {
+	var packet RoutingPacket
+	if err := json.Unmarshal(frame.Body, &packet); err != nil {
+		return fmt.Errorf("%w: %v", transport.ErrMalformed, err)
+	}
+	if peer.ID != "" && peer.ID != packet.From {
+		return fmt.Errorf("%w: %s sent routing packet as %s", transport.ErrForbidden, peer.ID, packet.From)
+	}
+	if _, ok := r.sat.linkTo(packet.From); !ok {
+		return fmt.Errorf("%w: %s is not a neighbor of %s", transport.ErrForbidden, packet.From, r.sat.ID)
+	}
+
+	now := time.Now()
+	var own, relay, database []LSA
+	var syncTo link
+	r.mu.Lock()
+	adj := r.adjacent[packet.From]
+	if packet.Hello {
+		r.stats.HellosReceived++
+		if adj == nil {
+			adj = &adjacency{}
+			r.adjacent[packet.From] = adj
+		}
+		adj.lastHello = now
+		linkChanged := adj.address != packet.Address || adj.latency != packet.Latency || adj.packetLoss != packet.PacketLoss
+		adj.address, adj.latency, adj.packetLoss = packet.Address, packet.Latency, packet.PacketLoss
+		if !adj.up {
+			// A new adjacency: advertise it and hand the neighbor the whole database
+			log.Printf("Satellite %s found neighbor %s", r.sat.ID, packet.From)
+			adj.up = true
+			own = append(own, r.originate(now))
+			for _, entry := range r.lsdb {
+				database = append(database, entry.lsa)
+			}
+			syncTo = link{neighbor: packet.From, address: adj.address, latency: adj.latency, packetLoss: adj.packetLoss}
+		} else if linkChanged {
+			own = append(own, r.originate(now))
+		}
+	}
+	changed := len(own) > 0
+	for _, lsa := range packet.LSAs {
+		r.stats.LSAsReceived++
+		if lsa.Origin == r.sat.ID {
+			// An LSA of an earlier life of this satellite; outdo it
+			if lsa.Seq >= r.seq {
+				r.seq = lsa.Seq
+				own = append(own, r.originate(now))
+			}
+			continue
+		}
+		if known, ok := r.lsdb[lsa.Origin]; ok && known.lsa.Seq >= lsa.Seq {
+			continue
+		}
+		r.lsdb[lsa.Origin] = lsdbEntry{lsa: lsa, receivedAt: now}
+		relay = append(relay, lsa)
+		changed = true
+	}
+	if changed {
+		r.recompute(now)
+	}
+	r.mu.Unlock()
+
+	if len(database) > 0 {
+		r.sendTo(syncTo, RoutingPacket{LSAs: database})
+	}
+	if len(own) > 0 {
+		r.flood(own, "")
+	}
+	if len(relay) > 0 {
+		r.flood(relay, packet.From)
+	}
+	return nil
+}
+
+// recompute computes the satellite's routes from the topology database. A
+// link counts only when the LSAs of both its ends advertise it. Callers hold r.mu.
+func (r *Router) recompute(now time.Time) {
+	graph := make(Graph)
+	gateways := make(map[string]float64)
+	for origin, entry := range r.lsdb {
+		if link := entry.lsa.GroundLink; link != nil {
+			if cost, usable := LinkCost(link.Latency, link.PacketLoss, r.policy.WeightByLoss); usable {
+				gateways[origin] = cost
+			}
+		}
+		for _, link := range entry.lsa.Links {
+			if !r.advertises(link.Neighbor, origin) {
+				continue
+			}
+			if cost, usable := LinkCost(link.Latency, link.PacketLoss, r.policy.WeightByLoss); usable {
+				graph.AddLink(origin, link.Neighbor, cost)
+			}
+		}
+	}
+
+	table := ComputeRoutes(graph, r.sat.ID, gateways)
+	r.stats.Recomputes++
+	previous := r.sat.Routes()
+	changed := !sameRoutes(previous, table)
+	if changed {
+		r.stats.RouteChanges++
+		r.changedAt = now
+	}
+	if ground, ok := table.Route("GroundStation"); ok {
+		if before, had := previous.Route("GroundStation"); !had || !samePath(before.Path, ground.Path) {
+			log.Printf("Satellite %s routes to the ground station via %v (cost %.1fms)", r.sat.ID, ground.Path, ground.Cost)
+		}
+	} else if _, had := previous.Route("GroundStation"); had {
+		log.Printf("Satellite %s lost its route to the ground station", r.sat.ID)
+	}
+	r.sat.setRoutes(table)
+	if changed {
+		go r.sat.rerouteQueues()
+	}
+}
+
+// advertises reports whether the LSA of origin lists a link to neighbor; callers hold r.mu
+func (r *Router) advertises(origin, neighbor string) bool {
+	entry, ok := r.lsdb[origin]
+	if !ok {
+		return false
+	}
+	for _, link := range entry.lsa.Links {
+		if link.Neighbor == neighbor {
+			return true
+		}
+	}
+	return false
+}
+
+// neighborIDs returns the IDs of the neighbors heard from, sorted; callers hold r.mu
+func (r *Router) neighborIDs() []string {
+	ids := make([]string, 0, len(r.adjacent))
+	for id := range r.adjacent {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// flood sends LSAs to every neighbor that is up, except the one they came from,
+// at the address and over the link its hellos announced
+func (r *Router) flood(lsas []LSA, except string) {
+	r.mu.Lock()
+	var targets []link
+	for _, id := range r.neighborIDs() {
+		if adj := r.adjacent[id]; id != except && adj.up {
+			targets = append(targets, link{neighbor: id, address: adj.address, latency: adj.latency, packetLoss: adj.packetLoss})
+		}
+	}
+	r.mu.Unlock()
+	for _, target := range targets {
+		r.sendTo(target, RoutingPacket{LSAs: lsas})
+	}
+}
+
+// sendTo sends a routing packet over a link in the background, subject to
+// its simulated latency and loss. A lost hello is left to the next one;
+// LSAs are sent again every hello interval until the neighbor has them,
+// goes down or the router stops.
+func (r *Router) sendTo(l link, packet RoutingPacket) {
+	packet.From = r.sat.ID
+	r.mu.Lock()
+	if packet.Hello {
+		r.stats.HellosSent++
+	}
+	r.stats.LSAsSent += uint64(len(packet.LSAs))
+	r.mu.Unlock()
+
+	go func() {
+		for {
+			time.Sleep(time.Duration(l.latency) * time.Millisecond)
+			err := fmt.Errorf("lost on the link from %s to %s", r.sat.ID, l.neighbor)
+			if rand.Float64() >= l.packetLoss {
+				err = sendRouting(r.sat.ID, l.address, packet)
+			}
+			if err == nil || packet.Hello || !r.isUp(l.neighbor) {
+				return
+			}
+			log.Printf("Satellite %s failed to send LSAs to %s, retrying: %v", r.sat.ID, l.neighbor, err)
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(r.policy.HelloInterval):
+			}
+		}
+	}()
+}
+
+// isUp reports whether a neighbor's hellos arrive
+func (r *Router) isUp(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	adj, ok := r.adjacent[id]
+	return ok && adj.up && !r.stopped() && !r.sat.failed()
+}
+
+// reset forgets the neighbors and the topology learned from them, as a
+// satellite coming back from a failure would
+func (r *Router) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.adjacent = make(map[string]*adjacency)
+	r.lsdb = make(map[string]lsdbEntry)
+	r.originate(now)
+	r.recompute(now)
+}
+
+// Info returns a snapshot of the router: the neighbors of its configured
+// links and what their hellos told it, and its topology database
+func (r *Router) Info() RouterInfo {
+	now := time.Now()
+	info := RouterInfo{ID: r.sat.ID, Status: r.sat.Info().Status, Neighbors: []NeighborState{}, Database: []LSAInfo{}}
+	links := r.sat.links()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range links {
+		state := NeighborState{ID: l.neighbor}
+		if adj, ok := r.adjacent[l.neighbor]; ok {
+			last := adj.lastHello
+			state.Up, state.LastHello = adj.up, &last
+		}
+		info.Neighbors = append(info.Neighbors, state)
+	}
+	for _, entry := range r.lsdb {
+		info.Database = append(info.Database, LSAInfo{
+			Origin:  entry.lsa.Origin,
+			Seq:     entry.lsa.Seq,
+			Links:   len(entry.lsa.Links),
+			Gateway: entry.lsa.GroundLink != nil,
+			AgeMs:   float64(now.Sub(entry.receivedAt)) / float64(time.Millisecond),
+		})
+	}
+	sort.Slice(info.Database, func(i, j int) bool { return info.Database[i].Origin < info.Database[j].Origin })
+	info.RoutesChangedAt = r.changedAt
+	info.Stats = r.stats
+	return info
+}
+
+// sendRouting sends a routing packet from a node to a satellite
+func sendRouting(from, address string, packet RoutingPacket) error {
+	body, err := json.Marshal(packet)
+	if err != nil {
+		return fmt.Errorf("failed to encode routing packet: %w", err)
+	}
+	return transport.Send(from, address, transport.Frame{ContentType: ContentTypeRouting, Body: body})
+}
+
+// isRoutingFrame reports whether a frame belongs to the link-state protocol
+func isRoutingFrame(frame transport.Frame) bool {
+	mediaType, _, err := mime.ParseMediaType(frame.ContentType)
+	return err == nil && mediaType == ContentTypeRouting
+}
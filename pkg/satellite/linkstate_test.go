@@ -0,0 +1,196 @@
+package satellite
+
+import (
+	"encoding/json"
+	"errors"
+	"project3/pkg/transport"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRouter returns the router of Satellite-1, linked to Satellite-2 and
+// Satellite-3 at addresses nothing listens on. The router's loop is not
+// started; the test drives it through handle and tick.
+func testRouter(t *testing.T) *Router {
+	t.Helper()
+	sat := &Satellite{
+		ID:            "Satellite-1",
+		Port:          1,
+		LatencyMap:    map[string]int{"Satellite-2": 10, "Satellite-3": 20},
+		PacketLossMap: map[string]float64{},
+		Status:        "Active",
+	}
+	sat.addNeighbor(&Satellite{ID: "Satellite-2", Port: 2})
+	sat.addNeighbor(&Satellite{ID: "Satellite-3", Port: 3})
+	r := newRouter(sat, RoutingPolicy{HelloInterval: time.Hour, DeadInterval: 4 * time.Hour, Refresh: 24 * time.Hour})
+	sat.router = r
+	t.Cleanup(func() { r.stopOnce.Do(func() { close(r.stop) }) })
+	return r
+}
+
+func routingFrame(t *testing.T, packet RoutingPacket) transport.Frame {
+	t.Helper()
+	body, err := json.Marshal(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport.Frame{ContentType: ContentTypeRouting, Body: body}
+}
+
+func hello(from string, latency int) RoutingPacket {
+	return RoutingPacket{From: from, Hello: true, Address: "127.0.0.1:9", Latency: latency}
+}
+
+// lsaOf returns the LSA of origin in the topology database of r
+func lsaOf(r *Router, origin string) (LSA, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.lsdb[origin]
+	return entry.lsa, ok
+}
+
+func TestRouterRefusesPacketsOfStrangers(t *testing.T) {
+	r := testRouter(t)
+	cases := map[string]struct {
+		frame transport.Frame
+		peer  transport.Peer
+		want  error
+	}{
+		"malformed":      {transport.Frame{ContentType: ContentTypeRouting, Body: []byte("{")}, transport.Peer{}, transport.ErrMalformed},
+		"not a neighbor": {routingFrame(t, hello("Satellite-4", 10)), transport.Peer{}, transport.ErrForbidden},
+		"impersonation":  {routingFrame(t, hello("Satellite-2", 10)), transport.Peer{ID: "Satellite-3"}, transport.ErrForbidden},
+	}
+	for name, c := range cases {
+		if err := r.handle(c.frame, c.peer); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", name, err, c.want)
+		}
+	}
+	if info := r.Info(); len(info.Database) != 0 || info.Stats.HellosReceived != 0 {
+		t.Errorf("refused packets changed the router: %+v", info)
+	}
+}
+
+func TestRouterLearnsAdjacencyFromHello(t *testing.T) {
+	r := testRouter(t)
+	if err := r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{ID: "Satellite-2"}); err != nil {
+		t.Fatal(err)
+	}
+	own, ok := lsaOf(r, "Satellite-1")
+	want := []AdvertisedLink{{Neighbor: "Satellite-2", Latency: 10}}
+	if !ok || own.Seq != 1 || !reflect.DeepEqual(own.Links, want) {
+		t.Errorf("own LSA %+v, want sequence 1 advertising %+v", own, want)
+	}
+
+	// A hello announcing the same link again changes nothing
+	if err := r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{}); err != nil {
+		t.Fatal(err)
+	}
+	if own, _ := lsaOf(r, "Satellite-1"); own.Seq != 1 {
+		t.Errorf("repeated hello issued LSA %d", own.Seq)
+	}
+
+	// A hello announcing a new latency is advertised
+	if err := r.handle(routingFrame(t, hello("Satellite-2", 30)), transport.Peer{}); err != nil {
+		t.Fatal(err)
+	}
+	if own, _ := lsaOf(r, "Satellite-1"); own.Seq != 2 || own.Links[0].Latency != 30 {
+		t.Errorf("own LSA %+v after the link changed, want sequence 2 at 30ms", own)
+	}
+	if stats := r.Info().Stats; stats.HellosReceived != 3 {
+		t.Errorf("%d hellos received, want 3", stats.HellosReceived)
+	}
+}
+
+func TestRouterKeepsNewestLSA(t *testing.T) {
+	r := testRouter(t)
+	r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{})
+
+	send := func(seq uint64, latency int) {
+		t.Helper()
+		lsa := LSA{Origin: "Satellite-3", Seq: seq, Links: []AdvertisedLink{{Neighbor: "Satellite-2", Latency: latency}}}
+		if err := r.handle(routingFrame(t, RoutingPacket{From: "Satellite-2", LSAs: []LSA{lsa}}), transport.Peer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(5, 10)
+	send(3, 99) // Older, ignored
+	if lsa, ok := lsaOf(r, "Satellite-3"); !ok || lsa.Seq != 5 {
+		t.Fatalf("LSA %+v, want sequence 5", lsa)
+	}
+	send(6, 40)
+	if lsa, _ := lsaOf(r, "Satellite-3"); lsa.Seq != 6 || lsa.Links[0].Latency != 40 {
+		t.Errorf("LSA %+v, want sequence 6 at 40ms", lsa)
+	}
+	if stats := r.Info().Stats; stats.LSAsReceived != 3 {
+		t.Errorf("%d LSAs received, want 3", stats.LSAsReceived)
+	}
+}
+
+func TestRouterOutdoesItsEarlierLife(t *testing.T) {
+	r := testRouter(t)
+	r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{})
+	old := LSA{Origin: "Satellite-1", Seq: 41, Links: []AdvertisedLink{{Neighbor: "Satellite-3", Latency: 20}}}
+	if err := r.handle(routingFrame(t, RoutingPacket{From: "Satellite-2", LSAs: []LSA{old}}), transport.Peer{}); err != nil {
+		t.Fatal(err)
+	}
+	own, _ := lsaOf(r, "Satellite-1")
+	want := []AdvertisedLink{{Neighbor: "Satellite-2", Latency: 10}}
+	if own.Seq != 42 || !reflect.DeepEqual(own.Links, want) {
+		t.Errorf("own LSA %+v, want sequence 42 advertising the current links", own)
+	}
+}
+
+func TestRouterRoutesOverLinksBothEndsAdvertise(t *testing.T) {
+	r := testRouter(t)
+	r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{})
+
+	// Satellite-3 claims a link to Satellite-1 that Satellite-1 does not
+	// advertise, and Satellite-2 is a gateway
+	lsas := []LSA{
+		{Origin: "Satellite-2", Seq: 1, Links: []AdvertisedLink{{Neighbor: "Satellite-1", Latency: 10}}, GroundLink: &GroundLink{Latency: 50}},
+		{Origin: "Satellite-3", Seq: 1, Links: []AdvertisedLink{{Neighbor: "Satellite-1", Latency: 1}}, GroundLink: &GroundLink{Latency: 1}},
+	}
+	if err := r.handle(routingFrame(t, RoutingPacket{From: "Satellite-2", LSAs: lsas}), transport.Peer{}); err != nil {
+		t.Fatal(err)
+	}
+	routes := r.sat.Routes()
+	if _, ok := routes.Route("Satellite-3"); ok {
+		t.Error("route over a link only one end advertises")
+	}
+	ground, ok := routes.Route("GroundStation")
+	if want := []string{"Satellite-1", "Satellite-2", "GroundStation"}; !ok || !reflect.DeepEqual(ground.Path, want) || ground.Cost != 60 {
+		t.Errorf("ground route %+v, want %v at 60ms", ground, want)
+	}
+}
+
+func TestRouterAgesNeighborsAndLSAs(t *testing.T) {
+	r := testRouter(t)
+	r.handle(routingFrame(t, hello("Satellite-2", 10)), transport.Peer{})
+	lsa := LSA{Origin: "Satellite-2", Seq: 1, Links: []AdvertisedLink{{Neighbor: "Satellite-1", Latency: 10}}}
+	r.handle(routingFrame(t, RoutingPacket{From: "Satellite-2", LSAs: []LSA{lsa}}), transport.Peer{})
+	if _, ok := r.sat.Routes().Route("Satellite-2"); !ok {
+		t.Fatal("no route to the neighbor")
+	}
+
+	// Without hellos the neighbor goes down and is no longer advertised
+	r.tick(time.Now().Add(r.policy.DeadInterval + time.Second))
+	if info := r.Info(); info.Neighbors[0].Up {
+		t.Errorf("neighbor still up after the dead interval: %+v", info.Neighbors[0])
+	}
+	if own, _ := lsaOf(r, "Satellite-1"); own.Seq != 2 || len(own.Links) != 0 {
+		t.Errorf("own LSA %+v, want sequence 2 without links", own)
+	}
+	if _, ok := r.sat.Routes().Route("Satellite-2"); ok {
+		t.Error("route to a neighbor that is down")
+	}
+
+	// LSAs that are not refreshed expire, but not the router's own
+	r.tick(time.Now().Add(r.policy.MaxAge() + time.Second))
+	if _, ok := lsaOf(r, "Satellite-2"); ok {
+		t.Error("LSA kept past its maximum age")
+	}
+	if _, ok := lsaOf(r, "Satellite-1"); !ok {
+		t.Error("own LSA expired")
+	}
+}
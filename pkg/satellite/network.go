@@ -2,13 +2,33 @@ package satellite
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // TopologyManager manages the satellite network
 type TopologyManager struct {
-	Satellites map[string]*Satellite
-	mu         sync.Mutex
+	Satellites   map[string]*Satellite
+	WeightByLoss bool // Weigh link latencies by their packet loss when routing
+	lastEvent    *TopologyEvent
+	mu           sync.Mutex
+}
+
+// TopologyEvent is a change of the constellation the routers converge after
+type TopologyEvent struct {
+	Description string    `json:"description"`
+	At          time.Time `json:"at"`
+}
+
+// Convergence tells whether the routes the satellites learned agree with the
+// routes over the actual topology, and how long they took to since the last event
+type Convergence struct {
+	Converged     bool           `json:"converged"`
+	LastEvent     *TopologyEvent `json:"lastEvent,omitempty"`
+	ConvergedAt   *time.Time     `json:"convergedAt,omitempty"`   // Last route change of the event, once converged
+	ConvergenceMs *float64       `json:"convergenceMs,omitempty"` // From the event to ConvergedAt
+	Satellites    []RouterInfo   `json:"satellites"`
 }
 
 // AddSatellite adds a new satellite to the topology
@@ -42,11 +62,11 @@ func (t *TopologyManager) UpdateLink(sourceID, targetID string, latency int, pac
 	if sourceExists && targetExists {
 		source.LatencyMap[targetID] = latency
 		source.PacketLossMap[targetID] = packetLoss
-		source.Neighbors = append(source.Neighbors, target)
+		source.addNeighbor(target)
 
 		target.LatencyMap[sourceID] = latency
 		target.PacketLossMap[sourceID] = packetLoss
-		target.Neighbors = append(target.Neighbors, source)
+		target.addNeighbor(source)
 
 		fmt.Printf("Link updated: %s <-> %s, Latency: %dms, PacketLoss: %.2f\n", sourceID, targetID, latency, packetLoss)
 	} else {
@@ -58,3 +78,179 @@ func (t *TopologyManager) UpdateLink(sourceID, targetID string, latency int, pac
 		}
 	}
 }
+
+// RecordEvent notes a change of the constellation that convergence is measured from
+func (t *TopologyManager) RecordEvent(description string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastEvent = &TopologyEvent{Description: description, At: time.Now()}
+}
+
+// SetStatus fails or recovers a satellite
+func (t *TopologyManager) SetStatus(satelliteID, status string) error {
+	sat, exists := t.Get(satelliteID)
+	if !exists {
+		return fmt.Errorf("satellite %s does not exist", satelliteID)
+	}
+	if err := sat.SetStatus(status); err != nil {
+		return err
+	}
+	t.RecordEvent(fmt.Sprintf("%s %s", satelliteID, status))
+	return nil
+}
+
+// Convergence compares the routes of every satellite with the reference
+// routes over the actual topology
+func (t *TopologyManager) Convergence() Convergence {
+	t.mu.Lock()
+	reference := t.referenceRoutes()
+	satellites := make([]*Satellite, 0, len(t.Satellites))
+	for _, sat := range t.Satellites {
+		satellites = append(satellites, sat)
+	}
+	var event *TopologyEvent
+	if t.lastEvent != nil {
+		copied := *t.lastEvent
+		event = &copied
+	}
+	t.mu.Unlock()
+	sort.Slice(satellites, func(i, j int) bool { return satellites[i].ID < satellites[j].ID })
+
+	c := Convergence{Converged: true, LastEvent: event, Satellites: []RouterInfo{}}
+	var last time.Time
+	for _, sat := range satellites {
+		router := sat.Router()
+		if router == nil {
+			continue
+		}
+		info := router.Info()
+		if info.Status == "Failed" {
+			// A failed satellite routes nothing, whatever it last computed
+			info.Converged = true
+		} else {
+			info.Converged = sameRoutes(sat.Routes(), reference[sat.ID])
+			if info.RoutesChangedAt.After(last) {
+				last = info.RoutesChangedAt
+			}
+		}
+		c.Converged = c.Converged && info.Converged
+		c.Satellites = append(c.Satellites, info)
+	}
+	if c.Converged && event != nil {
+		if last.Before(event.At) {
+			last = event.At
+		}
+		ms := float64(last.Sub(event.At)) / float64(time.Millisecond)
+		c.ConvergedAt, c.ConvergenceMs = &last, &ms
+	}
+	return c
+}
+
+// referenceRoutes computes the routes of every satellite centrally over the
+// links between active satellites and the ground links of the gateways, as
+// the link-state protocol should once it converges. Callers hold t.mu.
+func (t *TopologyManager) referenceRoutes() map[string]RoutingTable {
+	graph := make(Graph)
+	gateways := make(map[string]float64)
+	active := make(map[string]bool)
+	for id, sat := range t.Satellites {
+		sat.mu.Lock()
+		if sat.Status != "Failed" {
+			active[id] = true
+			if link := sat.GroundLink; link != nil {
+				if cost, usable := LinkCost(link.Latency, link.PacketLoss, t.WeightByLoss); usable {
+					gateways[id] = cost
+				}
+			}
+		}
+		sat.mu.Unlock()
+	}
+	for id, sat := range t.Satellites {
+		if !active[id] {
+			continue
+		}
+		sat.mu.Lock()
+		for neighborID, latency := range sat.LatencyMap {
+			if !active[neighborID] {
+				continue
+			}
+			if cost, usable := LinkCost(latency, sat.PacketLossMap[neighborID], t.WeightByLoss); usable {
+				graph.AddLink(id, neighborID, cost)
+			}
+		}
+		sat.mu.Unlock()
+	}
+	tables := make(map[string]RoutingTable, len(t.Satellites))
+	for id := range t.Satellites {
+		tables[id] = ComputeRoutes(graph, id, gateways)
+	}
+	return tables
+}
+
+// Close stops every satellite's router and closes its queues
+func (t *TopologyManager) Close() error {
+	t.mu.Lock()
+	satellites := make([]*Satellite, 0, len(t.Satellites))
+	for _, sat := range t.Satellites {
+		satellites = append(satellites, sat)
+	}
+	t.mu.Unlock()
+
+	var firstErr error
+	for _, sat := range satellites {
+		if err := sat.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SatelliteInfo is a snapshot of a satellite's state
+type SatelliteInfo struct {
+	ID         string         `json:"id"`
+	Port       int            `json:"port"`
+	Status     string         `json:"status"`
+	GroundLink *GroundLink    `json:"groundLink,omitempty"` // Only on gateway satellites
+	Neighbors  []string       `json:"neighbors"`
+	Stats      SatelliteStats `json:"stats"`
+}
+
+// SatelliteStats counts the messages handled by a satellite
+type SatelliteStats struct {
+	Received   uint64 `json:"received"`
+	Forwarded  uint64 `json:"forwarded"`  // Delivered to a neighbor or the ground station
+	Lost       uint64 `json:"lost"`       // Lost to packet loss on the way to their next hop, then sent again
+	Expired    uint64 `json:"expired"`    // Dropped when their TTL ran out
+	Unroutable uint64 `json:"unroutable"` // Dropped because their route led back to a satellite they had visited
+	Dropped    uint64 `json:"dropped"`    // Dropped from a full queue
+	QueueDepth int64  `json:"queueDepth"` // Messages queued for their next hop or being sent
+	Unrouted   int64  `json:"unrouted"`   // Of the queued messages, those waiting for a route
+}
+
+// LinkInfo describes the link from a satellite to one of its neighbors
+type LinkInfo struct {
+	Neighbor       string  `json:"neighbor"`
+	NeighborStatus string  `json:"neighborStatus"`
+	Latency        int     `json:"latencyMs"`
+	PacketLoss     float64 `json:"packetLoss"`
+}
+
+// List returns a snapshot of every satellite, sorted by ID
+func (t *TopologyManager) List() []SatelliteInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	infos := make([]SatelliteInfo, 0, len(t.Satellites))
+	for _, sat := range t.Satellites {
+		infos = append(infos, sat.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Get returns the satellite with the given ID
+func (t *TopologyManager) Get(satelliteID string) (*Satellite, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sat, exists := t.Satellites[satelliteID]
+	return sat, exists
+}
@@ -0,0 +1,548 @@
+package satellite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"project3/pkg/common"
+	"project3/pkg/wal"
+	"sync"
+	"time"
+)
+
+// Drop policies of a full queue
+const (
+	DropOldest         = "oldest"
+	DropLowestPriority = "lowest_priority"
+)
+
+// Defaults of the store-and-forward queues
+const (
+	DefaultQueueMessages = 1000
+	DefaultRetryMin      = 500 * time.Millisecond
+	DefaultRetryMax      = 30 * time.Second
+)
+
+// errQueueClosed is returned when adding to a closed queue
+var errQueueClosed = errors.New("queue is closed")
+
+// unroutedHop names the queue of the messages that have no route for now
+const unroutedHop = "unrouted"
+
+// QueuePolicy controls the store-and-forward queues of a satellite
+type QueuePolicy struct {
+	Dir         string // Holds a log per satellite and next hop; queues only live in memory when empty
+	MaxMessages int
+	Drop        string        // DropOldest or DropLowestPriority
+	RetryMin    time.Duration // After the first failed send to a next hop
+	RetryMax    time.Duration // Bound of the retry delay, which doubles with every failure
+}
+
+// QueuePolicyFromConfig converts the queue configuration, filling in defaults
+func QueuePolicyFromConfig(config common.QueueConfig) QueuePolicy {
+	policy := QueuePolicy{
+		Dir:         config.Path,
+		MaxMessages: config.MaxMessages,
+		Drop:        config.DropPolicy,
+		RetryMin:    time.Duration(config.RetryMinMs) * time.Millisecond,
+		RetryMax:    time.Duration(config.RetryMaxMs) * time.Millisecond,
+	}
+	if policy.MaxMessages <= 0 {
+		policy.MaxMessages = DefaultQueueMessages
+	}
+	if policy.Drop == "" {
+		policy.Drop = DropOldest
+	}
+	if policy.RetryMin <= 0 {
+		policy.RetryMin = DefaultRetryMin
+	}
+	if policy.RetryMax < policy.RetryMin {
+		policy.RetryMax = DefaultRetryMax
+		if policy.RetryMax < policy.RetryMin {
+			policy.RetryMax = policy.RetryMin
+		}
+	}
+	return policy
+}
+
+// QueueStats reports the state of a queue
+type QueueStats struct {
+	Hop         string     `json:"hop"`
+	Depth       int        `json:"depth"`
+	Enqueued    uint64     `json:"enqueued"`
+	Delivered   uint64     `json:"delivered"`
+	Dropped     uint64     `json:"dropped"` // By the drop policy of the full queue
+	Rerouted    uint64     `json:"rerouted"`
+	Failures    uint64     `json:"failures"` // Failed sends, each retried later
+	BackoffMs   int64      `json:"backoffMs,omitempty"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// queueRecord is an entry of a queue log: a message added, or messages removed
+// once delivered, dropped or rerouted
+type queueRecord struct {
+	Add    *Message `json:"add,omitempty"`
+	Seq    uint64   `json:"seq,omitempty"`
+	Remove []uint64 `json:"remove,omitempty"`
+}
+
+// queued is a message waiting in a queue
+type queued struct {
+	seq uint64
+	msg Message
+	at  time.Time
+}
+
+// Queue is the bounded store-and-forward queue of a satellite toward one
+// next hop. It sends its messages in frames of up to frame messages,
+// waiting up to delay for a frame to fill, and keeps them until the next hop
+// accepts them, retrying with a doubling delay. A queue without a send
+// function holds its messages until they are taken.
+type Queue struct {
+	hop       string
+	policy    QueuePolicy
+	frame     int
+	delay     time.Duration
+	send      func(msgs []Message) error
+	delivered func(msgs []Message)
+
+	mu        sync.Mutex
+	log       *wal.Log
+	pending   []queued
+	sending   map[uint64]bool
+	seq       uint64
+	removed   int // Remove records since the log was last compacted
+	backoff   time.Duration
+	retryAt   time.Time
+	lastError string
+	stats     QueueStats
+	closed    bool
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// openQueue opens the queue of a next hop, restoring the messages of its
+// log under dir, and starts sending them. An empty dir keeps the queue in
+// memory only.
+func openQueue(dir, hop string, policy QueuePolicy, frame int, delay time.Duration, send func([]Message) error, delivered func([]Message)) (*Queue, error) {
+	if frame < 1 {
+		frame = 1
+	}
+	q := &Queue{
+		hop:       hop,
+		policy:    policy,
+		frame:     frame,
+		delay:     delay,
+		send:      send,
+		delivered: delivered,
+		sending:   make(map[uint64]bool),
+		stats:     QueueStats{Hop: hop},
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if dir != "" {
+		l, err := wal.Open(dir, wal.Options{SyncInterval: time.Second})
+		if err != nil {
+			return nil, err
+		}
+		q.log = l
+		if err := q.restore(); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	go q.run()
+	return q, nil
+}
+
+// restore replays the log into the pending messages
+func (q *Queue) restore() error {
+	pending := make(map[uint64]Message)
+	var order []uint64
+	err := q.log.Replay(func(_ wal.Position, payload []byte) error {
+		var rec queueRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return err
+		}
+		if rec.Add != nil {
+			pending[rec.Seq] = *rec.Add
+			order = append(order, rec.Seq)
+		}
+		for _, seq := range rec.Remove {
+			delete(pending, seq)
+		}
+		if rec.Seq > q.seq {
+			q.seq = rec.Seq
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, seq := range order {
+		if msg, ok := pending[seq]; ok {
+			q.pending = append(q.pending, queued{seq: seq, msg: msg, at: now})
+		}
+	}
+	q.stats.Depth = len(q.pending)
+	return nil
+}
+
+// Add queues a message, making room by the drop policy when the queue is
+// full. It returns the message dropped, if any, which may be msg itself.
+func (q *Queue) Add(msg Message) (*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errQueueClosed
+	}
+
+	var dropped *Message
+	if len(q.pending) >= q.policy.MaxMessages {
+		victim := q.victim(msg)
+		if victim < 0 {
+			q.stats.Dropped++
+			return &msg, nil
+		}
+		victimMsg := q.pending[victim].msg
+		dropped = &victimMsg
+		if err := q.remove(q.pending[victim].seq); err != nil {
+			return nil, err
+		}
+		q.stats.Dropped++
+	}
+
+	q.seq++
+	if q.log != nil {
+		data, err := json.Marshal(queueRecord{Add: &msg, Seq: q.seq})
+		if err != nil {
+			return dropped, err
+		}
+		if _, err := q.log.Append(data); err != nil {
+			return dropped, err
+		}
+	}
+	q.pending = append(q.pending, queued{seq: q.seq, msg: msg, at: time.Now()})
+	q.stats.Enqueued++
+	q.stats.Depth = len(q.pending)
+	q.signal()
+	return dropped, nil
+}
+
+// victim picks the index of the message to drop for msg under the drop
+// policy, or -1 to drop msg itself. Messages being sent are never picked.
+func (q *Queue) victim(msg Message) int {
+	victim := -1
+	for i, item := range q.pending {
+		if q.sending[item.seq] {
+			continue
+		}
+		if q.policy.Drop != DropLowestPriority {
+			return i
+		}
+		if victim < 0 || item.msg.Priority < q.pending[victim].msg.Priority {
+			victim = i
+		}
+	}
+	if victim >= 0 && q.policy.Drop == DropLowestPriority && msg.Priority < q.pending[victim].msg.Priority {
+		return -1
+	}
+	return victim
+}
+
+// Take removes and returns the queued messages match selects, except those being sent
+func (q *Queue) Take(match func(msg Message) bool) ([]Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var taken []Message
+	var seqs []uint64
+	for _, item := range q.pending {
+		if !q.sending[item.seq] && match(item.msg) {
+			taken = append(taken, item.msg)
+			seqs = append(seqs, item.seq)
+		}
+	}
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+	if err := q.remove(seqs...); err != nil {
+		return nil, err
+	}
+	q.stats.Rerouted += uint64(len(taken))
+	return taken, nil
+}
+
+// remove deletes messages from the queue and its log; q.mu must be held
+func (q *Queue) remove(seqs ...uint64) error {
+	gone := make(map[uint64]bool, len(seqs))
+	for _, seq := range seqs {
+		gone[seq] = true
+	}
+	kept := q.pending[:0]
+	for _, item := range q.pending {
+		if !gone[item.seq] {
+			kept = append(kept, item)
+		}
+	}
+	for i := len(kept); i < len(q.pending); i++ {
+		q.pending[i] = queued{}
+	}
+	q.pending = kept
+	q.stats.Depth = len(q.pending)
+
+	if q.log == nil {
+		return nil
+	}
+	data, err := json.Marshal(queueRecord{Remove: seqs})
+	if err != nil {
+		return err
+	}
+	if _, err := q.log.Append(data); err != nil {
+		return err
+	}
+	q.removed += len(seqs)
+	if q.removed >= q.policy.MaxMessages {
+		q.signal()
+	}
+	return nil
+}
+
+// compact rewrites the log down to the messages still queued once as many
+// have left the queue as it can hold. Only the sealed segments are copied,
+// without holding q.mu, so messages keep being queued and removed meanwhile.
+func (q *Queue) compact() error {
+	q.mu.Lock()
+	if q.log == nil || q.removed < q.policy.MaxMessages {
+		q.mu.Unlock()
+		return nil
+	}
+	// Messages queued from here on land in the new active segment
+	if err := q.log.Rotate(); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	live := make(map[uint64]bool, len(q.pending))
+	for _, item := range q.pending {
+		live[item.seq] = true
+	}
+	removed := q.removed
+	q.mu.Unlock()
+
+	// Oldest first, so a message is never dropped before the records removing it
+	for _, seg := range q.log.Segments() {
+		if !seg.Sealed {
+			continue
+		}
+		rw, err := q.log.RewriteSegment(seg, func(_ wal.Position, payload []byte) bool {
+			var rec queueRecord
+			return json.Unmarshal(payload, &rec) == nil && rec.Add != nil && live[rec.Seq]
+		})
+		if err != nil {
+			return err
+		}
+		if err := rw.Commit(); err != nil {
+			return err
+		}
+	}
+
+	q.mu.Lock()
+	q.removed -= removed
+	q.mu.Unlock()
+	return nil
+}
+
+// signal wakes the sending goroutine
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued messages as the next hop accepts them, and compacts
+// the log between sends, until the queue is closed
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		if err := q.compact(); err != nil {
+			log.Printf("Failed to compact the queue log of %s: %v", q.hop, err)
+		}
+
+		batch, wait := q.next(time.Now())
+		if len(batch) > 0 {
+			q.deliver(batch)
+			continue
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-q.stop:
+		case <-q.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next returns the messages to send now, or how long to wait before
+// looking again; a negative wait lasts until a message is added
+func (q *Queue) next(now time.Time) ([]queued, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 || q.send == nil {
+		return nil, -1
+	}
+	if now.Before(q.retryAt) {
+		return nil, q.retryAt.Sub(now)
+	}
+	if len(q.pending) < q.frame {
+		if wait := q.delay - now.Sub(q.pending[0].at); wait > 0 {
+			return nil, wait
+		}
+	}
+	n := len(q.pending)
+	if n > q.frame {
+		n = q.frame
+	}
+	batch := append([]queued(nil), q.pending[:n]...)
+	for _, item := range batch {
+		q.sending[item.seq] = true
+	}
+	return batch, 0
+}
+
+// deliver sends a frame and removes its messages once the next hop has them
+func (q *Queue) deliver(batch []queued) {
+	msgs := make([]Message, len(batch))
+	seqs := make([]uint64, len(batch))
+	for i, item := range batch {
+		msgs[i], seqs[i] = item.msg, item.seq
+	}
+	err := q.send(msgs)
+
+	q.mu.Lock()
+	for _, seq := range seqs {
+		delete(q.sending, seq)
+	}
+	if err != nil {
+		q.backoff *= 2
+		if q.backoff < q.policy.RetryMin {
+			q.backoff = q.policy.RetryMin
+		}
+		if q.backoff > q.policy.RetryMax {
+			q.backoff = q.policy.RetryMax
+		}
+		q.retryAt = time.Now().Add(q.backoff)
+		q.lastError = err.Error()
+		q.stats.Failures++
+		q.mu.Unlock()
+		log.Printf("Failed to send %d queued message(s) to %s, retrying in %v: %v", len(msgs), q.hop, q.backoff, err)
+		return
+	}
+	if q.backoff > 0 {
+		log.Printf("Link to %s is back, draining %d queued message(s)", q.hop, len(q.pending))
+	}
+	q.backoff, q.retryAt, q.lastError = 0, time.Time{}, ""
+	q.stats.Delivered += uint64(len(msgs))
+	if err := q.remove(seqs...); err != nil {
+		log.Printf("Failed to update the queue log of %s: %v", q.hop, err)
+	}
+	q.mu.Unlock()
+	q.delivered(msgs)
+}
+
+// Sync flushes the queued messages to the log on disk
+func (q *Queue) Sync() error {
+	if q.log == nil {
+		return nil
+	}
+	return q.log.Sync()
+}
+
+// Close stops sending and closes the log, waiting for a send under way to
+// finish. Messages still queued are sent once the queue is opened again.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	<-q.done
+	if q.log == nil {
+		return nil
+	}
+	return q.log.Close()
+}
+
+// Stats returns a snapshot of the queue
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.BackoffMs = int64(q.backoff / time.Millisecond)
+	if !q.retryAt.IsZero() && len(q.pending) > 0 {
+		retryAt := q.retryAt
+		stats.NextAttempt = &retryAt
+	}
+	stats.LastError = q.lastError
+	return stats
+}
+
+// Len returns the number of queued messages
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// queueDir returns the log directory of a satellite's queue toward a next hop
+func queueDir(root, satelliteID, hop string) string {
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, satelliteID, hop)
+}
+
+// storedHops returns the next hops a satellite has queue logs for
+func storedHops(root, satelliteID string) ([]string, error) {
+	if root == "" {
+		return nil, nil
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(root, satelliteID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list the queues of %s: %w", satelliteID, err)
+	}
+	var hops []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			hops = append(hops, entry.Name())
+		}
+	}
+	return hops, nil
+}
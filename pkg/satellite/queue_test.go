@@ -0,0 +1,249 @@
+package satellite
+
+import (
+	"errors"
+	"path/filepath"
+	"project3/pkg/wal"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventually waits up to a few seconds for cond to hold
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func queueMessage(id, priority int) Message {
+	return Message{ID: id, Source: "Vessel-1", Destination: "GroundStation", Priority: priority, TTL: 3}
+}
+
+func messageIDs(msgs []Message) []int {
+	ids := make([]int, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func pendingIDs(q *Queue) []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := make([]int, len(q.pending))
+	for i, item := range q.pending {
+		ids[i] = item.msg.ID
+	}
+	return ids
+}
+
+// recorder collects the frames a queue delivers
+type recorder struct {
+	mu  sync.Mutex
+	ids []int
+}
+
+func (r *recorder) delivered(msgs []Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, messageIDs(msgs)...)
+}
+
+func (r *recorder) got() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.ids...)
+}
+
+func sendOK([]Message) error { return nil }
+
+// heldQueue opens a queue that never fills a frame, so nothing is sent
+func heldQueue(t *testing.T, dir string, policy QueuePolicy) *Queue {
+	t.Helper()
+	q, err := openQueue(dir, "Satellite-2", policy, 100, time.Hour, sendOK, func([]Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestQueueDropPolicies(t *testing.T) {
+	cases := []struct {
+		drop    string
+		add     Message
+		dropped int
+		pending []int
+	}{
+		{DropOldest, queueMessage(4, 9), 1, []int{2, 3, 4}},
+		{DropLowestPriority, queueMessage(4, 9), 2, []int{1, 3, 4}},
+		{DropLowestPriority, queueMessage(4, 0), 4, []int{1, 2, 3}},
+	}
+	for _, c := range cases {
+		q := heldQueue(t, "", QueuePolicy{MaxMessages: 3, Drop: c.drop, RetryMin: time.Millisecond, RetryMax: time.Millisecond})
+		for i, priority := range []int{5, 1, 7} {
+			if dropped, err := q.Add(queueMessage(i+1, priority)); dropped != nil || err != nil {
+				t.Fatalf("%s: adding to a queue with room dropped %v, %v", c.drop, dropped, err)
+			}
+		}
+		dropped, err := q.Add(c.add)
+		if err != nil || dropped == nil || dropped.ID != c.dropped {
+			t.Errorf("%s, priority %d: dropped %v, %v, want message %d", c.drop, c.add.Priority, dropped, err, c.dropped)
+		}
+		if ids := pendingIDs(q); !reflect.DeepEqual(ids, c.pending) {
+			t.Errorf("%s, priority %d: queued %v, want %v", c.drop, c.add.Priority, ids, c.pending)
+		}
+		if stats := q.Stats(); stats.Dropped != 1 || stats.Depth != 3 {
+			t.Errorf("%s: stats %+v, want 1 dropped and 3 queued", c.drop, stats)
+		}
+	}
+}
+
+func TestQueueBacksOffUntilDelivered(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	up := false
+	send := func([]Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if !up {
+			return errors.New("link down")
+		}
+		return nil
+	}
+	var rec recorder
+	policy := QueuePolicy{MaxMessages: 10, Drop: DropOldest, RetryMin: 20 * time.Millisecond, RetryMax: 80 * time.Millisecond}
+	q, err := openQueue("", "Satellite-2", policy, 10, 0, send, rec.delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Add(queueMessage(1, 5))
+
+	eventually(t, "five failed sends", func() bool { return q.Stats().Failures >= 5 })
+	stats := q.Stats()
+	if stats.BackoffMs != 80 || stats.LastError != "link down" || stats.NextAttempt == nil {
+		t.Errorf("stats %+v, want the retry delay at its bound of 80ms", stats)
+	}
+	mu.Lock()
+	for i, want := range []time.Duration{20, 40, 80, 80} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want*time.Millisecond {
+			t.Errorf("attempt %d came %v after the one before, want at least %vms", i+2, gap, int(want))
+		}
+	}
+	up = true
+	mu.Unlock()
+
+	eventually(t, "delivery", func() bool { return len(rec.got()) == 1 })
+	if stats := q.Stats(); stats.BackoffMs != 0 || stats.LastError != "" || stats.Depth != 0 || stats.Delivered != 1 {
+		t.Errorf("stats %+v after delivery, want the backoff reset and the queue empty", stats)
+	}
+}
+
+func TestQueueRestoresFromLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Satellite-2")
+	policy := QueuePolicy{MaxMessages: 10, Drop: DropOldest, RetryMin: time.Millisecond, RetryMax: time.Millisecond}
+	q, err := openQueue(dir, "Satellite-2", policy, 100, time.Hour, sendOK, func([]Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		q.Add(queueMessage(i, 5))
+	}
+	if taken, err := q.Take(func(msg Message) bool { return msg.ID == 2 }); err != nil || !reflect.DeepEqual(messageIDs(taken), []int{2}) {
+		t.Fatalf("took %v, %v, want message 2", messageIDs(taken), err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec recorder
+	q, err = openQueue(dir, "Satellite-2", policy, 100, 0, sendOK, rec.delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	eventually(t, "delivery of the restored messages", func() bool { return len(rec.got()) == 3 })
+	if ids := rec.got(); !reflect.DeepEqual(ids, []int{1, 3, 4}) {
+		t.Errorf("delivered %v, want 1, 3 and 4 in order", ids)
+	}
+
+	// Added after the restore, a message gets a sequence number of its own
+	q.Add(queueMessage(5, 5))
+	eventually(t, "delivery of a new message", func() bool { return len(rec.got()) == 4 })
+}
+
+func TestQueueCompactsLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Satellite-2")
+	policy := QueuePolicy{MaxMessages: 4, Drop: DropOldest, RetryMin: time.Millisecond, RetryMax: time.Millisecond}
+	var rec recorder
+	q, err := openQueue(dir, "Satellite-2", policy, 1, 0, sendOK, rec.delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 40
+	for i := 1; i <= n; i++ {
+		q.Add(queueMessage(i, 5))
+		eventually(t, "delivery", func() bool { return len(rec.got()) == i })
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := wal.Open(dir, wal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records := 0
+	l.Replay(func(wal.Position, []byte) error {
+		records++
+		return nil
+	})
+	// Without compaction the log would hold an add and a remove per message
+	if records > 2*policy.MaxMessages {
+		t.Errorf("%d records left in the log of an empty queue after %d messages, want at most %d", records, n, 2*policy.MaxMessages)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	send := func([]Message) error {
+		close(started)
+		<-release
+		return nil
+	}
+	policy := QueuePolicy{MaxMessages: 10, Drop: DropOldest, RetryMin: time.Millisecond, RetryMax: time.Millisecond}
+	q, err := openQueue(filepath.Join(t.TempDir(), "Satellite-2"), "Satellite-2", policy, 1, 0, send, func([]Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Add(queueMessage(1, 5))
+	<-started
+
+	closed := make(chan error)
+	go func() { closed <- q.Close() }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v while a send was under way", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.Add(queueMessage(2, 5)); err != errQueueClosed {
+		t.Errorf("Add after Close: %v, want %v", err, errQueueClosed)
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package satellite
+
+import (
+	"project3/pkg/common"
+	"sort"
+	"time"
+)
+
+// Defaults of the link-state protocol
+const (
+	DefaultHelloInterval = time.Second
+	DefaultDeadHellos    = 4 // Hello intervals without a hello before a neighbor is down
+	DefaultLSARefresh    = 30 * time.Second
+)
+
+// RoutingPolicy controls the link-state protocol and the costs routes are computed with
+type RoutingPolicy struct {
+	WeightByLoss  bool          // Weigh link latencies by their packet loss
+	HelloInterval time.Duration // Between the hellos sent to every neighbor
+	DeadInterval  time.Duration // Without a hello before a neighbor counts as down
+	Refresh       time.Duration // Between LSAs of a satellite whose links did not change
+}
+
+// RoutingPolicyFromConfig converts the routing configuration, filling in defaults
+func RoutingPolicyFromConfig(config common.RoutingConfig) RoutingPolicy {
+	policy := RoutingPolicy{
+		WeightByLoss:  config.WeightByLoss,
+		HelloInterval: time.Duration(config.HelloIntervalMs) * time.Millisecond,
+		DeadInterval:  time.Duration(config.DeadIntervalMs) * time.Millisecond,
+		Refresh:       time.Duration(config.LSARefreshSeconds) * time.Second,
+	}
+	if policy.HelloInterval <= 0 {
+		policy.HelloInterval = DefaultHelloInterval
+	}
+	if policy.DeadInterval <= 0 {
+		policy.DeadInterval = DefaultDeadHellos * policy.HelloInterval
+	}
+	if policy.Refresh <= 0 {
+		policy.Refresh = DefaultLSARefresh
+	}
+	return policy
+}
+
+// MaxAge is how long an LSA that is not refreshed stays in a topology database
+func (p RoutingPolicy) MaxAge() time.Duration {
+	return 3 * p.Refresh
+}
+
+// Graph holds the cost of every usable link of the constellation, by the
+// satellites at both of its ends
+type Graph map[string]map[string]float64
+
+// AddLink adds a link in one direction
+func (g Graph) AddLink(from, to string, cost float64) {
+	if g[from] == nil {
+		g[from] = make(map[string]float64)
+	}
+	g[from][to] = cost
+}
+
+// LinkCost returns the routing cost of a link in milliseconds: its latency,
+// or with weightByLoss the latency expected if every lost message were sent
+// again. A link that loses everything is unusable.
+func LinkCost(latency int, packetLoss float64, weightByLoss bool) (float64, bool) {
+	if !weightByLoss {
+		return float64(latency), true
+	}
+	if packetLoss >= 1 {
+		return 0, false
+	}
+	return float64(latency) / (1 - packetLoss), true
+}
+
+// Route is the cheapest path from a satellite to a destination
+type Route struct {
+	Destination string   `json:"destination"`
+	NextHop     string   `json:"nextHop,omitempty"` // Empty when the satellite is the destination
+	Cost        float64  `json:"cost"`
+	Path        []string `json:"path"` // From the satellite to the destination, both included
+}
+
+// RoutingTable holds the routes of a satellite
+type RoutingTable struct {
+	Source     string           `json:"source"`
+	Ground     *Route           `json:"groundStation,omitempty"` // Through the cheapest gateway, missing when none is reachable
+	Routes     map[string]Route `json:"routes"`                  // To every reachable satellite
+	ComputedAt time.Time        `json:"computedAt"`
+}
+
+// Route returns the route to a destination, a satellite ID or "GroundStation"
+func (t RoutingTable) Route(destination string) (Route, bool) {
+	if destination == "GroundStation" {
+		if t.Ground == nil {
+			return Route{}, false
+		}
+		return *t.Ground, true
+	}
+	route, ok := t.Routes[destination]
+	return route, ok
+}
+
+// ComputeRoutes runs Dijkstra's algorithm from source over the graph and
+// routes to the ground station through the gateway with the cheapest route
+// and ground link, whose costs are given by gateway ID. Ties go to the lower
+// satellite ID, so every satellite computing over the same graph agrees on
+// the routes.
+func ComputeRoutes(graph Graph, source string, gateways map[string]float64) RoutingTable {
+	cost := map[string]float64{source: 0}
+	previous := make(map[string]string)
+	done := make(map[string]bool)
+
+	for {
+		// The constellation is small, so a linear scan beats keeping a heap
+		current, found := "", false
+		for node, c := range cost {
+			if done[node] {
+				continue
+			}
+			if !found || c < cost[current] || (c == cost[current] && node < current) {
+				current, found = node, true
+			}
+		}
+		if !found {
+			break
+		}
+		done[current] = true
+		for neighbor, linkCost := range graph[current] {
+			if done[neighbor] {
+				continue
+			}
+			c := cost[current] + linkCost
+			if known, ok := cost[neighbor]; !ok || c < known || (c == known && current < previous[neighbor]) {
+				cost[neighbor] = c
+				previous[neighbor] = current
+			}
+		}
+	}
+
+	table := RoutingTable{Source: source, Routes: make(map[string]Route, len(cost)), ComputedAt: time.Now()}
+	destinations := make([]string, 0, len(cost))
+	for node := range cost {
+		destinations = append(destinations, node)
+	}
+	sort.Strings(destinations)
+	for _, node := range destinations {
+		route := Route{Destination: node, Cost: cost[node], Path: []string{node}}
+		for hop := node; hop != source; hop = previous[hop] {
+			route.Path = append([]string{previous[hop]}, route.Path...)
+		}
+		if len(route.Path) > 1 {
+			route.NextHop = route.Path[1]
+		}
+		table.Routes[node] = route
+
+		groundCost, gateway := gateways[node]
+		if gateway && (table.Ground == nil || route.Cost+groundCost < table.Ground.Cost) {
+			ground := Route{
+				Destination: "GroundStation",
+				NextHop:     "GroundStation",
+				Cost:        route.Cost + groundCost,
+				Path:        append(append([]string(nil), route.Path...), "GroundStation"),
+			}
+			if len(route.Path) > 1 {
+				ground.NextHop = route.NextHop
+			}
+			table.Ground = &ground
+		}
+	}
+	return table
+}
+
+// sameRoutes reports whether two routing tables reach the same destinations
+// along the same paths
+func sameRoutes(a, b RoutingTable) bool {
+	if len(a.Routes) != len(b.Routes) || (a.Ground == nil) != (b.Ground == nil) {
+		return false
+	}
+	if a.Ground != nil && !samePath(a.Ground.Path, b.Ground.Path) {
+		return false
+	}
+	for destination, route := range a.Routes {
+		other, ok := b.Routes[destination]
+		if !ok || !samePath(route.Path, other.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
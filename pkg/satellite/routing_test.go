@@ -0,0 +1,125 @@
+package satellite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkCost(t *testing.T) {
+	cases := []struct {
+		latency      int
+		packetLoss   float64
+		weightByLoss bool
+		cost         float64
+		usable       bool
+	}{
+		{100, 0.5, false, 100, true},
+		{100, 1, false, 100, true},
+		{100, 0, true, 100, true},
+		{100, 0.5, true, 200, true},
+		{100, 1, true, 0, false},
+	}
+	for _, c := range cases {
+		cost, usable := LinkCost(c.latency, c.packetLoss, c.weightByLoss)
+		if cost != c.cost || usable != c.usable {
+			t.Errorf("LinkCost(%d, %v, %v) = %v, %v, want %v, %v", c.latency, c.packetLoss, c.weightByLoss, cost, usable, c.cost, c.usable)
+		}
+	}
+}
+
+type testLink struct {
+	a, b string
+	cost float64
+}
+
+// testGraph links satellites both ways, the way link-state LSAs describe them
+func testGraph(links ...testLink) Graph {
+	graph := make(Graph)
+	for _, l := range links {
+		graph.AddLink(l.a, l.b, l.cost)
+		graph.AddLink(l.b, l.a, l.cost)
+	}
+	return graph
+}
+
+func TestComputeRoutes(t *testing.T) {
+	// S1 reaches S3 cheaper through S2 than directly; S5 is cut off
+	graph := testGraph(
+		testLink{"S1", "S2", 10},
+		testLink{"S2", "S3", 10},
+		testLink{"S1", "S3", 50},
+		testLink{"S3", "S4", 5},
+	)
+	graph.AddLink("S5", "S1", 1) // Only one way, so S1 cannot reach it
+
+	table := ComputeRoutes(graph, "S1", nil)
+	want := map[string]Route{
+		"S1": {Destination: "S1", Cost: 0, Path: []string{"S1"}},
+		"S2": {Destination: "S2", NextHop: "S2", Cost: 10, Path: []string{"S1", "S2"}},
+		"S3": {Destination: "S3", NextHop: "S2", Cost: 20, Path: []string{"S1", "S2", "S3"}},
+		"S4": {Destination: "S4", NextHop: "S2", Cost: 25, Path: []string{"S1", "S2", "S3", "S4"}},
+	}
+	if !reflect.DeepEqual(table.Routes, want) {
+		t.Errorf("routes %+v, want %+v", table.Routes, want)
+	}
+	if _, ok := table.Route("S5"); ok {
+		t.Error("route to an unreachable satellite")
+	}
+	if _, ok := table.Route("GroundStation"); ok || table.Ground != nil {
+		t.Error("route to the ground station without a gateway")
+	}
+}
+
+func TestComputeRoutesBreaksTiesToLowerID(t *testing.T) {
+	// Two equal paths from S1 to S4, through S2 and through S3, and two
+	// equal ways down, through gateways S4 and S5
+	graph := testGraph(
+		testLink{"S1", "S3", 10},
+		testLink{"S1", "S2", 10},
+		testLink{"S3", "S4", 10},
+		testLink{"S2", "S4", 10},
+		testLink{"S4", "S5", 0},
+	)
+	gateways := map[string]float64{"S5": 5, "S4": 5}
+
+	// Maps iterate in random order, so a tie broken by chance shows within a few runs
+	for i := 0; i < 50; i++ {
+		table := ComputeRoutes(graph, "S1", gateways)
+		if route := table.Routes["S4"]; !reflect.DeepEqual(route.Path, []string{"S1", "S2", "S4"}) {
+			t.Fatalf("run %d: path to S4 %v, want through S2", i, route.Path)
+		}
+		if route := table.Routes["S5"]; !reflect.DeepEqual(route.Path, []string{"S1", "S2", "S4", "S5"}) {
+			t.Fatalf("run %d: path to S5 %v, want through S2", i, route.Path)
+		}
+		if ground, ok := table.Route("GroundStation"); !ok || !reflect.DeepEqual(ground.Path, []string{"S1", "S2", "S4", "GroundStation"}) {
+			t.Fatalf("run %d: ground route %+v, want through gateway S4", i, ground)
+		}
+	}
+}
+
+func TestComputeRoutesToGroundThroughCheapestGateway(t *testing.T) {
+	graph := testGraph(
+		testLink{"S1", "S2", 10},
+		testLink{"S2", "S3", 20},
+	)
+
+	// S2 is closer, but its ground link costs more than the way through S3
+	table := ComputeRoutes(graph, "S1", map[string]float64{"S2": 40, "S3": 5})
+	want := Route{Destination: "GroundStation", NextHop: "S2", Cost: 35, Path: []string{"S1", "S2", "S3", "GroundStation"}}
+	if ground, ok := table.Route("GroundStation"); !ok || !reflect.DeepEqual(ground, want) {
+		t.Errorf("ground route %+v, want %+v", ground, want)
+	}
+
+	// A gateway sends down its own ground link
+	table = ComputeRoutes(graph, "S3", map[string]float64{"S2": 40, "S3": 5})
+	want = Route{Destination: "GroundStation", NextHop: "GroundStation", Cost: 5, Path: []string{"S3", "GroundStation"}}
+	if ground, ok := table.Route("GroundStation"); !ok || !reflect.DeepEqual(ground, want) {
+		t.Errorf("ground route of a gateway %+v, want %+v", ground, want)
+	}
+
+	// Unreachable gateways do not count
+	table = ComputeRoutes(graph, "S1", map[string]float64{"S9": 1})
+	if _, ok := table.Route("GroundStation"); ok {
+		t.Error("ground route through an unreachable gateway")
+	}
+}
@@ -1,29 +1,67 @@
 package satellite
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"net/http"
 	"project3/pkg/protocol"
+	"project3/pkg/transport"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Satellite represents a satellite node
 type Satellite struct {
+	counters          counters // First, to keep the 64-bit atomics aligned on 32-bit platforms
 	ID                string
 	Port              int
 	Neighbors         []*Satellite
+	addresses         map[string]string // Of every neighbor, as configured with its link
 	LatencyMap        map[string]int
 	PacketLossMap     map[string]float64
-	Status            string // "Active" or "Failed"
+	Status            string      // "Active" or "Failed"
+	GroundLink        *GroundLink // Link to the ground station of a gateway satellite, nil on the others
+	Transport         string      // Transport the satellite listens with, "http" (default) or "tcp"
 	GroundStationAddr string
+	Downlink          BatchPolicy // Batching of the messages sent to the ground station
+	downlink          *Batcher
+	Routing           RoutingPolicy // Of the link-state protocol the satellite learns its routes with
+	Queue             QueuePolicy   // Of the store-and-forward queues kept per next hop
+	queues            map[string]*Queue
+	closed            bool
+	router            *Router
+	routes            RoutingTable
 	mu                sync.Mutex
 }
 
+// counters tracks the traffic of a satellite; updated atomically
+type counters struct {
+	received   uint64
+	forwarded  uint64
+	lost       uint64
+	expired    uint64
+	unroutable uint64
+	dropped    uint64
+}
+
+// GroundLink is the link from a gateway satellite to the ground station
+type GroundLink struct {
+	Latency    int     `json:"latencyMs"`
+	PacketLoss float64 `json:"packetLoss"`
+}
+
+// maxRelayFrame bounds the messages sent to a neighbor in one frame when its queue backs up
+const maxRelayFrame = 20
+
+// Reasons a message has no next hop
+var (
+	errNoRoute = errors.New("no route")
+	errLoop    = errors.New("route loops back")
+)
+
 // Message represents a communication message with TTL
 type Message struct {
 	ID          int                      `json:"id"`
@@ -32,133 +70,565 @@ type Message struct {
 	Content     protocol.PositionMessage `json:"content"` // Change here
 	Priority    int                      `json:"priority"`
 	TTL         int                      `json:"ttl"`
+	Path        []string                 `json:"path,omitempty"`      // Satellites the message has traversed
+	Signature   []byte                   `json:"signature,omitempty"` // Of the vessel over the report, see package auth
 }
 
-// Listen starts the satellite HTTP server
-func (s *Satellite) Listen() error {
-	// Create a new ServeMux for this satellite
-	mux := http.NewServeMux()
+// Sender returns the node the message comes from on its last hop: the last
+// satellite of its path, or its source before it reached any satellite
+func (m Message) Sender() string {
+	if len(m.Path) > 0 {
+		return m.Path[len(m.Path)-1]
+	}
+	return m.Source
+}
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST method is supported", http.StatusMethodNotAllowed)
-			return
+// Info returns a snapshot of the satellite's state
+func (s *Satellite) Info() SatelliteInfo {
+	stats := s.Stats()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SatelliteInfo{ID: s.ID, Port: s.Port, Status: s.Status, GroundLink: s.GroundLink, Neighbors: []string{}, Stats: stats}
+	for _, neighbor := range s.Neighbors {
+		info.Neighbors = append(info.Neighbors, neighbor.ID)
+	}
+	return info
+}
+
+// Stats returns a snapshot of the satellite's traffic counters
+func (s *Satellite) Stats() SatelliteStats {
+	unrouted := 0
+	for _, q := range s.queueList() {
+		if q.hop == unroutedHop {
+			unrouted = q.Len()
+		}
+	}
+	return SatelliteStats{
+		Received:   atomic.LoadUint64(&s.counters.received),
+		Forwarded:  atomic.LoadUint64(&s.counters.forwarded),
+		Lost:       atomic.LoadUint64(&s.counters.lost),
+		Expired:    atomic.LoadUint64(&s.counters.expired),
+		Unroutable: atomic.LoadUint64(&s.counters.unroutable),
+		Dropped:    atomic.LoadUint64(&s.counters.dropped),
+		QueueDepth: int64(s.queueDepth()),
+		Unrouted:   int64(unrouted),
+	}
+}
+
+// queueDepth returns the number of messages in the satellite's queues
+func (s *Satellite) queueDepth() int {
+	depth := 0
+	for _, q := range s.queueList() {
+		depth += q.Len()
+	}
+	return depth
+}
+
+// Links returns the satellite's links to its neighbors
+func (s *Satellite) Links() []LinkInfo {
+	s.mu.Lock()
+	neighbors := append([]*Satellite(nil), s.Neighbors...)
+	links := make([]LinkInfo, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		links = append(links, LinkInfo{
+			Neighbor:   neighbor.ID,
+			Latency:    s.LatencyMap[neighbor.ID],
+			PacketLoss: s.PacketLossMap[neighbor.ID],
+		})
+	}
+	s.mu.Unlock()
+
+	// Read neighbor state without holding our own lock
+	for i, neighbor := range neighbors {
+		links[i].NeighborStatus = neighbor.Info().Status
+	}
+	return links
+}
+
+// Routes returns the satellite's routing table
+func (s *Satellite) Routes() RoutingTable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.routes
+}
+
+// setRoutes replaces the satellite's routing table
+func (s *Satellite) setRoutes(table RoutingTable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = table
+}
+
+// StartRouting starts the satellite's router, which computes its routes from
+// what the link-state protocol learns of the constellation
+func (s *Satellite) StartRouting() {
+	s.mu.Lock()
+	if s.router != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.router = newRouter(s, s.Routing)
+	router := s.router
+	s.mu.Unlock()
+	go router.run()
+}
+
+// Router returns the satellite's router, nil until routing starts
+func (s *Satellite) Router() *Router {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.router
+}
+
+// SetStatus fails a satellite, which then stops sending hellos and refuses
+// every frame, or brings it back with its neighbors and topology forgotten
+func (s *Satellite) SetStatus(status string) error {
+	if status != "Active" && status != "Failed" {
+		return fmt.Errorf("unknown satellite status %q", status)
+	}
+	s.mu.Lock()
+	previous := s.Status
+	s.Status = status
+	router := s.router
+	s.mu.Unlock()
+	if previous == status {
+		return nil
+	}
+	log.Printf("Satellite %s is now %s", s.ID, status)
+	if router != nil {
+		router.reset()
+	}
+	return nil
+}
+
+// failed reports whether the satellite is down
+func (s *Satellite) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Status == "Failed"
+}
+
+// neighbor returns the neighbor with the given ID
+func (s *Satellite) neighbor(id string) (*Satellite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, neighbor := range s.Neighbors {
+		if neighbor.ID == id {
+			return neighbor, true
 		}
+	}
+	return nil, false
+}
 
-		var msg Message
-		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-			log.Printf("Satellite %s failed to decode message: %v", s.ID, err)
-			http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+// addNeighbor links a neighbor once, however many times the link is configured
+func (s *Satellite) addNeighbor(neighbor *Satellite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.Neighbors {
+		if existing.ID == neighbor.ID {
 			return
 		}
+	}
+	s.Neighbors = append(s.Neighbors, neighbor)
+	if s.addresses == nil {
+		s.addresses = make(map[string]string)
+	}
+	s.addresses[neighbor.ID] = neighbor.Address()
+}
+
+// link is the configuration of a satellite's link to a neighbor
+type link struct {
+	neighbor   string
+	address    string
+	latency    int
+	packetLoss float64
+}
+
+// links returns the configuration of the satellite's links, the only view
+// of its neighbors it has before hearing from them
+func (s *Satellite) links() []link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := make([]link, 0, len(s.addresses))
+	for id, address := range s.addresses {
+		links = append(links, link{neighbor: id, address: address, latency: s.LatencyMap[id], packetLoss: s.PacketLossMap[id]})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].neighbor < links[j].neighbor })
+	return links
+}
+
+// linkTo returns the configuration of the link to a neighbor
+func (s *Satellite) linkTo(id string) (link, bool) {
+	for _, l := range s.links() {
+		if l.neighbor == id {
+			return l, true
+		}
+	}
+	return link{}, false
+}
+
+// Address returns the address other nodes send the satellite messages at
+func (s *Satellite) Address() string {
+	return transport.Address(s.Transport, satelliteHostport(s.Port))
+}
+
+// satelliteHostport returns where the satellite listening on port is reached
+func satelliteHostport(port int) string {
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+// Listen serves the satellite's transport on its port
+func (s *Satellite) Listen() error {
+	t, err := transport.ForNode(s.ID, s.Transport)
+	if err != nil {
+		return err
+	}
+	address := fmt.Sprintf(":%d", s.Port)
+	log.Printf("Satellite %s listening on %s (%s)", s.ID, address, t.Name())
+	return t.Listen(address, s.handleFrame)
+}
+
+// handleFrame relays the messages of a frame received from a vessel or a
+// neighbor, and hands routing frames to the router
+func (s *Satellite) handleFrame(frame transport.Frame, peer transport.Peer) error {
+	if s.failed() {
+		return fmt.Errorf("%w: satellite %s is down", transport.ErrUnavailable, s.ID)
+	}
+	if isRoutingFrame(frame) {
+		router := s.Router()
+		if router == nil {
+			return fmt.Errorf("%w: satellite %s does not route", transport.ErrUnsupported, s.ID)
+		}
+		if err := router.handle(frame, peer); err != nil {
+			log.Printf("Satellite %s refused a routing frame from %s: %v", s.ID, peer, err)
+			return err
+		}
+		return nil
+	}
+	msgs, err := DecodeFrame(frame)
+	if err != nil {
+		log.Printf("Satellite %s failed to decode message from %s: %v", s.ID, peer, err)
+		return err
+	}
+	if err := CheckSender(msgs, peer); err != nil {
+		log.Printf("Satellite %s refused a frame: %v", s.ID, err)
+		return err
+	}
+
+	queues := make(map[*Queue]bool)
+	for i := range msgs {
+		msg := &msgs[i]
 
 		// Log the received message
-		log.Printf("Satellite %s received message: %+v", s.ID, msg)
+		log.Printf("Satellite %s received message: %+v", s.ID, *msg)
+		atomic.AddUint64(&s.counters.received, 1)
+
+		msg.Path = append(msg.Path, s.ID)
 
 		// Forward message if not the destination and TTL > 0
 		if msg.Destination != s.ID && msg.TTL > 0 {
 			msg.TTL-- // Decrement TTL
-			go s.ForwardMessage(&msg, make(map[string]bool))
+			q, err := s.forward(msg)
+			if err != nil {
+				log.Printf("Satellite %s failed to queue message %d from %s: %v", s.ID, msg.ID, msg.Source, err)
+				return fmt.Errorf("%w: satellite %s could not queue message %d from %s", transport.ErrUnavailable, s.ID, msg.ID, msg.Source)
+			}
+			if q != nil {
+				queues[q] = true
+			}
+		}
+	}
+
+	// Acknowledge the frame only once its messages are on disk, so the sender keeps them until then
+	for q := range queues {
+		if err := q.Sync(); err != nil {
+			log.Printf("Satellite %s failed to flush its queue to %s: %v", s.ID, q.hop, err)
+			return fmt.Errorf("%w: satellite %s could not store the frame", transport.ErrUnavailable, s.ID)
 		}
+	}
+	return nil
+}
 
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "Message received successfully")
-	})
+// ForwardMessage queues a message for the next hop of its route, which is
+// the ground station when the satellite is the gateway the route goes
+// through, and flushes the queue. A message without a route waits in the
+// queue of unrouted messages until one appears. It fails when the message
+// could not be queued; a message that expired or would loop is dropped.
+func (s *Satellite) ForwardMessage(msg *Message) error {
+	q, err := s.forward(msg)
+	if err != nil || q == nil {
+		return err
+	}
+	return q.Sync()
+}
 
-	address := fmt.Sprintf(":%d", s.Port)
-	server := &http.Server{
-		Addr:    address,
-		Handler: mux,
+// forward queues a message for the next hop of its route and returns the
+// queue it went to, nil if the message was dropped
+func (s *Satellite) forward(msg *Message) (*Queue, error) {
+	if msg.TTL <= 0 {
+		fmt.Printf("Message expired at Satellite %s. Stopping forwarding.\n", s.ID)
+		atomic.AddUint64(&s.counters.expired, 1)
+		return nil, nil
+	}
+	return s.route(*msg, s.Routes())
+}
+
+// route queues a message for its next hop under routes, or among the
+// unrouted messages if it has none, and returns the queue it went to, nil
+// if the message was dropped because its route loops
+func (s *Satellite) route(msg Message, routes RoutingTable) (*Queue, error) {
+	hop, err := s.nextHop(msg, routes)
+	switch {
+	case err == errLoop:
+		atomic.AddUint64(&s.counters.unroutable, 1)
+		return nil, nil
+	case err != nil:
+		return s.park(msg, routes)
+	}
+	return s.enqueue(hop, msg)
+}
+
+// park queues a message that has no next hop under routes among the
+// unrouted messages, which rerouteQueues hands on once a route appears
+func (s *Satellite) park(msg Message, routes RoutingTable) (*Queue, error) {
+	q, err := s.enqueue(unroutedHop, msg)
+	if err != nil {
+		return nil, err
+	}
+	// Routes that changed since the caller looked were rerouted without this message
+	if !sameRoutes(routes, s.Routes()) {
+		go s.rerouteQueues()
+	}
+	return q, nil
+}
+
+// nextHop returns the next hop of a message's route: a neighbor or "GroundStation".
+// It returns errLoop for a message whose route leads back to a satellite it
+// visited, and errNoRoute while it has no route or the route is stale.
+func (s *Satellite) nextHop(msg Message, routes RoutingTable) (string, error) {
+	route, ok := routes.Route(msg.Destination)
+	if !ok {
+		fmt.Printf("No route from Satellite %s to %s. Holding message %d from %s.\n", s.ID, msg.Destination, msg.ID, msg.Source)
+		return "", errNoRoute
+	}
+	if route.NextHop == "GroundStation" {
+		return route.NextHop, nil
 	}
 
-	log.Printf("Satellite %s listening on %s", s.ID, address)
-	return server.ListenAndServe()
+	// Routes can disagree while the topology changes; never send a message back
+	for _, hop := range msg.Path {
+		if hop == route.NextHop {
+			fmt.Printf("Message from %s would loop back to %s at Satellite %s. Dropping message.\n", msg.Source, hop, s.ID)
+			return "", errLoop
+		}
+	}
+	if _, ok := s.neighbor(route.NextHop); !ok {
+		fmt.Printf("Next hop %s is not a neighbor of Satellite %s. Holding message %d from %s.\n", route.NextHop, s.ID, msg.ID, msg.Source)
+		return "", errNoRoute
+	}
+	return route.NextHop, nil
 }
 
-// ForwardMessage forwards a message to neighbors or the ground station
-func (s *Satellite) ForwardMessage(msg *Message, visited map[string]bool) {
+// packetLossTo returns the packet loss rate of the link to a next hop
+func (s *Satellite) packetLossTo(hop string) float64 {
 	s.mu.Lock()
-	if visited[s.ID] {
-		s.mu.Unlock()
-		return
+	defer s.mu.Unlock()
+	if hop == "GroundStation" {
+		if s.GroundLink == nil {
+			return 0
+		}
+		return s.GroundLink.PacketLoss
 	}
-	visited[s.ID] = true
-	s.mu.Unlock()
+	return s.PacketLossMap[hop]
+}
 
-	if msg.TTL <= 0 {
-		fmt.Printf("Message expired at Satellite %s. Stopping forwarding.\n", s.ID)
-		return
+// latencyTo returns the latency of the link to a next hop
+func (s *Satellite) latencyTo(hop string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hop == "GroundStation" {
+		if s.GroundLink == nil {
+			return 0
+		}
+		return time.Duration(s.GroundLink.Latency) * time.Millisecond
 	}
+	return time.Duration(s.LatencyMap[hop]) * time.Millisecond
+}
 
-	// Forward to ground station if the destination is "GroundStation"
-	if msg.Destination == "GroundStation" {
-		go func() {
-			err := sendToGroundStation(s.GroundStationAddr, msg)
-			if err != nil {
-				fmt.Printf("Failed to send message to Ground Station: %v\n", err)
-			} else {
-				fmt.Printf("Message successfully sent to Ground Station from Satellite %s\n", s.ID)
-			}
-		}()
-		return
+// enqueue adds a message to the queue of a next hop and returns the queue
+func (s *Satellite) enqueue(hop string, msg Message) (*Queue, error) {
+	q, err := s.queue(hop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the queue to %s: %w", hop, err)
+	}
+	dropped, err := q.Add(msg)
+	if dropped != nil {
+		fmt.Printf("Queue of Satellite %s to %s is full. Dropped message %d from %s (priority %d).\n", s.ID, hop, dropped.ID, dropped.Source, dropped.Priority)
+		atomic.AddUint64(&s.counters.dropped, 1)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue for %s: %w", hop, err)
+	}
+	return q, nil
+}
 
-	// Forward to neighbors
-	for _, neighbor := range s.Neighbors {
-		if neighbor.Status == "Failed" {
-			fmt.Printf("Neighbor Satellite %s is down. Skipping...\n", neighbor.ID)
-			continue
+// queue returns the queue of a next hop, opening it on first use
+func (s *Satellite) queue(hop string) (*Queue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[hop]; ok {
+		return q, nil
+	}
+	if s.closed {
+		return nil, errQueueClosed
+	}
+	frame, delay := maxRelayFrame, time.Duration(0)
+	if hop == "GroundStation" {
+		frame, delay = s.Downlink.MaxCount, s.Downlink.MaxDelay
+	}
+	send, delivered := s.sender(hop), s.delivered(hop)
+	if hop == unroutedHop {
+		send, delivered = nil, nil // Held until rerouted
+	}
+	q, err := openQueue(queueDir(s.Queue.Dir, s.ID, hop), hop, s.Queue, frame, delay, send, delivered)
+	if err != nil {
+		return nil, err
+	}
+	if s.queues == nil {
+		s.queues = make(map[string]*Queue)
+	}
+	s.queues[hop] = q
+	return q, nil
+}
+
+// RestoreQueues opens the queues the satellite left messages in, which
+// resume sending them
+func (s *Satellite) RestoreQueues() error {
+	hops, err := storedHops(s.Queue.Dir, s.ID)
+	if err != nil {
+		return err
+	}
+	for _, hop := range hops {
+		q, err := s.queue(hop)
+		if err != nil {
+			return err
+		}
+		if n := q.Len(); n > 0 {
+			log.Printf("Satellite %s restored %d queued message(s) to %s", s.ID, n, hop)
 		}
+	}
+	return nil
+}
 
-		latency := s.LatencyMap[neighbor.ID]
-		packetLoss := s.PacketLossMap[neighbor.ID]
+// Queues returns the stats of the satellite's queues, sorted by next hop
+func (s *Satellite) Queues() []QueueStats {
+	stats := []QueueStats{}
+	for _, q := range s.queueList() {
+		stats = append(stats, q.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Hop < stats[j].Hop })
+	return stats
+}
 
-		go func(neighbor *Satellite, latency int, packetLoss float64) {
-			time.Sleep(time.Duration(latency) * time.Millisecond)
-			if rand.Float64() > packetLoss {
-				url := fmt.Sprintf("http://localhost:%d", neighbor.Port)
-				body, err := json.Marshal(msg)
-				if err != nil {
-					fmt.Printf("Failed to encode message for Satellite %s: %v\n", neighbor.ID, err)
-					return
-				}
+// queueList returns the satellite's queues
+func (s *Satellite) queueList() []*Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queues := make([]*Queue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q)
+	}
+	return queues
+}
 
-				resp, err := http.Post(url, "application/json", bytes.NewReader(body))
-				if err != nil {
-					fmt.Printf("Failed to send message to Satellite %s: %v\n", neighbor.ID, err)
-					return
-				}
-				defer resp.Body.Close()
+// sender returns how the queue of a next hop sends a frame: over the link,
+// once the frame has waited out its latency, unless the link loses it. A
+// lost frame fails like any other send, so the queue sends it again.
+func (s *Satellite) sender(hop string) func(msgs []Message) error {
+	return func(msgs []Message) error {
+		if s.failed() {
+			return fmt.Errorf("%w: satellite %s is down", transport.ErrUnavailable, s.ID)
+		}
+		time.Sleep(s.latencyTo(hop))
+		if rand.Float64() < s.packetLossTo(hop) {
+			fmt.Printf("Frame of %d message(s) lost between %s and %s\n", len(msgs), s.ID, hop)
+			atomic.AddUint64(&s.counters.lost, uint64(len(msgs)))
+			return fmt.Errorf("frame lost on the link from %s to %s", s.ID, hop)
+		}
+		if hop == "GroundStation" {
+			return s.downlinkBatcher().Send(msgs)
+		}
+		neighbor, ok := s.neighbor(hop)
+		if !ok {
+			return fmt.Errorf("%s is not a neighbor of satellite %s", hop, s.ID)
+		}
+		return Send(s.ID, neighbor.Address(), msgs...)
+	}
+}
+
+// delivered returns how the queue of a next hop accounts for a frame it sent
+func (s *Satellite) delivered(hop string) func(msgs []Message) {
+	return func(msgs []Message) {
+		fmt.Printf("%d message(s) successfully sent from %s to %s\n", len(msgs), s.ID, hop)
+		atomic.AddUint64(&s.counters.forwarded, uint64(len(msgs)))
+	}
+}
 
-				if resp.StatusCode == http.StatusOK {
-					fmt.Printf("Message successfully sent from %s to %s (TTL: %d)\n", s.ID, neighbor.ID, msg.TTL)
-				} else {
-					fmt.Printf("Satellite %s returned status %d\n", neighbor.ID, resp.StatusCode)
+// rerouteQueues moves the queued messages whose route now leaves through
+// another next hop to the queue of that hop, including the unrouted
+// messages that have a route again
+func (s *Satellite) rerouteQueues() {
+	routes := s.Routes()
+	for _, q := range s.queueList() {
+		moved, err := q.Take(func(msg Message) bool {
+			route, ok := routes.Route(msg.Destination)
+			return ok && route.NextHop != q.hop
+		})
+		if err != nil {
+			fmt.Printf("Failed to reroute the queue of Satellite %s to %s: %v\n", s.ID, q.hop, err)
+			continue
+		}
+		if len(moved) > 0 {
+			fmt.Printf("Satellite %s rerouted %d queued message(s) away from %s\n", s.ID, len(moved), q.hop)
+		}
+		for _, msg := range moved {
+			if _, err := s.route(msg, routes); err != nil {
+				// Keep it where it was rather than lose it
+				fmt.Printf("Failed to reroute message %d from %s at Satellite %s: %v\n", msg.ID, msg.Source, s.ID, err)
+				if _, err := s.enqueue(q.hop, msg); err != nil {
+					fmt.Printf("Satellite %s lost message %d from %s: %v\n", s.ID, msg.ID, msg.Source, err)
 				}
-			} else {
-				fmt.Printf("Message lost between %s and %s\n", s.ID, neighbor.ID)
 			}
-		}(neighbor, latency, packetLoss)
+		}
 	}
 }
 
-// sendToGroundStation sends a message to the ground station using HTTP
-func sendToGroundStation(address string, msg *Message) error {
-	url := fmt.Sprintf("http://%s", address)
-	body, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to encode message: %w", err)
+// Close stops the satellite's router and closes its queues, flushing their
+// logs; the messages still queued are sent once the satellite restarts
+func (s *Satellite) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	router := s.router
+	s.mu.Unlock()
+	if router != nil {
+		router.Stop()
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to send message to Ground Station: %w", err)
+	var firstErr error
+	for _, q := range s.queueList() {
+		if err := q.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close the queue of %s to %s: %w", s.ID, q.hop, err)
+		}
 	}
-	defer resp.Body.Close()
+	return firstErr
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Ground Station returned status %d", resp.StatusCode)
+// downlinkBatcher returns the batcher of the link to the ground station, creating it on first use
+func (s *Satellite) downlinkBatcher() *Batcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.downlink == nil {
+		s.downlink = NewBatcher(s.ID, "GroundStation", s.GroundStationAddr, s.Downlink, nil)
 	}
-
-	return nil
+	return s.downlink
 }
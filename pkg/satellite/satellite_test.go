@@ -0,0 +1,100 @@
+package satellite
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"project3/pkg/transport"
+	"testing"
+	"time"
+)
+
+// listeningSatellite starts a satellite listening on a free port
+func listeningSatellite(t *testing.T, id string) *Satellite {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	sat := &Satellite{
+		ID:            id,
+		Port:          port,
+		LatencyMap:    map[string]int{},
+		PacketLossMap: map[string]float64{},
+		Status:        "Active",
+		Queue:         QueuePolicy{MaxMessages: 10, Drop: DropOldest, RetryMin: time.Second, RetryMax: time.Second},
+	}
+	go sat.Listen()
+	eventually(t, id+" listening", func() bool {
+		conn, err := net.Dial("tcp", satelliteHostport(port))
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	t.Cleanup(func() { sat.Close() })
+	return sat
+}
+
+func TestUnroutedMessageDeliveredOnceRouteAppears(t *testing.T) {
+	dir := t.TempDir()
+	gateway := listeningSatellite(t, "Satellite-2")
+	open := func() *Satellite {
+		sat := &Satellite{
+			ID:            "Satellite-1",
+			Port:          1,
+			LatencyMap:    map[string]int{"Satellite-2": 0},
+			PacketLossMap: map[string]float64{},
+			Status:        "Active",
+			Routing:       RoutingPolicy{HelloInterval: time.Hour, DeadInterval: 4 * time.Hour, Refresh: 24 * time.Hour},
+			Queue:         QueuePolicy{Dir: dir, MaxMessages: 10, Drop: DropOldest, RetryMin: 10 * time.Millisecond, RetryMax: 10 * time.Millisecond},
+		}
+		sat.addNeighbor(gateway)
+		return sat
+	}
+
+	// Before the link-state protocol found a route the message waits, on disk
+	sat := open()
+	msg := testMessage(7, false)
+	msg.Path = nil
+	if err := sat.ForwardMessage(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if stats := sat.Stats(); stats.Unrouted != 1 || stats.Unroutable != 0 {
+		t.Fatalf("stats %+v, want the message waiting for a route", stats)
+	}
+	if err := sat.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Satellite-1", unroutedHop)); err != nil {
+		t.Fatalf("unrouted message not persisted: %v", err)
+	}
+
+	// It survives a restart, and leaves once the gateway's hellos and LSA arrive
+	sat = open()
+	defer sat.Close()
+	if err := sat.RestoreQueues(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := sat.Stats(); stats.Unrouted != 1 {
+		t.Fatalf("%d unrouted messages after the restart, want 1", stats.Unrouted)
+	}
+	sat.StartRouting()
+	up := RoutingPacket{From: "Satellite-2", Hello: true, Address: gateway.Address(), LSAs: []LSA{{
+		Origin:     "Satellite-2",
+		Seq:        1,
+		Links:      []AdvertisedLink{{Neighbor: "Satellite-1"}},
+		GroundLink: &GroundLink{Latency: 10},
+	}}}
+	if err := sat.Router().handle(routingFrame(t, up), transport.Peer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "delivery to the gateway", func() bool { return gateway.Stats().Received == 1 })
+	eventually(t, "the unrouted queue to drain", func() bool {
+		stats := sat.Stats()
+		return stats.Unrouted == 0 && stats.Forwarded == 1
+	})
+}
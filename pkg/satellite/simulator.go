@@ -7,16 +7,23 @@ import (
 	"project3/pkg/common"
 )
 
-// RunSimulation sets up the satellite network simulation
-func RunSimulation(configPath string) {
+// RunSimulation sets up the satellite network simulation and returns its topology
+func RunSimulation(configPath string) *TopologyManager {
 	// Load configuration
 	err := common.LoadConfig(configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Select the codec and transport settings of the satellite links
+	if err := ConfigureWire(common.AppConfig); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Create a topology manager for the satellites
-	manager := &TopologyManager{Satellites: make(map[string]*Satellite)}
+	routing := RoutingPolicyFromConfig(common.AppConfig.Routing)
+	queue := QueuePolicyFromConfig(common.AppConfig.Queue)
+	manager := &TopologyManager{Satellites: make(map[string]*Satellite), WeightByLoss: routing.WeightByLoss}
 
 	// Dynamically create satellites based on the configuration
 	for _, satConfig := range common.AppConfig.Satellites {
@@ -24,9 +31,14 @@ func RunSimulation(configPath string) {
 			ID:                satConfig.ID,
 			Port:              satConfig.Port,
 			GroundStationAddr: common.AppConfig.GroundStationAddress,
+			Downlink:          BatchPolicyFromConfig(common.AppConfig.Wire.Downlink),
 			LatencyMap:        make(map[string]int),
 			PacketLossMap:     make(map[string]float64),
 			Status:            "Active",
+			GroundLink:        groundLinkOf(satConfig.GroundLink),
+			Routing:           routing,
+			Queue:             queue,
+			Transport:         satConfig.Transport,
 		}
 		manager.AddSatellite(satellite)
 	}
@@ -39,12 +51,30 @@ func RunSimulation(configPath string) {
 		}
 	}
 
-	// Start satellite listeners
+	// Start satellite listeners and let the satellites learn their routes
+	manager.RecordEvent("Constellation started")
 	for _, satellite := range manager.Satellites {
 		go satellite.Listen()
+		satellite.StartRouting()
+	}
+
+	// Resume sending the messages queued before a restart
+	for _, satellite := range manager.Satellites {
+		if err := satellite.RestoreQueues(); err != nil {
+			log.Printf("Failed to restore the queues of Satellite %s: %v", satellite.ID, err)
+		}
 	}
 
 	// Allow listeners to start
 	time.Sleep(time.Second)
 	log.Println("Satellite network simulation started successfully.")
+	return manager
+}
+
+// groundLinkOf returns the ground link of a satellite configuration, nil for a satellite without one
+func groundLinkOf(config *common.GroundLinkConfig) *GroundLink {
+	if config == nil {
+		return nil
+	}
+	return &GroundLink{Latency: config.Latency, PacketLoss: config.PacketLoss}
 }
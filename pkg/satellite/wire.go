@@ -0,0 +1,210 @@
+package satellite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"project3/pkg/common"
+	"project3/pkg/transport"
+	"sync"
+	"time"
+)
+
+// plainRetry is how long a receiver that rejected the wire codec or compression
+// is sent plain JSON before they are tried again, so that an upgraded receiver
+// gets them back
+const plainRetry = 5 * time.Minute
+
+// Compression of frames, named as in the Content-Encoding header
+const (
+	CompressionNone    = "none"
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate" // zlib, as HTTP defines it
+)
+
+var (
+	wireMu    sync.RWMutex
+	wireCodec = BinaryCodec
+	plainOnly = make(map[string]time.Time) // Receivers that rejected the wire codec or compression, until when they are sent plain JSON
+)
+
+// ConfigureWire applies the wire and TLS configuration: the codec messages
+// are sent with, the keepalive of TCP transport connections and mutual TLS
+func ConfigureWire(config common.Config) error {
+	codec, err := CodecByName(config.Wire.Codec)
+	if err != nil {
+		return err
+	}
+	SetWireCodec(codec)
+	if config.Wire.TCPKeepAliveSeconds > 0 {
+		transport.TCP.SetKeepAlive(time.Duration(config.Wire.TCPKeepAliveSeconds) * time.Second)
+	}
+	if config.TLS.Enabled {
+		security, err := transport.LoadSecurity(config.TLS.CA, config.TLS.CertDir)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS settings: %w", err)
+		}
+		if _, hostport, err := transport.Parse(config.GroundStationAddress); err == nil {
+			security.ExpectServer(hostport, "GroundStation")
+		}
+		for _, sat := range config.Satellites {
+			security.ExpectServer(satelliteHostport(sat.Port), sat.ID)
+		}
+		transport.SetSecurity(security)
+	}
+	return nil
+}
+
+// SetWireCodec selects the codec messages are sent with
+func SetWireCodec(codec Codec) {
+	wireMu.Lock()
+	defer wireMu.Unlock()
+	wireCodec = codec
+}
+
+// codecFor returns the codec and compression to send to address with
+func codecFor(address, compression string) (Codec, string) {
+	wireMu.RLock()
+	defer wireMu.RUnlock()
+	if until, ok := plainOnly[address]; ok && time.Now().Before(until) {
+		return JSONCodec, CompressionNone
+	}
+	return wireCodec, compression
+}
+
+// sentFrame describes a frame that was sent
+type sentFrame struct {
+	codec   Codec
+	encoded int // Body size before compression
+	sent    int // Body size on the wire
+}
+
+// Send sends messages from a node as one uncompressed frame to a satellite,
+// the ground station or any receiver speaking the wire codecs, at address
+// (host:port, or tcp://host:port for the TCP transport)
+func Send(from, address string, msgs ...Message) error {
+	_, err := sendFrame(from, address, msgs, CompressionNone)
+	return err
+}
+
+// sendFrame sends messages as one frame, compressed if that makes it smaller.
+// A receiver that does not accept the configured codec or compression
+// rejects the frame as unsupported; it is sent plain JSON for plainRetry.
+func sendFrame(from, address string, msgs []Message, compression string) (sentFrame, error) {
+	codec, encoding := codecFor(address, compression)
+	sent, err := send(from, address, codec, encoding, msgs)
+	if errors.Is(err, transport.ErrUnsupported) && (codec != JSONCodec || encoding != CompressionNone) {
+		wireMu.Lock()
+		plainOnly[address] = time.Now().Add(plainRetry)
+		wireMu.Unlock()
+		sent, err = send(from, address, JSONCodec, CompressionNone, msgs)
+	}
+	return sent, err
+}
+
+func send(from, address string, codec Codec, compression string, msgs []Message) (sentFrame, error) {
+	sent := sentFrame{codec: codec}
+	body, err := codec.Marshal(msgs)
+	if err != nil {
+		return sent, fmt.Errorf("failed to encode message: %w", err)
+	}
+	sent.encoded = len(body)
+	body, encoding, err := compress(body, compression)
+	if err != nil {
+		return sent, err
+	}
+	sent.sent = len(body)
+
+	frame := transport.Frame{ContentType: codec.ContentType(), Body: body}
+	if encoding != CompressionNone {
+		frame.Encoding = encoding
+	}
+	return sent, transport.Send(from, address, frame)
+}
+
+// compress compresses a body, keeping it as is when compression does not
+// make it smaller. It returns the encoding applied.
+func compress(body []byte, compression string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		w = zlib.NewWriter(&buf)
+	default:
+		return body, CompressionNone, nil
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	if buf.Len() >= len(body) {
+		return body, CompressionNone, nil
+	}
+	return buf.Bytes(), compression, nil
+}
+
+// CheckSender verifies, under mutual TLS, that the peer a frame came from is
+// the node that last handled each of its messages, returning an error
+// wrapping transport.ErrForbidden otherwise. Without TLS the peer is unknown
+// and every frame passes.
+func CheckSender(msgs []Message, peer transport.Peer) error {
+	if peer.ID == "" {
+		return nil
+	}
+	for _, msg := range msgs {
+		if sender := msg.Sender(); sender != peer.ID {
+			return fmt.Errorf("%w: %s sent message %d as %s", transport.ErrForbidden, peer.ID, msg.ID, sender)
+		}
+	}
+	return nil
+}
+
+// DecodeFrame decodes the messages of a frame in the codec its content type
+// names, decompressing it as its encoding says. Errors wrap
+// transport.ErrUnsupported for unknown codecs and encodings and
+// transport.ErrMalformed for frames that do not decode.
+func DecodeFrame(frame transport.Frame) ([]Message, error) {
+	codec, err := CodecForContentType(frame.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v (accepted: %s, %s)", transport.ErrUnsupported, err, ContentTypeJSON, BinaryCodec.ContentType())
+	}
+
+	var body io.Reader = bytes.NewReader(frame.Body)
+	switch frame.Encoding {
+	case "", "identity":
+	case CompressionGzip, CompressionDeflate:
+		var decompressor io.ReadCloser
+		if frame.Encoding == CompressionGzip {
+			decompressor, err = gzip.NewReader(body)
+		} else {
+			decompressor, err = zlib.NewReader(body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", transport.ErrMalformed, err)
+		}
+		defer decompressor.Close()
+		body = decompressor
+	default:
+		return nil, fmt.Errorf("%w: encoding %s (accepted: %s, %s)", transport.ErrUnsupported, frame.Encoding, CompressionGzip, CompressionDeflate)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, transport.MaxFrameSize+1))
+	if err == nil && len(data) > transport.MaxFrameSize {
+		err = errors.New("frame too large")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrMalformed, err)
+	}
+	msgs, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrMalformed, err)
+	}
+	return msgs, nil
+}
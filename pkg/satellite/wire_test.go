@@ -0,0 +1,104 @@
+package satellite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"project3/pkg/transport"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUnsupportedReceiverIsRetried(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get("Content-Type"))
+		mu.Unlock()
+		if r.Header.Get("Content-Type") != ContentTypeJSON || r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	defer func() {
+		wireMu.Lock()
+		delete(plainOnly, address)
+		wireMu.Unlock()
+	}()
+	takeReceived := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := received
+		received = nil
+		return got
+	}
+
+	msgs := testBatch(20)
+	if _, err := sendFrame("Satellite-1", address, msgs, CompressionGzip); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if got := takeReceived(); len(got) != 2 || got[0] != BinaryCodec.ContentType() || got[1] != ContentTypeJSON {
+		t.Errorf("first send: receiver got %v, want binary then JSON", got)
+	}
+
+	sent, err := sendFrame("Satellite-1", address, msgs, CompressionGzip)
+	if err != nil || sent.codec != JSONCodec {
+		t.Fatalf("second send: %+v, %v", sent, err)
+	}
+	if got := takeReceived(); len(got) != 1 {
+		t.Errorf("second send: receiver got %v, want JSON only", got)
+	}
+
+	// Once the downgrade expires the configured codec is tried again
+	wireMu.Lock()
+	plainOnly[address] = time.Now().Add(-time.Second)
+	wireMu.Unlock()
+	if _, err := sendFrame("Satellite-1", address, msgs, CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	if got := takeReceived(); len(got) != 2 || got[0] != BinaryCodec.ContentType() {
+		t.Errorf("after expiry: receiver got %v, want binary then JSON", got)
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	msgs := testBatch(3)
+	body, _ := BinaryCodec.Marshal(msgs)
+	compressed, encoding, err := compress(body, CompressionGzip)
+	if err != nil || encoding != CompressionGzip {
+		t.Fatalf("compress: %v, %v", encoding, err)
+	}
+	decoded, err := DecodeFrame(transport.Frame{ContentType: BinaryCodec.ContentType(), Encoding: encoding, Body: compressed})
+	if err != nil || len(decoded) != 3 {
+		t.Errorf("gzip frame: %d messages, %v", len(decoded), err)
+	}
+
+	// A small body that decompresses beyond the frame limit
+	var bomb bytes.Buffer
+	w := gzip.NewWriter(&bomb)
+	w.Write(make([]byte, transport.MaxFrameSize+1))
+	w.Close()
+
+	cases := map[string]struct {
+		frame transport.Frame
+		want  error
+	}{
+		"unknown codec":    {transport.Frame{ContentType: "text/plain", Body: body}, transport.ErrUnsupported},
+		"unknown encoding": {transport.Frame{ContentType: BinaryCodec.ContentType(), Encoding: "br", Body: body}, transport.ErrUnsupported},
+		"not gzip":         {transport.Frame{ContentType: BinaryCodec.ContentType(), Encoding: CompressionGzip, Body: body}, transport.ErrMalformed},
+		"too large":        {transport.Frame{ContentType: ContentTypeJSON, Encoding: CompressionGzip, Body: bomb.Bytes()}, transport.ErrMalformed},
+		"bad body":         {transport.Frame{ContentType: ContentTypeJSON, Body: []byte("{")}, transport.ErrMalformed},
+	}
+	for name, c := range cases {
+		if _, err := DecodeFrame(c.frame); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", name, err, c.want)
+		}
+	}
+}
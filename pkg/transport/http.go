@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxStatusText bounds the answer to a frame read back from a receiver
+const maxStatusText = 1024
+
+// HTTPTransport posts every frame to / of the receiver, naming its codec and
+// compression in the Content-Type and Content-Encoding headers
+type HTTPTransport struct {
+	client *http.Client
+	tls    *tls.Config // HTTPS with client certificates if set
+}
+
+// NewHTTPTransport creates an HTTP transport sending with client
+func NewHTTPTransport(client *http.Client) *HTTPTransport {
+	return &HTTPTransport{client: client}
+}
+
+// Name returns NameHTTP
+func (t *HTTPTransport) Name() string {
+	return NameHTTP
+}
+
+// Send posts a frame and waits for the receiver's answer
+func (t *HTTPTransport) Send(address string, frame Frame) error {
+	scheme := "http://"
+	if t.tls != nil {
+		scheme = "https://"
+	}
+	req, err := http.NewRequest(http.MethodPost, scheme+address, bytes.NewReader(frame.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", frame.ContentType)
+	if frame.Encoding != "" {
+		req.Header.Set("Content-Encoding", frame.Encoding)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, maxStatusText))
+	io.Copy(io.Discard, resp.Body) // Lets the connection be reused
+	return statusError(address, resp.StatusCode, string(text))
+}
+
+// Listen serves frames posted to / on address
+func (t *HTTPTransport) Listen(address string, handler Handler) error {
+	server := &http.Server{
+		Addr:      address,
+		Handler:   httpHandler(handler),
+		TLSConfig: t.tls,
+	}
+	if t.tls != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// httpHandler passes the frames posted to / to handler and answers with its outcome
+func httpHandler(handler Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxFrameSize+1))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > MaxFrameSize {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		frame := Frame{ContentType: r.Header.Get("Content-Type"), Encoding: r.Header.Get("Content-Encoding"), Body: body}
+		if err := handler(frame, peerOf(r.RemoteAddr, r.TLS)); err != nil {
+			http.Error(w, err.Error(), statusOf(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "Message received successfully")
+	})
+	return mux
+}
@@ -0,0 +1,348 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Frames on a TCP connection are written as
+//
+//	uint32 length of the rest, 0 for a keepalive
+//	uint8 length, content type
+//	uint8 length, encoding
+//	body
+//
+// and each is answered, in order, with
+//
+//	uint16 status, as in HTTP
+//	uint16 length, status text
+//
+// All integers are big-endian.
+
+const (
+	// DefaultKeepAlive is how long a connection may stay idle before a keepalive is sent
+	DefaultKeepAlive = 15 * time.Second
+
+	dialTimeout       = 5 * time.Second
+	roundTripTimeout  = 10 * time.Second // To send a frame and read its answer
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+	idleKeepAlives    = 3 // Keepalives a receiver waits for before dropping a connection
+)
+
+// TCPTransport keeps one connection per receiver, sending its frames one at a
+// time. A connection that fails is closed and dialed again on the next frame,
+// waiting longer after each failed attempt; a frame that fails on a
+// connection opened for an earlier frame is retried once on a new one.
+type TCPTransport struct {
+	mu        sync.Mutex
+	keepAlive time.Duration
+	tls       *tls.Config // TLS with client certificates if set
+	security  *Security   // Tells which node to expect at an address under TLS
+	conns     map[string]*tcpConn
+}
+
+// NewTCPTransport creates a TCP transport sending keepalives on connections idle for keepAlive
+func NewTCPTransport(keepAlive time.Duration) *TCPTransport {
+	return &TCPTransport{keepAlive: keepAlive, conns: make(map[string]*tcpConn)}
+}
+
+// SetKeepAlive changes the keepalive interval of connections opened from now on
+func (t *TCPTransport) SetKeepAlive(keepAlive time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keepAlive = keepAlive
+}
+
+func (t *TCPTransport) keepAliveInterval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.keepAlive
+}
+
+// Name returns NameTCP
+func (t *TCPTransport) Name() string {
+	return NameTCP
+}
+
+// Send writes a frame on the connection to address and waits for its answer
+func (t *TCPTransport) Send(address string, frame Frame) error {
+	if len(frame.ContentType) > 255 || len(frame.Encoding) > 255 {
+		return fmt.Errorf("content type or encoding too long")
+	}
+	if len(frame.Body) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds %d", len(frame.Body), MaxFrameSize)
+	}
+
+	t.mu.Lock()
+	c, exists := t.conns[address]
+	if !exists {
+		c = &tcpConn{address: address, keepAlive: t.keepAlive}
+		if t.tls != nil {
+			c.tls = t.security.clientConfig(t.tls, address)
+		}
+		t.conns[address] = c
+	}
+	t.mu.Unlock()
+	return c.send(frame)
+}
+
+// Listen accepts connections on address and serves their frames
+func (t *TCPTransport) Listen(address string, handler Handler) error {
+	keepAlive := t.keepAliveInterval()
+	config := net.ListenConfig{KeepAlive: keepAlive}
+	listener, err := config.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return err
+	}
+	if t.tls != nil {
+		listener = tls.NewListener(listener, t.tls)
+	}
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go serveTCP(conn, handler, keepAlive)
+	}
+}
+
+// serveTCP answers the frames of a connection until it closes or stays idle
+// for several keepalive intervals
+func serveTCP(conn net.Conn, handler Handler, keepAlive time.Duration) {
+	defer conn.Close()
+	peer := Peer{Addr: conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		state := tlsConn.ConnectionState()
+		peer = peerOf(peer.Addr, &state)
+	}
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleKeepAlives * keepAlive))
+		frame, keepalive, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		status, text := http.StatusOK, ""
+		if !keepalive {
+			if err := handler(frame, peer); err != nil {
+				status, text = statusOf(err), err.Error()
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(roundTripTimeout))
+		if err := writeAnswer(conn, status, text); err != nil {
+			return
+		}
+	}
+}
+
+// tcpConn is the connection of a sender to one receiver
+type tcpConn struct {
+	address   string
+	keepAlive time.Duration
+	tls       *tls.Config
+
+	mu       sync.Mutex // Held for each frame, so that answers match their frames
+	conn     net.Conn   // Nil while disconnected
+	r        *bufio.Reader
+	lastUsed time.Time
+	failures int       // Consecutive failed dials
+	retryAt  time.Time // No dial before then
+}
+
+func (c *tcpConn) send(frame Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reused := c.conn != nil
+	if err := c.connect(); err != nil {
+		return err
+	}
+	status, text, err := c.roundTrip(frame, false)
+	if err != nil && reused {
+		// The receiver may have dropped the connection since, e.g. on a restart
+		c.close()
+		if err = c.connect(); err != nil {
+			return err
+		}
+		status, text, err = c.roundTrip(frame, false)
+	}
+	if err != nil {
+		c.close()
+		return err
+	}
+	return statusError(c.address, status, text)
+}
+
+// connect dials the receiver unless connected; c.mu must be held
+func (c *tcpConn) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	if wait := time.Until(c.retryAt); wait > 0 {
+		return fmt.Errorf("%s unreachable, reconnecting in %v", c.address, wait.Round(time.Millisecond))
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: c.keepAlive}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		delay := maxReconnectDelay
+		if c.failures < 6 {
+			delay = minReconnectDelay << uint(c.failures)
+		}
+		c.failures++
+		c.retryAt = time.Now().Add(delay)
+		return err
+	}
+	c.failures = 0
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.lastUsed = time.Now()
+	go c.keepAlives(conn)
+	return nil
+}
+
+// close drops the connection; c.mu must be held
+func (c *tcpConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.r = nil
+	}
+}
+
+// roundTrip writes a frame, or a keepalive, and reads its answer; c.mu must be held
+func (c *tcpConn) roundTrip(frame Frame, keepalive bool) (int, string, error) {
+	c.conn.SetDeadline(time.Now().Add(roundTripTimeout))
+	if err := writeFrame(c.conn, frame, keepalive); err != nil {
+		return 0, "", err
+	}
+	status, text, err := readAnswer(c.r)
+	if err != nil {
+		return 0, "", err
+	}
+	c.lastUsed = time.Now()
+	return status, text, nil
+}
+
+// keepAlives sends a keepalive whenever conn has been idle for the keepalive
+// interval, closing it if the receiver stops answering. It stops once conn
+// is closed or replaced.
+func (c *tcpConn) keepAlives(conn net.Conn) {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		if c.conn != conn {
+			c.mu.Unlock()
+			return
+		}
+		if time.Since(c.lastUsed) >= c.keepAlive {
+			if _, _, err := c.roundTrip(Frame{}, true); err != nil {
+				c.close()
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func writeFrame(w io.Writer, frame Frame, keepalive bool) error {
+	if keepalive {
+		_, err := w.Write(make([]byte, 4))
+		return err
+	}
+	size := 2 + len(frame.ContentType) + len(frame.Encoding) + len(frame.Body)
+	buf := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint32(buf, uint32(size))
+	buf = append(buf, byte(len(frame.ContentType)))
+	buf = append(buf, frame.ContentType...)
+	buf = append(buf, byte(len(frame.Encoding)))
+	buf = append(buf, frame.Encoding...)
+	buf = append(buf, frame.Body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (Frame, bool, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, false, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size == 0 {
+		return Frame{}, true, nil
+	}
+	if size > MaxFrameSize+2*256 {
+		return Frame{}, false, fmt.Errorf("%w: frame of %d bytes", ErrMalformed, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Frame{}, false, err
+	}
+
+	var frame Frame
+	var ok bool
+	if frame.ContentType, data, ok = readString(data); !ok {
+		return Frame{}, false, fmt.Errorf("%w: truncated content type", ErrMalformed)
+	}
+	if frame.Encoding, data, ok = readString(data); !ok {
+		return Frame{}, false, fmt.Errorf("%w: truncated encoding", ErrMalformed)
+	}
+	frame.Body = data
+	return frame, false, nil
+}
+
+// readString reads a string prefixed with its uint8 length
+func readString(data []byte) (string, []byte, bool) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", nil, false
+	}
+	n := 1 + int(data[0])
+	return string(data[1:n]), data[n:], true
+}
+
+func writeAnswer(w io.Writer, status int, text string) error {
+	if len(text) > maxStatusText {
+		text = text[:maxStatusText]
+	}
+	buf := make([]byte, 4, 4+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(status))
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(text)))
+	_, err := w.Write(append(buf, text...))
+	return err
+}
+
+func readAnswer(r *bufio.Reader) (int, string, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", err
+	}
+	text := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	if _, err := io.ReadFull(r, text); err != nil {
+		return 0, "", err
+	}
+	return int(binary.BigEndian.Uint16(header[:])), string(text), nil
+}
@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Security holds what nodes need for mutual TLS: the CA every certificate is
+// checked against and the directory of the node certificates, named
+// <node-id>.crt and <node-id>.key. The common name of a node's certificate
+// is its ID, which receivers report as the identity of the sender, and which
+// senders check against the node they expect at the address they dial.
+type Security struct {
+	roots   *x509.CertPool
+	certDir string
+	mu      sync.RWMutex
+	servers map[string]string // Node IDs by the host:port they listen on
+}
+
+// LoadSecurity reads the CA certificate for mutual TLS between nodes with certificates in certDir
+func LoadSecurity(caFile, certDir string) (*Security, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate in %s", caFile)
+	}
+	return &Security{roots: roots, certDir: certDir, servers: make(map[string]string)}, nil
+}
+
+// ExpectServer records that the node listening on hostport is node. Senders
+// only complete a handshake with a server whose certificate names the node
+// expected at the address, so a node with any certificate from the CA cannot
+// stand in for another.
+func (s *Security) ExpectServer(hostport, node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers[hostport] = node
+}
+
+// clientConfig returns the configuration to dial hostport with, which refuses
+// server certificates of any other node than the one expected there
+func (s *Security) clientConfig(config *tls.Config, hostport string) *tls.Config {
+	s.mu.RLock()
+	expected, known := s.servers[hostport]
+	s.mu.RUnlock()
+	config = config.Clone()
+	config.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		if !known {
+			return fmt.Errorf("no node is expected at %s", hostport)
+		}
+		if len(chains) == 0 || chains[0][0].Subject.CommonName != expected {
+			return fmt.Errorf("server at %s is not %s", hostport, expected)
+		}
+		return nil
+	}
+	return config
+}
+
+// config returns the TLS configuration of a node, as client and as server
+func (s *Security) config(node string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(s.certDir, node+".crt"), filepath.Join(s.certDir, node+".key"))
+	if err != nil {
+		return nil, fmt.Errorf("certificate of %s: %w", node, err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      s.roots,
+		ClientCAs:    s.roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ServerConfig returns the TLS configuration of a node's listeners outside the
+// node transports. With clientCerts, clients must present a certificate from
+// the CA, as AIS receivers do; without, any client may connect, as browsers do.
+func (s *Security) ServerConfig(node string, clientCerts bool) (*tls.Config, error) {
+	config, err := s.config(node)
+	if err != nil {
+		return nil, err
+	}
+	if !clientCerts {
+		config.ClientAuth, config.ClientCAs = tls.NoClientCert, nil
+	}
+	return config, nil
+}
+
+// ClientConfig returns the TLS configuration a node dials hostport with outside
+// the node transports, which refuses any other server than the one expected there
+func (s *Security) ClientConfig(node, hostport string) (*tls.Config, error) {
+	config, err := s.config(node)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientConfig(config, hostport), nil
+}
+
+// Peer identifies the sender of a frame
+type Peer struct {
+	Addr string // Remote address
+	ID   string // Common name of the sender's verified certificate; empty without TLS
+}
+
+// String returns the peer's ID and address, or only its address without TLS
+func (p Peer) String() string {
+	if p.ID == "" {
+		return p.Addr
+	}
+	return p.ID + " (" + p.Addr + ")"
+}
+
+// peerOf returns the peer of a TLS connection, or one known by address only
+func peerOf(addr string, state *tls.ConnectionState) Peer {
+	peer := Peer{Addr: addr}
+	if state != nil && len(state.PeerCertificates) > 0 {
+		peer.ID = state.PeerCertificates[0].Subject.CommonName
+	}
+	return peer
+}
+
+var (
+	securityMu sync.Mutex
+	security   *Security
+	nodes      = make(map[[2]string]Transport) // Transports of the nodes, by node ID and transport name
+)
+
+// SetSecurity enables mutual TLS on every transport created from then on, or disables it if nil
+func SetSecurity(s *Security) {
+	securityMu.Lock()
+	defer securityMu.Unlock()
+	security = s
+	nodes = make(map[[2]string]Transport)
+}
+
+// ForNode returns the transport called name that a node sends and listens
+// with: with the node's certificate under mutual TLS, the shared plaintext
+// transports otherwise
+func ForNode(node, name string) (Transport, error) {
+	securityMu.Lock()
+	defer securityMu.Unlock()
+	if security == nil {
+		return byName(name)
+	}
+	if t, exists := nodes[[2]string{node, name}]; exists {
+		return t, nil
+	}
+
+	config, err := security.config(node)
+	if err != nil {
+		return nil, err
+	}
+	var t Transport
+	switch name {
+	case "", NameHTTP:
+		s := security
+		client := &http.Client{Timeout: roundTripTimeout, Transport: &http.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: dialTimeout}, Config: s.clientConfig(config, addr)}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			IdleConnTimeout: 90 * time.Second,
+		}}
+		t = &HTTPTransport{client: client, tls: config}
+	case NameTCP:
+		tcp := NewTCPTransport(TCP.keepAliveInterval())
+		tcp.tls = config
+		tcp.security = security
+		t = tcp
+	default:
+		return nil, fmt.Errorf("unknown transport %q", name)
+	}
+	nodes[[2]string{node, name}] = t
+	return t, nil
+}
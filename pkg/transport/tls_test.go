@@ -0,0 +1,240 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecurity issues certificates for 127.0.0.1 to the nodes under a new CA
+func testSecurity(t *testing.T, nodes ...string) *Security {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", caDER)
+
+	for i, node := range nodes {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: node},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		writePEM(t, filepath.Join(dir, node+".crt"), "CERTIFICATE", der)
+		writePEM(t, filepath.Join(dir, node+".key"), "EC PRIVATE KEY", keyDER)
+	}
+
+	security, err := LoadSecurity(filepath.Join(dir, "ca.crt"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return security
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveHTTPS serves frames as node over HTTPS and returns its host:port
+func serveHTTPS(t *testing.T, security *Security, node string, peers chan<- Peer) string {
+	t.Helper()
+	config, err := security.config(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(nil)
+	server.Config.Handler = httpHandler(func(_ Frame, peer Peer) error {
+		peers <- peer
+		return nil
+	})
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+// serveTLSOverTCP serves frames as node over TCP with TLS and returns its host:port
+func serveTLSOverTCP(t *testing.T, security *Security, node string, peers chan<- Peer) string {
+	t.Helper()
+	config, err := security.config(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	server := NewTCPTransport(DefaultKeepAlive)
+	server.tls = config
+	go server.Listen(address, func(_ Frame, peer Peer) error {
+		peers <- peer
+		return nil
+	})
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return address
+}
+
+func TestSenderChecksServerIdentity(t *testing.T) {
+	security := testSecurity(t, "Satellite-1", "Satellite-2", "Vessel-1")
+	SetSecurity(security)
+	defer SetSecurity(nil)
+
+	for name, serve := range map[string]func(*testing.T, *Security, string, chan<- Peer) string{
+		NameHTTP: serveHTTPS,
+		NameTCP:  serveTLSOverTCP,
+	} {
+		t.Run(name, func(t *testing.T) {
+			peers := make(chan Peer, 10)
+			genuine := serve(t, security, "Satellite-1", peers)
+			impostor := serve(t, security, "Satellite-2", peers)
+			unknown := serve(t, security, "Satellite-1", peers)
+			security.ExpectServer(genuine, "Satellite-1")
+			security.ExpectServer(impostor, "Satellite-1")
+
+			sender, err := ForNode("Vessel-1", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame := Frame{ContentType: "application/json", Body: []byte("[]")}
+			if err := sender.Send(genuine, frame); err != nil {
+				t.Fatalf("send to the expected node: %v", err)
+			}
+			if peer := <-peers; peer.ID != "Vessel-1" {
+				t.Errorf("receiver saw %v, want Vessel-1", peer)
+			}
+			if err := sender.Send(impostor, frame); err == nil || !strings.Contains(err.Error(), "is not Satellite-1") {
+				t.Errorf("send to another node's address: %v, want a rejected certificate", err)
+			}
+			if err := sender.Send(unknown, frame); err == nil || !strings.Contains(err.Error(), "no node is expected") {
+				t.Errorf("send to an unknown address: %v, want a rejected certificate", err)
+			}
+			if len(peers) != 0 {
+				t.Errorf("%d frames reached a node that was not expected", len(peers))
+			}
+		})
+	}
+}
+
+// serveHandshakes completes TLS handshakes with config and reports their result
+func serveHandshakes(t *testing.T, config *tls.Config) (string, <-chan error) {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	results := make(chan error, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			results <- conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), results
+}
+
+func TestServerConfigOutsideNodeTransports(t *testing.T) {
+	security := testSecurity(t, "GroundStation", "Feed")
+	withoutCert := &tls.Config{RootCAs: security.roots}
+
+	// The API lets clients without a certificate in
+	config, err := security.ServerConfig("GroundStation", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, results := serveHandshakes(t, config)
+	conn, err := tls.Dial("tcp", address, withoutCert)
+	if err != nil {
+		t.Fatalf("client without a certificate refused: %v", err)
+	}
+	conn.Close()
+	if err := <-results; err != nil {
+		t.Errorf("server handshake: %v", err)
+	}
+
+	// Feeds must present one from the CA
+	config, err = security.ServerConfig("GroundStation", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, results = serveHandshakes(t, config)
+	if conn, err := tls.Dial("tcp", address, withoutCert); err == nil {
+		conn.Read(make([]byte, 1)) // TLS 1.3 reports the refusal after the client's handshake
+		conn.Close()
+	}
+	if err := <-results; err == nil {
+		t.Error("feed listener accepted a client without a certificate")
+	}
+	security.ExpectServer(address, "GroundStation")
+	client, err := security.ClientConfig("Feed", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = tls.Dial("tcp", address, client)
+	if err != nil {
+		t.Fatalf("receiver with a certificate refused: %v", err)
+	}
+	conn.Close()
+	if err := <-results; err != nil {
+		t.Errorf("server handshake with the receiver: %v", err)
+	}
+
+	// The receiver refuses a listener with another node's certificate
+	security.ExpectServer(address, "Satellite-1")
+	client, _ = security.ClientConfig("Feed", address)
+	if conn, err := tls.Dial("tcp", address, client); err == nil {
+		conn.Close()
+		t.Error("receiver accepted a listener that is not the node expected")
+	}
+}
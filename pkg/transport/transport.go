@@ -0,0 +1,146 @@
+// Package transport carries frames of encoded messages between vessels,
+// satellites and the ground station, over HTTP or over persistent TCP
+// connections with length-prefixed frames, optionally under mutual TLS. Both
+// report the outcome of every frame with an HTTP status, so senders handle
+// them alike.
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxFrameSize bounds the body of a frame, both as sent and after decompression
+const MaxFrameSize = 8 << 20
+
+// Transport names, as configured and as address schemes
+const (
+	NameHTTP = "http"
+	NameTCP  = "tcp"
+)
+
+var (
+	// ErrUnsupported reports a frame in a content type or encoding the receiver does not accept
+	ErrUnsupported = errors.New("unsupported content type or encoding")
+	// ErrMalformed reports a frame the receiver could not decode
+	ErrMalformed = errors.New("malformed frame")
+	// ErrForbidden reports a frame the sender's identity does not allow
+	ErrForbidden = errors.New("sender not allowed")
+	// ErrUnavailable reports a receiver that is down and may take frames again later
+	ErrUnavailable = errors.New("receiver unavailable")
+)
+
+// Frame is an encoded batch of messages
+type Frame struct {
+	ContentType string // Codec of the body, e.g. application/json
+	Encoding    string // Compression of the body as in Content-Encoding; empty if none
+	Body        []byte
+}
+
+// Handler processes a frame received from a peer. Errors wrapping
+// ErrUnsupported, ErrMalformed, ErrForbidden or ErrUnavailable are reported to the sender as
+// such; any other error as a failure of the receiver.
+type Handler func(frame Frame, peer Peer) error
+
+// Transport sends and receives frames
+type Transport interface {
+	// Name returns NameHTTP or NameTCP
+	Name() string
+	// Send delivers a frame to the receiver at address (host:port) and waits for its answer
+	Send(address string, frame Frame) error
+	// Listen serves frames on address until it fails
+	Listen(address string, handler Handler) error
+}
+
+var (
+	// HTTP sends each frame as a POST request, in plaintext
+	HTTP Transport = NewHTTPTransport(&http.Client{Timeout: roundTripTimeout})
+	// TCP sends frames over one persistent connection per receiver, in plaintext
+	TCP = NewTCPTransport(DefaultKeepAlive)
+)
+
+// byName returns the plaintext transport called name; empty means HTTP
+func byName(name string) (Transport, error) {
+	switch name {
+	case "", NameHTTP:
+		return HTTP, nil
+	case NameTCP:
+		return TCP, nil
+	}
+	return nil, fmt.Errorf("unknown transport %q", name)
+}
+
+// Parse splits an address into the name of its transport and host:port.
+// Addresses are written tcp://host:port or http://host:port; a bare
+// host:port is HTTP.
+func Parse(address string) (string, string, error) {
+	if i := strings.Index(address, "://"); i >= 0 {
+		name := address[:i]
+		if _, err := byName(name); err != nil {
+			return "", "", err
+		}
+		return name, address[i+len("://"):], nil
+	}
+	return NameHTTP, address, nil
+}
+
+// Address writes host:port as an address of the transport called name
+func Address(name, hostport string) string {
+	if name == "" || name == NameHTTP {
+		return hostport
+	}
+	return name + "://" + hostport
+}
+
+// Send delivers a frame from a node to an address written as Parse accepts it
+func Send(from, address string, frame Frame) error {
+	name, hostport, err := Parse(address)
+	if err != nil {
+		return err
+	}
+	t, err := ForNode(from, name)
+	if err != nil {
+		return err
+	}
+	return t.Send(hostport, frame)
+}
+
+// statusOf returns the status reporting a handler's outcome to the sender
+func statusOf(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrUnsupported):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrMalformed):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// statusError turns the status a receiver answered into an error
+func statusError(address string, status int, text string) error {
+	text = strings.TrimSpace(text)
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnsupportedMediaType:
+		return fmt.Errorf("%w: %s", ErrUnsupported, strings.TrimPrefix(text, ErrUnsupported.Error()+": "))
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", ErrMalformed, strings.TrimPrefix(text, ErrMalformed.Error()+": "))
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrForbidden, strings.TrimPrefix(text, ErrForbidden.Error()+": "))
+	case http.StatusServiceUnavailable:
+		return fmt.Errorf("%w: %s", ErrUnavailable, strings.TrimPrefix(text, ErrUnavailable.Error()+": "))
+	}
+	if text != "" {
+		return fmt.Errorf("%s returned status %d: %s", address, status, text)
+	}
+	return fmt.Errorf("%s returned status %d", address, status)
+}
@@ -0,0 +1,164 @@
+package tui
+
+import (
+	"fmt"
+	"project3/pkg/groundstation"
+	"project3/pkg/satellite"
+	"sort"
+	"time"
+)
+
+// Loss alerts fire when a satellite loses more than lossAlertRatio of at least
+// lossAlertMinimum messages between two polls
+const (
+	lossAlertRatio   = 0.5
+	lossAlertMinimum = 3
+)
+
+// diff returns the events that explain the change from prev to next. The first
+// snapshot only reports what is already abnormal.
+func diff(prev, next *snapshot) []Event {
+	var events []Event
+	add := func(level Level, format string, args ...interface{}) {
+		events = append(events, Event{Level: level, Message: fmt.Sprintf(format, args...)})
+	}
+
+	before := make(map[string]groundstation.VesselState)
+	if prev != nil {
+		for _, v := range prev.vessels {
+			before[v.VesselID] = v
+		}
+	}
+	for _, v := range next.vessels {
+		old, known := before[v.VesselID]
+		if !known && prev != nil {
+			add(Info, "%s appeared via %s", v.VesselID, via(v))
+		}
+		if known && old.State == v.State {
+			continue
+		}
+		switch v.State {
+		case groundstation.Fresh:
+			if known {
+				add(Info, "%s reporting again via %s", v.VesselID, via(v))
+			}
+		case groundstation.Stale:
+			add(Warning, "%s is stale, last fix %s ago", v.VesselID, formatAge(next.polledAt.Sub(v.LastSeen)))
+		case groundstation.Lost:
+			add(Alert, "%s is lost, last fix %s ago", v.VesselID, formatAge(next.polledAt.Sub(v.LastSeen)))
+		}
+	}
+
+	previous := make(map[string]satellite.SatelliteInfo)
+	if prev != nil {
+		for _, s := range prev.satellites {
+			previous[s.ID] = s
+		}
+	}
+	current := make(map[string]bool)
+	for _, s := range next.satellites {
+		current[s.ID] = true
+		old, known := previous[s.ID]
+		switch {
+		case !known && prev != nil:
+			add(Info, "%s joined the constellation (%s)", s.ID, s.Status)
+		case !known && s.Status != "Active":
+			add(Alert, "%s is %s", s.ID, s.Status)
+		case known && old.Status != s.Status:
+			level := Info
+			if s.Status != "Active" {
+				level = Alert
+			}
+			add(level, "%s changed from %s to %s", s.ID, old.Status, s.Status)
+		}
+		if known {
+			lost := s.Stats.Lost - old.Stats.Lost
+			handled := lost + s.Stats.Forwarded - old.Stats.Forwarded
+			if lost >= lossAlertMinimum && float64(lost) > lossAlertRatio*float64(handled) {
+				add(Warning, "%s lost %d of %d messages since the last poll", s.ID, lost, handled)
+			}
+		}
+	}
+	for _, s := range prev.satellitesOrNil() {
+		if !current[s.ID] {
+			add(Alert, "%s left the constellation", s.ID)
+		}
+	}
+
+	if prev != nil {
+		events = append(events, diffLinks(prev.links, next.links)...)
+	}
+	return events
+}
+
+// diffLinks reports links that appeared, disappeared or changed quality
+func diffLinks(prev, next map[string][]satellite.LinkInfo) []Event {
+	type linkKey struct{ from, to string }
+	index := func(links map[string][]satellite.LinkInfo) map[linkKey]satellite.LinkInfo {
+		indexed := make(map[linkKey]satellite.LinkInfo)
+		for from, list := range links {
+			for _, link := range list {
+				indexed[linkKey{from, link.Neighbor}] = link
+			}
+		}
+		return indexed
+	}
+	before, after := index(prev), index(next)
+
+	var events []Event
+	for key, link := range after {
+		old, existed := before[key]
+		switch {
+		case !existed:
+			events = append(events, Event{Level: Info, Message: fmt.Sprintf("Link %s -> %s up (%d ms, %.0f%% loss)", key.from, key.to, link.Latency, link.PacketLoss*100)})
+		case old.Latency != link.Latency || old.PacketLoss != link.PacketLoss:
+			events = append(events, Event{Level: Info, Message: fmt.Sprintf("Link %s -> %s changed to %d ms, %.0f%% loss (was %d ms, %.0f%%)",
+				key.from, key.to, link.Latency, link.PacketLoss*100, old.Latency, old.PacketLoss*100)})
+		}
+	}
+	for key := range before {
+		if _, exists := after[key]; !exists {
+			events = append(events, Event{Level: Warning, Message: fmt.Sprintf("Link %s -> %s down", key.from, key.to)})
+		}
+	}
+	// Map iteration is random; keep the log stable
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Message < events[j].Message })
+	return events
+}
+
+func (s *snapshot) satellitesOrNil() []satellite.SatelliteInfo {
+	if s == nil {
+		return nil
+	}
+	return s.satellites
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// via names the satellite or feed that delivered the vessel's last fix
+func via(v groundstation.VesselState) string {
+	if v.Satellite == "" {
+		return orDash(v.Feed)
+	}
+	return v.Satellite
+}
+
+// formatAge prints a duration the way the screen shows ages
+func formatAge(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%02dh", int(d.Hours())/24, int(d.Hours())%24)
+}
@@ -0,0 +1,317 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"project3/pkg/groundstation"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences
+const (
+	escClearLine  = "\x1b[K"
+	escClearBelow = "\x1b[J"
+	escHome       = "\x1b[H"
+	escAltScreen  = "\x1b[?1049h"
+	escMainScreen = "\x1b[?1049l"
+	escHideCursor = "\x1b[?25l"
+	escShowCursor = "\x1b[?25h"
+	colorReset    = "\x1b[0m"
+	colorBold     = "\x1b[1m"
+	colorDim      = "\x1b[2m"
+	colorRed      = "\x1b[31m"
+	colorGreen    = "\x1b[32m"
+	colorYellow   = "\x1b[33m"
+	colorCyan     = "\x1b[36m"
+)
+
+const (
+	minEventRows   = 3  // Rows of the event log kept on screen however many vessels there are
+	onceEventLimit = 20 // Events printed by -once
+	fixTimeLayout  = "2006-01-02 15:04:05"
+	eventLayout    = "15:04:05"
+)
+
+// cell is a piece of a line, padded to width and drawn in color
+type cell struct {
+	text  string
+	width int
+	color string
+	right bool // Align right within width
+}
+
+type line []cell
+
+// screen renders the monitor to a terminal
+type screen struct {
+	out   io.Writer
+	color bool
+}
+
+func newScreen(out io.Writer, color bool) *screen {
+	return &screen{out: out, color: color}
+}
+
+// enter switches to the alternate screen so that quitting restores the shell
+func (s *screen) enter() {
+	io.WriteString(s.out, escAltScreen+escHideCursor)
+}
+
+func (s *screen) leave() {
+	io.WriteString(s.out, escShowCursor+escMainScreen)
+}
+
+// draw renders one frame. In full-screen mode the frame is fitted to the
+// terminal and drawn over the previous one; otherwise it is printed as is.
+func (s *screen) draw(m *monitor, now time.Time, fullScreen bool) error {
+	width, height := terminalSize()
+	lines := layout(m, now, width, height, fullScreen)
+
+	var buf bytes.Buffer
+	if fullScreen {
+		buf.WriteString(escHome)
+	}
+	for i, l := range lines {
+		s.writeLine(&buf, l, width)
+		if fullScreen {
+			buf.WriteString(escClearLine)
+			if i == len(lines)-1 {
+				break // A newline on the last row would scroll the screen
+			}
+			buf.WriteString("\r")
+		}
+		buf.WriteString("\n")
+	}
+	if fullScreen {
+		buf.WriteString(escClearBelow)
+	}
+	_, err := s.out.Write(buf.Bytes())
+	return err
+}
+
+// writeLine writes the cells of a line, cut at the terminal width
+func (s *screen) writeLine(buf *bytes.Buffer, l line, width int) {
+	used := 0
+	for i, c := range l {
+		text := c.text
+		if c.width > 0 {
+			text = pad(text, c.width, c.right)
+		}
+		if i < len(l)-1 {
+			text += " "
+		}
+		if n := utf8.RuneCountInString(text); used+n > width {
+			text = truncate(text, width-used)
+		}
+		used += utf8.RuneCountInString(text)
+		if s.color && c.color != "" {
+			buf.WriteString(c.color + text + colorReset)
+		} else {
+			buf.WriteString(text)
+		}
+		if used >= width {
+			return
+		}
+	}
+}
+
+// layout builds the frame: a header, the vessel table, the satellite table and
+// as much of the event log as fits
+func layout(m *monitor, now time.Time, width, height int, fullScreen bool) []line {
+	var lines []line
+	status := cell{text: "connected", color: colorGreen}
+	if m.err != nil {
+		status = cell{text: "disconnected: " + m.err.Error(), color: colorRed}
+	}
+	lines = append(lines, line{
+		{text: "MaritimeNavigator", color: colorBold},
+		{text: m.api, color: colorDim},
+		{text: now.Format(eventLayout)},
+		status,
+	})
+
+	var vessels []groundstation.VesselState
+	var satelliteRows []line
+	if m.last != nil {
+		vessels = sortBySeverity(m.last.vessels)
+		satelliteRows = satelliteTable(m.last)
+	}
+
+	// Fit the tables so that the event log keeps a few rows
+	vesselRows := len(vessels)
+	if fullScreen {
+		fixed := 1 + 3 + 3 + 2 // Header, three section titles and table headers, blank lines
+		available := height - fixed - minEventRows
+		if max := available / 3; len(satelliteRows) > max && max > 0 {
+			satelliteRows = satelliteRows[:max]
+		}
+		available -= len(satelliteRows)
+		if vesselRows > available {
+			vesselRows = available
+		}
+		if vesselRows < 0 {
+			vesselRows = 0
+		}
+	}
+
+	lines = append(lines, line{})
+	title := fmt.Sprintf("VESSELS (%s)", fleetSummary(vessels))
+	if vesselRows < len(vessels) {
+		title += fmt.Sprintf(", %d not shown", len(vessels)-vesselRows)
+	}
+	lines = append(lines, line{{text: title, color: colorBold + colorCyan}})
+	lines = append(lines, line{
+		{text: "VESSEL", width: 14, color: colorDim},
+		{text: "STATE", width: 6, color: colorDim},
+		{text: "LATITUDE", width: 10, right: true, color: colorDim},
+		{text: "LONGITUDE", width: 11, right: true, color: colorDim},
+		{text: "LAST FIX (UTC)", width: 19, color: colorDim},
+		{text: "AGE", width: 7, right: true, color: colorDim},
+		{text: "VIA", width: 14, color: colorDim},
+		{text: "HOPS", width: 4, right: true, color: colorDim},
+	})
+	for _, v := range vessels[:vesselRows] {
+		lines = append(lines, line{
+			{text: v.VesselID, width: 14},
+			{text: string(v.State), width: 6, color: stateColor(v.State)},
+			{text: fmt.Sprintf("%.4f", v.Position.Latitude), width: 10, right: true},
+			{text: fmt.Sprintf("%.4f", v.Position.Longitude), width: 11, right: true},
+			{text: v.Position.Timestamp.UTC().Format(fixTimeLayout), width: 19},
+			{text: formatAge(now.Sub(v.LastSeen)), width: 7, right: true},
+			{text: via(v), width: 14},
+			{text: fmt.Sprint(v.Hops), width: 4, right: true},
+		})
+	}
+
+	lines = append(lines, line{})
+	lines = append(lines, line{{text: "SATELLITES", color: colorBold + colorCyan}})
+	lines = append(lines, line{
+		{text: "SATELLITE", width: 14, color: colorDim},
+		{text: "STATUS", width: 7, color: colorDim},
+		{text: "QUEUE", width: 5, right: true, color: colorDim},
+		{text: "RECEIVED", width: 9, right: true, color: colorDim},
+		{text: "FORWARDED", width: 9, right: true, color: colorDim},
+		{text: "LOST", width: 7, right: true, color: colorDim},
+		{text: "EXPIRED", width: 7, right: true, color: colorDim},
+		{text: "LINKS (LATENCY, LOSS)", color: colorDim},
+	})
+	lines = append(lines, satelliteRows...)
+
+	lines = append(lines, line{})
+	lines = append(lines, line{{text: "EVENTS", color: colorBold + colorCyan}})
+	eventRows := onceEventLimit
+	if fullScreen {
+		eventRows = height - len(lines)
+	}
+	events := m.events
+	if len(events) > eventRows {
+		events = events[len(events)-eventRows:]
+	}
+	for _, e := range events {
+		lines = append(lines, line{
+			{text: e.Time.Format(eventLayout), color: colorDim},
+			{text: e.Level.String(), width: 5, color: levelColor(e.Level)},
+			{text: e.Message},
+		})
+	}
+	return lines
+}
+
+func satelliteTable(snap *snapshot) []line {
+	var rows []line
+	for _, s := range snap.satellites {
+		var links []string
+		for _, l := range snap.links[s.ID] {
+			links = append(links, fmt.Sprintf("%s %dms %.0f%%", l.Neighbor, l.Latency, l.PacketLoss*100))
+		}
+		if g := s.GroundLink; g != nil {
+			links = append(links, fmt.Sprintf("ground %dms %.0f%%", g.Latency, g.PacketLoss*100))
+		}
+		statusColor := colorGreen
+		if s.Status != "Active" {
+			statusColor = colorRed
+		}
+		lostColor := ""
+		if s.Stats.Lost > 0 {
+			lostColor = colorYellow
+		}
+		rows = append(rows, line{
+			{text: s.ID, width: 14},
+			{text: s.Status, width: 7, color: statusColor},
+			{text: fmt.Sprint(s.Stats.QueueDepth), width: 5, right: true},
+			{text: fmt.Sprint(s.Stats.Received), width: 9, right: true},
+			{text: fmt.Sprint(s.Stats.Forwarded), width: 9, right: true},
+			{text: fmt.Sprint(s.Stats.Lost), width: 7, right: true, color: lostColor},
+			{text: fmt.Sprint(s.Stats.Expired), width: 7, right: true},
+			{text: strings.Join(links, ", ")},
+		})
+	}
+	return rows
+}
+
+// sortBySeverity puts lost vessels first, then stale ones, each sorted by ID
+func sortBySeverity(vessels []groundstation.VesselState) []groundstation.VesselState {
+	rank := map[groundstation.Staleness]int{groundstation.Lost: 0, groundstation.Stale: 1, groundstation.Fresh: 2}
+	sorted := append([]groundstation.VesselState(nil), vessels...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if rank[sorted[i].State] != rank[sorted[j].State] {
+			return rank[sorted[i].State] < rank[sorted[j].State]
+		}
+		return sorted[i].VesselID < sorted[j].VesselID
+	})
+	return sorted
+}
+
+func fleetSummary(vessels []groundstation.VesselState) string {
+	counts := make(map[groundstation.Staleness]int)
+	for _, v := range vessels {
+		counts[v.State]++
+	}
+	return fmt.Sprintf("%d: %d fresh, %d stale, %d lost", len(vessels), counts[groundstation.Fresh], counts[groundstation.Stale], counts[groundstation.Lost])
+}
+
+func stateColor(state groundstation.Staleness) string {
+	switch state {
+	case groundstation.Fresh:
+		return colorGreen
+	case groundstation.Stale:
+		return colorYellow
+	}
+	return colorRed
+}
+
+func levelColor(level Level) string {
+	switch level {
+	case Warning:
+		return colorYellow
+	case Alert:
+		return colorRed + colorBold
+	}
+	return colorGreen
+}
+
+func pad(text string, width int, right bool) string {
+	n := utf8.RuneCountInString(text)
+	if n >= width {
+		return truncate(text, width)
+	}
+	if right {
+		return strings.Repeat(" ", width-n) + text
+	}
+	return text + strings.Repeat(" ", width-n)
+}
+
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,18 @@
+package tui
+
+import (
+	"os"
+	"strconv"
+)
+
+// defaultTerminalSize reads COLUMNS and LINES, falling back to 120x40
+func defaultTerminalSize() (width, height int) {
+	width, height = 120, 40
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		height = n
+	}
+	return width, height
+}
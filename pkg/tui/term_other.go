@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package tui
+
+// terminalSize returns the size given by the environment, as the terminal
+// cannot be queried on this platform
+func terminalSize() (width, height int) {
+	return defaultTerminalSize()
+}
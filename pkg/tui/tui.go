@@ -0,0 +1,193 @@
+package tui
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"project3/pkg/groundstation"
+	"project3/pkg/satellite"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxEvents is how many events the log keeps for scrolling
+const maxEvents = 500
+
+// snapshot is the state of the system as seen by one poll of the API
+type snapshot struct {
+	vessels    []groundstation.VesselState
+	satellites []satellite.SatelliteInfo
+	links      map[string][]satellite.LinkInfo // By satellite ID
+	polledAt   time.Time
+}
+
+// Event is an entry of the event log
+type Event struct {
+	Time    time.Time
+	Level   Level
+	Message string
+}
+
+// Level is the severity of an event
+type Level int
+
+const (
+	Info Level = iota
+	Warning
+	Alert
+)
+
+func (l Level) String() string {
+	switch l {
+	case Warning:
+		return "WARN"
+	case Alert:
+		return "ALERT"
+	}
+	return "INFO"
+}
+
+// monitor polls the API and keeps what the screen shows
+type monitor struct {
+	api    string
+	client *http.Client
+	last   *snapshot
+	events []Event
+	err    error // Of the last poll
+}
+
+// RunCommand implements the terminal dashboard command line:
+//
+//	tui [-api http://127.0.0.1:12345] [-ca certs/ca.crt] [-interval 2s] [-once] [-no-color]
+//
+// It redraws the screen until interrupted with Ctrl-C.
+func RunCommand(args []string) error {
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	apiURL := flags.String("api", "http://127.0.0.1:12345", "base URL of the API server")
+	caFile := flags.String("ca", "", "CA certificate to check an https API against, instead of the system's")
+	interval := flags.Duration("interval", 2*time.Second, "how often the API is polled")
+	once := flags.Bool("once", false, "print a single frame and exit")
+	noColor := flags.Bool("no-color", os.Getenv("NO_COLOR") != "", "disable colors")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := url.ParseRequestURI(*apiURL); err != nil {
+		return fmt.Errorf("invalid -api: %v", err)
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("invalid -interval: must be positive")
+	}
+
+	client := &http.Client{Timeout: *interval}
+	if *caFile != "" {
+		data, err := ioutil.ReadFile(*caFile)
+		if err != nil {
+			return err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate in %s", *caFile)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}}
+	}
+	m := &monitor{api: strings.TrimRight(*apiURL, "/"), client: client}
+	screen := newScreen(os.Stdout, !*noColor)
+	m.poll(time.Now())
+	if *once {
+		return screen.draw(m, time.Now(), false)
+	}
+
+	screen.enter()
+	defer screen.leave()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	polls := time.NewTicker(*interval)
+	defer polls.Stop()
+	redraws := time.NewTicker(time.Second) // Ages keep moving between polls
+	defer redraws.Stop()
+	for {
+		if err := screen.draw(m, time.Now(), true); err != nil {
+			return err
+		}
+		select {
+		case <-interrupt:
+			return nil
+		case now := <-polls.C:
+			m.poll(now)
+		case <-redraws.C:
+		}
+	}
+}
+
+// poll fetches a snapshot and logs how it differs from the previous one
+func (m *monitor) poll(now time.Time) {
+	next, err := m.fetch(now)
+	if err != nil {
+		if m.err == nil {
+			m.log(now, Alert, fmt.Sprintf("API unreachable: %v", err))
+		}
+		m.err = err
+		return
+	}
+	if m.err != nil {
+		m.log(now, Info, "API reachable again")
+		m.err = nil
+	}
+	for _, e := range diff(m.last, next) {
+		m.log(now, e.Level, e.Message)
+	}
+	m.last = next
+}
+
+func (m *monitor) log(now time.Time, level Level, message string) {
+	m.events = append(m.events, Event{Time: now, Level: level, Message: message})
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+}
+
+func (m *monitor) fetch(now time.Time) (*snapshot, error) {
+	snap := &snapshot{links: make(map[string][]satellite.LinkInfo), polledAt: now}
+	if err := m.get("/vessels", &snap.vessels); err != nil {
+		return nil, err
+	}
+	if err := m.get("/satellites", &snap.satellites); err != nil {
+		return nil, err
+	}
+	for _, sat := range snap.satellites {
+		var links []satellite.LinkInfo
+		if err := m.get("/satellites/"+url.PathEscape(sat.ID)+"/links", &links); err != nil {
+			return nil, err
+		}
+		snap.links[sat.ID] = links
+	}
+	return snap, nil
+}
+
+func (m *monitor) get(path string, v interface{}) error {
+	resp, err := m.client.Get(m.api + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("GET %s: %s %s", path, resp.Status, body.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
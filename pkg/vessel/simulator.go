@@ -1,8 +1,8 @@
 package vessel
 
 import (
-	"fmt"
 	"log"
+	"project3/pkg/auth"
 	"project3/pkg/common"
 	"project3/pkg/satellite"
 	"sync"
@@ -22,6 +22,17 @@ func RunSimulation(configPath string) {
 		log.Fatalf("Configuration validation failed: %v", err)
 	}
 
+	// Select the codec and transport settings of the uplink to the satellites
+	if err := satellite.ConfigureWire(common.AppConfig); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Load the keys the vessels sign their reports with
+	keys, err := auth.LoadSigningKeys(common.AppConfig.Auth)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
 	// Create a topology manager for the satellites
 	manager := &satellite.TopologyManager{Satellites: make(map[string]*satellite.Satellite)}
 
@@ -33,6 +44,7 @@ func RunSimulation(configPath string) {
 			LatencyMap:    make(map[string]int),
 			PacketLossMap: make(map[string]float64),
 			Status:        "Active",
+			Transport:     satConfig.Transport,
 		}
 		manager.AddSatellite(sat)
 	}
@@ -43,8 +55,9 @@ func RunSimulation(configPath string) {
 		wg.Add(1)
 		go func(vConfig common.VesselConfig) {
 			defer wg.Done()
-			satelliteAddress := fmt.Sprintf("127.0.0.1:%d", manager.Satellites[vConfig.Satellite].Port)
-			SimulateVessel(vConfig.ID, satelliteAddress)
+			satelliteAddress := manager.Satellites[vConfig.Satellite].Address()
+			key, _ := keys.Key(vConfig.ID)
+			SimulateVessel(vConfig, satelliteAddress, key)
 		}(vesselConfig)
 	}
 
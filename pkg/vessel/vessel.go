@@ -1,90 +1,193 @@
 package vessel
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	cryptorand "crypto/rand"
+	"encoding/binary"
 	"log"
+	"math"
 	"math/rand"
-	"net/http"
+	"project3/pkg/auth"
+	"project3/pkg/common"
 	"project3/pkg/protocol"
 	"project3/pkg/satellite"
 	"time"
 )
 
+// Simulation settings
+const (
+	updateInterval = 5 * time.Second
+	staticEvery    = 12   // Reports between two reports carrying static data
+	defaultSpeed   = 12.0 // Cruising speed in knots when none is configured
+	maxLatitude    = 80.0 // Vessels turn back before reaching the polar ice
+)
+
 // VesselSimulator defines a single vessel
 type VesselSimulator struct {
-	VesselID  string
-	Latitude  float64
-	Longitude float64
+	VesselID   string
+	Info       protocol.VesselInfo
+	Latitude   float64
+	Longitude  float64
+	Speed      float64 // Over ground, knots
+	Course     float64 // Over ground, degrees true
+	Heading    float64 // Degrees true
+	RateOfTurn float64 // Degrees per minute, positive to starboard
+	Status     protocol.NavigationStatus
+	cruise     float64 // Speed the vessel keeps to
 }
 
-// SimulateVessel handles individual vessel simulation
-func SimulateVessel(vesselID, satelliteAddress string) {
-	log.Printf("Simulating vessel %s sending updates to satellite at %s\n", vesselID, satelliteAddress)
+// NewVesselSimulator places a configured vessel at a random position and course
+func NewVesselSimulator(config common.VesselConfig) *VesselSimulator {
+	info := protocol.VesselInfo{
+		MMSI:        config.MMSI,
+		IMO:         config.IMO,
+		Name:        config.Name,
+		CallSign:    config.CallSign,
+		ShipType:    protocol.ShipType(config.ShipType),
+		Draught:     config.Draught,
+		Destination: config.Destination,
+	}
+	if config.Length > 0 || config.Beam > 0 {
+		// The GNSS antenna is placed a quarter of the length from the stern, on the center line
+		info.Dimensions = &protocol.Dimensions{
+			ToBow:       config.Length - config.Length/4,
+			ToStern:     config.Length / 4,
+			ToPort:      config.Beam / 2,
+			ToStarboard: config.Beam - config.Beam/2,
+		}
+	}
+	cruise := config.Speed
+	if cruise == 0 {
+		cruise = defaultSpeed
+	}
+
+	status := protocol.UnderWayUsingEngine
+	switch info.ShipType {
+	case 30:
+		status = protocol.EngagedInFishing
+	case 36:
+		status = protocol.UnderWaySailing
+	}
 
-	vessel := VesselSimulator{
-		VesselID:  vesselID,
-		Latitude:  rand.Float64()*180 - 90,
+	course := rand.Float64() * 360
+	return &VesselSimulator{
+		VesselID:  config.ID,
+		Info:      info,
+		Latitude:  rand.Float64()*2*maxLatitude - maxLatitude,
 		Longitude: rand.Float64()*360 - 180,
+		Speed:     cruise,
+		Course:    course,
+		Heading:   course,
+		Status:    status,
+		cruise:    cruise,
 	}
+}
 
-	msgID := 1
+// Step advances the vessel by elapsed along its course, occasionally changing
+// course and varying its speed around the cruising speed
+func (v *VesselSimulator) Step(elapsed time.Duration) {
+	switch r := rand.Float64(); {
+	case r < 0.1:
+		v.RateOfTurn = (rand.Float64() - 0.5) * 40 // Start a turn of up to 20° per minute
+	case r < 0.3:
+		v.RateOfTurn = 0
+	}
+	v.Course = normalizeDegrees(v.Course + v.RateOfTurn*elapsed.Minutes())
+	v.Heading = normalizeDegrees(v.Course + (rand.Float64()-0.5)*6) // Leeway and current
+	v.Speed = math.Max(0, v.Speed+(v.cruise-v.Speed)*0.1+(rand.Float64()-0.5)*0.4)
+
+	distance := v.Speed * elapsed.Hours() // Nautical miles, one per minute of latitude
+	v.Latitude += distance * math.Cos(v.Course*math.Pi/180) / 60
+	v.Longitude += distance * math.Sin(v.Course*math.Pi/180) / (60 * math.Cos(v.Latitude*math.Pi/180))
+	if math.Abs(v.Latitude) > maxLatitude {
+		v.Latitude = clamp(v.Latitude, -maxLatitude, maxLatitude)
+		v.Course = normalizeDegrees(180 - v.Course)
+	}
+	v.Longitude = normalizeDegrees(v.Longitude+180) - 180
+}
 
-	for {
-		vessel.Latitude += (rand.Float64() - 0.5) * 0.1
-		vessel.Longitude += (rand.Float64() - 0.5) * 0.1
+// Report returns the vessel's position report, with its static data if requested
+func (v *VesselSimulator) Report(now time.Time, withStatic bool) protocol.PositionMessage {
+	speed := math.Round(v.Speed*10) / 10
+	course := math.Round(v.Course*10) / 10
+	heading := int(math.Round(v.Heading)) % 360
+	rateOfTurn := math.Round(v.RateOfTurn*10) / 10
+	status := v.Status
+	pos := protocol.PositionMessage{
+		Type:      protocol.PositionUpdate,
+		VesselID:  v.VesselID,
+		Latitude:  v.Latitude,
+		Longitude: v.Longitude,
+		Timestamp: now,
+		MMSI:      v.Info.MMSI,
+		Navigation: &protocol.Navigation{
+			SpeedOverGround:  &speed,
+			CourseOverGround: &course,
+			Heading:          &heading,
+			RateOfTurn:       &rateOfTurn,
+			Status:           &status,
+		},
+	}
+	if withStatic {
+		info := v.Info
+		pos.Static = &info
+	}
+	return pos
+}
+
+// SimulateVessel handles individual vessel simulation. Reports are signed with key unless it is nil.
+func SimulateVessel(config common.VesselConfig, satelliteAddress string, key *auth.Key) {
+	log.Printf("Simulating vessel %s sending updates to satellite at %s\n", config.ID, satelliteAddress)
+
+	vessel := NewVesselSimulator(config)
+
+	// Reports are batched into frames on the uplink, so errors surface per frame
+	policy := satellite.BatchPolicyFromConfig(common.AppConfig.Wire.Uplink)
+	uplink := satellite.NewBatcher(vessel.VesselID, config.Satellite, satelliteAddress, policy,
+		func(msgs []satellite.Message, err error) {
+			if err != nil {
+				log.Printf("Failed to send %d update(s) from vessel %s: %v", len(msgs), vessel.VesselID, err)
+				return
+			}
+			log.Printf("Sent %d update(s) from vessel %s to satellite at %s", len(msgs), vessel.VesselID, satelliteAddress)
+		})
 
-		vessel.Latitude = clamp(vessel.Latitude, -90, 90)
-		vessel.Longitude = clamp(vessel.Longitude, -180, 180)
+	msgID := messageEpoch()
+
+	for reports := 0; ; reports++ {
+		vessel.Step(updateInterval)
 
 		msg := satellite.Message{
 			ID:          msgID,
 			Source:      vessel.VesselID,
 			Destination: "GroundStation",
-			Content: protocol.PositionMessage{
-				Type:      protocol.PositionUpdate,
-				VesselID:  vessel.VesselID,
-				Latitude:  vessel.Latitude,
-				Longitude: vessel.Longitude,
-				Timestamp: time.Now(),
-			},
-			Priority: rand.Intn(10),
-			TTL:      5,
+			Content:     vessel.Report(time.Now(), reports%staticEvery == 0),
+			Priority:    rand.Intn(10),
+			TTL:         5,
 		}
 
 		msgID++
 
-		err := sendToSatellite(msg, satelliteAddress)
-		if err != nil {
-			log.Printf("Failed to send update from vessel %s: %v", vessel.VesselID, err)
+		if key != nil {
+			if err := key.Sign(&msg); err != nil {
+				log.Printf("Failed to sign update from vessel %s: %v", vessel.VesselID, err)
+			}
 		}
+		uplink.Add(msg)
 
-		time.Sleep(5 * time.Second)
+		time.Sleep(updateInterval)
 	}
 }
 
-// sendToSatellite sends a simulated update from a vessel to a satellite
-func sendToSatellite(msg satellite.Message, satelliteAddress string) error {
-	// Serialize the message to JSON
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to serialize message: %w", err)
-	}
-
-	// Send the JSON payload via HTTP POST
-	resp, err := http.Post(fmt.Sprintf("http://%s", satelliteAddress), "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return fmt.Errorf("failed to send message to satellite: %w", err)
+// messageEpoch returns a random first message ID for a run, so that a
+// restarted vessel does not reuse the IDs of its previous run, which the
+// ground station would drop as duplicates
+func messageEpoch() int {
+	var b [4]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		return int(time.Now().UnixNano() & 0x3fffffff)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected response status: %d", resp.StatusCode)
-	}
-
-	log.Printf("Sent message to satellite at %s: %+v", satelliteAddress, msg)
-	return nil
+	// 30 bits leave room to count up without overflowing a 32-bit int
+	return int(binary.BigEndian.Uint32(b[:]) >> 2)
 }
 
 // clamp ensures values are within specified bounds
@@ -97,3 +200,12 @@ func clamp(value, min, max float64) float64 {
 	}
 	return value
 }
+
+// normalizeDegrees maps an angle into [0, 360)
+func normalizeDegrees(degrees float64) float64 {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
@@ -0,0 +1,584 @@
+// Package wal implements a segmented append-only log. Records are framed with
+// their length and a CRC-32C checksum; segments are rotated by size or age, and a
+// torn record at the end of the newest segment is truncated when the log is opened.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"project3/pkg/common"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frameHeaderSize is the size of the length and checksum preceding every payload
+const frameHeaderSize = 8
+
+// segmentExt is the file extension of segment files
+const segmentExt = ".wal"
+
+// maxRecordSize bounds the length field so that a corrupt header cannot trigger a huge allocation
+const maxRecordSize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrClosed is returned by operations on a closed log
+var ErrClosed = errors.New("wal: log is closed")
+
+// ErrCorrupt is returned when a record fails validation
+var ErrCorrupt = errors.New("wal: corrupt record")
+
+// SyncPolicy controls when appended records are flushed to stable storage
+type SyncPolicy string
+
+const (
+	SyncAlways SyncPolicy = "always" // fsync after every append
+	SyncBatch  SyncPolicy = "batch"  // fsync periodically in the background
+	SyncNone   SyncPolicy = "none"   // leave flushing to the operating system
+)
+
+// Options configures a log
+type Options struct {
+	MaxSegmentBytes int64         // Rotate once the active segment reaches this size; 0 disables
+	MaxSegmentAge   time.Duration // Rotate once the active segment is this old; 0 disables
+	Sync            SyncPolicy
+	SyncInterval    time.Duration // Flush interval for SyncBatch
+}
+
+// Position locates a record in the log
+type Position struct {
+	Segment uint64
+	Offset  int64
+}
+
+// Segment describes a segment file
+type Segment struct {
+	ID     uint64
+	Path   string
+	Size   int64
+	Sealed bool // Sealed segments are no longer written to
+}
+
+// Log is a segmented append-only log stored in a directory
+type Log struct {
+	mu       sync.Mutex
+	readMu   sync.Mutex
+	readers  map[uint64]*os.File // Open read handles for random access, by segment
+	dir      string
+	opts     Options
+	segments []Segment
+	active   *os.File
+	created  time.Time // When the active segment was opened
+	dirty    bool      // Unsynced writes are pending
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Open opens the log in dir, creating the directory if needed. The newest segment
+// is validated and any incomplete trailing record is truncated.
+func Open(dir string, opts Options) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if opts.Sync == "" {
+		opts.Sync = SyncBatch
+	}
+	if opts.Sync == SyncBatch && opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	l := &Log{dir: dir, opts: opts, readers: make(map[uint64]*os.File)}
+	ids, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		l.segments = append(l.segments, Segment{ID: id, Path: l.segmentPath(id), Sealed: true})
+	}
+
+	if len(l.segments) == 0 {
+		err = l.openSegment(1)
+	} else {
+		err = l.recoverActive()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range l.segments {
+		if info, err := os.Stat(l.segments[i].Path); err == nil {
+			l.segments[i].Size = info.Size()
+		}
+	}
+
+	if opts.Sync == SyncBatch {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.syncLoop()
+	}
+	return l, nil
+}
+
+// Append writes a record and returns its position
+func (l *Log) Append(payload []byte) (Position, error) {
+	if len(payload) > maxRecordSize {
+		return Position{}, fmt.Errorf("wal: record of %d bytes exceeds limit", len(payload))
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return Position{}, ErrClosed
+	}
+	if l.shouldRotate(int64(len(frame))) {
+		if err := l.rotate(); err != nil {
+			return Position{}, err
+		}
+	}
+
+	seg := &l.segments[len(l.segments)-1]
+	pos := Position{Segment: seg.ID, Offset: seg.Size}
+	if _, err := l.active.Write(frame); err != nil {
+		// Cut off whatever part of the frame made it to disk
+		l.active.Truncate(seg.Size)
+		l.active.Seek(seg.Size, io.SeekStart)
+		return Position{}, fmt.Errorf("wal: append failed: %w", err)
+	}
+	seg.Size += int64(len(frame))
+
+	if l.opts.Sync == SyncAlways {
+		if err := l.active.Sync(); err != nil {
+			return Position{}, fmt.Errorf("wal: sync failed: %w", err)
+		}
+	} else {
+		l.dirty = true
+	}
+	return pos, nil
+}
+
+// Sync flushes the active segment to stable storage
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return l.syncLocked()
+}
+
+// Rotate seals the active segment and starts a new one
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if l.segments[len(l.segments)-1].Size == 0 {
+		return nil
+	}
+	return l.rotate()
+}
+
+// Segments returns a snapshot of the segments, oldest first
+func (l *Log) Segments() []Segment {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	segments := make([]Segment, len(l.segments))
+	copy(segments, l.segments)
+	return segments
+}
+
+// Empty reports whether the log holds no records
+func (l *Log) Empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.segments) == 1 && l.segments[0].Size == 0
+}
+
+// Replay calls fn for every record in the log, oldest first
+func (l *Log) Replay(fn func(pos Position, payload []byte) error) error {
+	for _, seg := range l.Segments() {
+		if err := l.ReadSegment(seg, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSegment calls fn for every record of a segment, up to the size captured in seg.
+// A record failing validation stops the read with ErrCorrupt.
+func (l *Log) ReadSegment(seg Segment, fn func(pos Position, payload []byte) error) error {
+	file, err := os.Open(seg.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Removed by compaction after the snapshot was taken
+		}
+		return err
+	}
+	defer file.Close()
+
+	_, err = scanFrames(io.LimitReader(file, seg.Size), func(offset int64, payload []byte) error {
+		return fn(Position{Segment: seg.ID, Offset: offset}, payload)
+	})
+	return err
+}
+
+// ReadAt returns the payload of the record at pos
+func (l *Log) ReadAt(pos Position) ([]byte, error) {
+	l.readMu.Lock()
+	file, open := l.readers[pos.Segment]
+	if !open {
+		var err error
+		file, err = os.Open(l.segmentPath(pos.Segment))
+		if err != nil {
+			l.readMu.Unlock()
+			return nil, err
+		}
+		l.readers[pos.Segment] = file
+	}
+	l.readMu.Unlock()
+
+	header := make([]byte, frameHeaderSize)
+	if _, err := file.ReadAt(header, pos.Offset); err != nil {
+		return nil, fmt.Errorf("wal: read failed: %w", err)
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, ErrCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := file.ReadAt(payload, pos.Offset+frameHeaderSize); err != nil {
+		return nil, fmt.Errorf("wal: read failed: %w", err)
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorrupt
+	}
+	return payload, nil
+}
+
+// Rewrite is a filtered copy of a sealed segment waiting to replace it
+type Rewrite struct {
+	Segment Segment
+	Offsets map[int64]int64 // New offset of every kept record, by old offset
+	Kept    int
+	Dropped int
+	log     *Log
+	tmpPath string
+	size    int64
+}
+
+// RewriteSegment copies the records of a sealed segment for which keep returns true
+// into a temporary file. Nothing changes until the returned rewrite is committed,
+// so appends and reads proceed normally while the copy is made.
+func (l *Log) RewriteSegment(seg Segment, keep func(pos Position, payload []byte) bool) (*Rewrite, error) {
+	if !seg.Sealed {
+		return nil, fmt.Errorf("wal: segment %d is still active", seg.ID)
+	}
+	tmpPath := seg.Path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	rw := &Rewrite{Segment: seg, Offsets: make(map[int64]int64), log: l, tmpPath: tmpPath}
+	writer := bufio.NewWriter(tmp)
+	header := make([]byte, frameHeaderSize)
+
+	err = l.ReadSegment(seg, func(pos Position, payload []byte) error {
+		if !keep(pos, payload) {
+			rw.Dropped++
+			return nil
+		}
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+		if _, err := writer.Write(header); err != nil {
+			return err
+		}
+		if _, err := writer.Write(payload); err != nil {
+			return err
+		}
+		rw.Offsets[pos.Offset] = rw.size
+		rw.size += frameHeaderSize + int64(len(payload))
+		rw.Kept++
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return rw, nil
+}
+
+// Commit atomically replaces the segment with its filtered copy. A segment left
+// without records is removed.
+func (rw *Rewrite) Commit() error {
+	l := rw.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.readMu.Lock()
+	defer l.readMu.Unlock()
+
+	i := l.segmentIndex(rw.Segment.ID)
+	if i < 0 {
+		os.Remove(rw.tmpPath)
+		return fmt.Errorf("wal: segment %d no longer exists", rw.Segment.ID)
+	}
+	if file, open := l.readers[rw.Segment.ID]; open {
+		file.Close()
+		delete(l.readers, rw.Segment.ID)
+	}
+
+	if rw.Kept == 0 {
+		os.Remove(rw.tmpPath)
+		if err := os.Remove(rw.Segment.Path); err != nil {
+			return err
+		}
+		l.segments = append(l.segments[:i], l.segments[i+1:]...)
+	} else {
+		if err := os.Rename(rw.tmpPath, rw.Segment.Path); err != nil {
+			os.Remove(rw.tmpPath)
+			return err
+		}
+		l.segments[i].Size = rw.size
+	}
+	return syncDir(l.dir)
+}
+
+// Abort discards the filtered copy
+func (rw *Rewrite) Abort() {
+	os.Remove(rw.tmpPath)
+}
+
+// Close flushes and closes the log
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	err := l.active.Sync()
+	if cerr := l.active.Close(); err == nil {
+		err = cerr
+	}
+	l.mu.Unlock()
+
+	l.readMu.Lock()
+	for id, file := range l.readers {
+		file.Close()
+		delete(l.readers, id)
+	}
+	l.readMu.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	return err
+}
+
+// segmentIndex returns the index of a segment in l.segments, or -1
+func (l *Log) segmentIndex(id uint64) int {
+	for i, seg := range l.segments {
+		if seg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *Log) shouldRotate(frameSize int64) bool {
+	size := l.segments[len(l.segments)-1].Size
+	if size == 0 {
+		return false
+	}
+	if l.opts.MaxSegmentBytes > 0 && size+frameSize > l.opts.MaxSegmentBytes {
+		return true
+	}
+	return l.opts.MaxSegmentAge > 0 && time.Since(l.created) >= l.opts.MaxSegmentAge
+}
+
+// rotate seals the active segment and opens the next one
+func (l *Log) rotate() error {
+	if err := l.active.Sync(); err != nil {
+		return fmt.Errorf("wal: sync failed: %w", err)
+	}
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+	l.dirty = false
+	sealed := &l.segments[len(l.segments)-1]
+	sealed.Sealed = true
+	return l.openSegment(sealed.ID + 1)
+}
+
+// openSegment creates a new empty active segment
+func (l *Log) openSegment(id uint64) error {
+	path := l.segmentPath(id)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		file.Close()
+		return err
+	}
+	l.active = file
+	l.created = time.Now()
+	l.segments = append(l.segments, Segment{ID: id, Path: path})
+	return nil
+}
+
+// recoverActive reopens the newest segment, truncating a torn tail
+func (l *Log) recoverActive() error {
+	seg := &l.segments[len(l.segments)-1]
+	file, err := os.OpenFile(seg.Path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	valid, err := scanFrames(file, func(int64, []byte) error { return nil })
+	info, statErr := file.Stat()
+	if statErr != nil {
+		file.Close()
+		return statErr
+	}
+	if err != nil || valid < info.Size() {
+		common.Logger.Printf("wal: truncating segment %s from %d to %d bytes", seg.Path, info.Size(), valid)
+		if err := file.Truncate(valid); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	seg.Sealed = false
+	l.active = file
+	l.created = info.ModTime()
+	return nil
+}
+
+func (l *Log) syncLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if !l.closed {
+				if err := l.syncLocked(); err != nil {
+					common.Logger.Printf("wal: background sync failed: %v", err)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *Log) syncLocked() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *Log) segmentPath(id uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+// scanFrames reads frames from r and returns the offset just past the last valid one
+func scanFrames(r io.Reader, fn func(offset int64, payload []byte) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, frameHeaderSize)
+	var offset int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			return offset, ErrCorrupt
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		if size > maxRecordSize {
+			return offset, ErrCorrupt
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, ErrCorrupt
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, ErrCorrupt
+		}
+		if err := fn(offset, payload); err != nil {
+			return offset, err
+		}
+		offset += frameHeaderSize + int64(size)
+	}
+}
+
+// listSegments returns the IDs of the segment files in dir, ascending
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".compact") {
+			// Leftover of a compaction interrupted before commit
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// syncDir flushes directory metadata so that created or renamed files survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
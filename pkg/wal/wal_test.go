@@ -0,0 +1,292 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTest(t *testing.T, dir string, opts Options) *Log {
+	t.Helper()
+	if opts.Sync == "" {
+		opts.Sync = SyncAlways
+	}
+	l, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return l
+}
+
+func mustAppend(t *testing.T, l *Log, payload string) Position {
+	t.Helper()
+	pos, err := l.Append([]byte(payload))
+	if err != nil {
+		t.Fatalf("Append %q: %v", payload, err)
+	}
+	return pos
+}
+
+// records returns the payloads of every record in the log, oldest first
+func records(t *testing.T, l *Log) []string {
+	t.Helper()
+	var payloads []string
+	err := l.Replay(func(_ Position, payload []byte) error {
+		payloads = append(payloads, string(payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return payloads
+}
+
+func TestReopenReplaysRecords(t *testing.T) {
+	dir := t.TempDir()
+	l := openTest(t, dir, Options{})
+	if !l.Empty() {
+		t.Error("new log is not empty")
+	}
+	first := mustAppend(t, l, "one")
+	second := mustAppend(t, l, "two")
+	if first.Offset != 0 || second.Offset != frameHeaderSize+3 {
+		t.Errorf("positions %+v, %+v", first, second)
+	}
+	l.Close()
+
+	l = openTest(t, dir, Options{})
+	defer l.Close()
+	if got, want := records(t, l), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	payload, err := l.ReadAt(second)
+	if err != nil || string(payload) != "two" {
+		t.Errorf("ReadAt = %q, %v", payload, err)
+	}
+	if _, err := l.Append(nil); err != nil {
+		t.Errorf("Append of an empty record: %v", err)
+	}
+}
+
+func TestOpenTruncatesDamagedTail(t *testing.T) {
+	damage := map[string]func(data []byte, last int) []byte{
+		"torn header": func(data []byte, last int) []byte {
+			return data[:last+3]
+		},
+		"torn payload": func(data []byte, last int) []byte {
+			return data[:len(data)-1]
+		},
+		"bad checksum": func(data []byte, last int) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		},
+		"oversized length": func(data []byte, last int) []byte {
+			binary.BigEndian.PutUint32(data[last:], maxRecordSize+1)
+			return data
+		},
+	}
+	for name, fn := range damage {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			l := openTest(t, dir, Options{})
+			mustAppend(t, l, "one")
+			last := mustAppend(t, l, "two")
+			l.Close()
+
+			path := l.segmentPath(last.Segment)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, fn(data, int(last.Offset)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			l = openTest(t, dir, Options{})
+			defer l.Close()
+			if got, want := records(t, l), []string{"one"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("records = %v, want %v", got, want)
+			}
+			if pos := mustAppend(t, l, "three"); pos.Offset != last.Offset {
+				t.Errorf("appended at %d, want %d", pos.Offset, last.Offset)
+			}
+			if got, want := records(t, l), []string{"one", "three"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("records after append = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCorruptSealedSegment(t *testing.T) {
+	dir := t.TempDir()
+	l := openTest(t, dir, Options{})
+	mustAppend(t, l, "one")
+	pos := mustAppend(t, l, "two")
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	mustAppend(t, l, "three")
+	l.Close()
+
+	// Only the newest segment is repaired; damage to a sealed one is reported
+	path := l.segmentPath(pos.Segment)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	l = openTest(t, dir, Options{})
+	defer l.Close()
+	err := l.Replay(func(Position, []byte) error { return nil })
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Replay = %v, want ErrCorrupt", err)
+	}
+	if _, err := l.ReadAt(pos); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadAt = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	// Every segment fits two records of 10 bytes
+	l := openTest(t, dir, Options{MaxSegmentBytes: 2 * (frameHeaderSize + 10)})
+	for i := 0; i < 5; i++ {
+		pos := mustAppend(t, l, fmt.Sprintf("record-%03d", i))
+		if want := uint64(i/2 + 1); pos.Segment != want {
+			t.Errorf("record %d in segment %d, want %d", i, pos.Segment, want)
+		}
+	}
+	segments := l.Segments()
+	if len(segments) != 3 {
+		t.Fatalf("%d segments, want 3", len(segments))
+	}
+	for i, seg := range segments {
+		if seg.Sealed != (i < 2) {
+			t.Errorf("segment %d sealed = %v", seg.ID, seg.Sealed)
+		}
+	}
+
+	// Rotating an empty active segment is a no-op
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(l.Segments()); n != 4 {
+		t.Errorf("%d segments after rotating twice, want 4", n)
+	}
+	l.Close()
+
+	l = openTest(t, dir, Options{})
+	defer l.Close()
+	if got := records(t, l); len(got) != 5 || got[4] != "record-004" {
+		t.Errorf("records = %v", got)
+	}
+}
+
+func TestRewriteSegment(t *testing.T) {
+	dir := t.TempDir()
+	l := openTest(t, dir, Options{})
+	defer l.Close()
+	var positions []Position
+	for i := 0; i < 4; i++ {
+		positions = append(positions, mustAppend(t, l, fmt.Sprintf("r%d", i)))
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	mustAppend(t, l, "active")
+
+	if _, err := l.RewriteSegment(l.Segments()[1], nil); err == nil {
+		t.Error("rewrite of the active segment succeeded")
+	}
+
+	// An aborted rewrite changes nothing
+	seg := l.Segments()[0]
+	keepOdd := func(_ Position, payload []byte) bool { return payload[1]%2 == 1 }
+	rw, err := l.RewriteSegment(seg, keepOdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Abort()
+	if got := records(t, l); len(got) != 5 {
+		t.Errorf("records after abort = %v", got)
+	}
+
+	rw, err = l.RewriteSegment(seg, keepOdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rw.Kept != 2 || rw.Dropped != 2 {
+		t.Errorf("kept %d, dropped %d", rw.Kept, rw.Dropped)
+	}
+	if err := rw.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if got, want := records(t, l), []string{"r1", "r3", "active"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	moved := Position{Segment: seg.ID, Offset: rw.Offsets[positions[3].Offset]}
+	if payload, err := l.ReadAt(moved); err != nil || string(payload) != "r3" {
+		t.Errorf("ReadAt new offset = %q, %v", payload, err)
+	}
+
+	// A segment left without records is removed
+	rw, err = l.RewriteSegment(l.Segments()[0], func(Position, []byte) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if segments := l.Segments(); len(segments) != 1 || segments[0].ID != 2 {
+		t.Errorf("segments = %+v", segments)
+	}
+	if _, err := os.Stat(seg.Path); !os.IsNotExist(err) {
+		t.Errorf("emptied segment still on disk: %v", err)
+	}
+}
+
+func TestOpenRemovesCompactionLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	l := openTest(t, dir, Options{})
+	mustAppend(t, l, "one")
+	l.Rotate()
+	seg := l.Segments()[0]
+	if _, err := l.RewriteSegment(seg, func(Position, []byte) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	l.Close() // Before the rewrite is committed
+
+	l = openTest(t, dir, Options{})
+	defer l.Close()
+	if _, err := os.Stat(seg.Path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("leftover not removed: %v", err)
+	}
+	if got := records(t, l); !reflect.DeepEqual(got, []string{"one"}) {
+		t.Errorf("records = %v", got)
+	}
+}
+
+func TestClosedLog(t *testing.T) {
+	l := openTest(t, t.TempDir(), Options{Sync: SyncBatch})
+	mustAppend(t, l, "one")
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := l.Append([]byte("two")); err != ErrClosed {
+		t.Errorf("Append after Close = %v, want ErrClosed", err)
+	}
+	nested, err := Open(filepath.Join(t.TempDir(), "a", "b"), Options{})
+	if err != nil {
+		t.Fatalf("Open of a missing directory: %v", err)
+	}
+	nested.Close()
+}